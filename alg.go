@@ -186,3 +186,48 @@ func ForEachNode(g *Graph, predicate func(*Node) bool) bool {
 	}
 	return true
 }
+
+// Neighborhood returns the nodes that are at most hops edges away
+// from one of the given nodes, following the edges in the given
+// direction. The returned set includes the given nodes.
+func Neighborhood(nodes []*Node, hops int, dir EdgeDir) *NodeSet {
+	ret := NewNodeSet()
+	frontier := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !ret.Has(node) {
+			ret.Add(node)
+			frontier = append(frontier, node)
+		}
+	}
+	for i := 0; i < hops && len(frontier) > 0; i++ {
+		next := make([]*Node, 0)
+		for _, node := range frontier {
+			for edges := node.GetEdges(dir); edges.Next(); {
+				edge := edges.Edge()
+				for _, n := range []*Node{edge.GetFrom(), edge.GetTo()} {
+					if !ret.Has(n) {
+						ret.Add(n)
+						next = append(next, n)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return ret
+}
+
+// InducedEdges returns the edges whose source and target nodes are
+// both in the given node set
+func InducedEdges(nodes *NodeSet) []*Edge {
+	ret := make([]*Edge, 0)
+	for itr := nodes.Iterator(); itr.Next(); {
+		for edges := itr.Node().GetEdges(OutgoingEdge); edges.Next(); {
+			edge := edges.Edge()
+			if nodes.Has(edge.GetTo()) {
+				ret = append(ret, edge)
+			}
+		}
+	}
+	return ret
+}
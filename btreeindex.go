@@ -21,6 +21,8 @@ import (
 // A setTree is a B-Tree of linkedhashsets
 type setTree struct {
 	tree *btree.Tree
+	// Number of indexed items
+	entries int
 }
 
 func (s *setTree) add(key interface{}, id int, item interface{}) {
@@ -33,10 +35,12 @@ func (s *setTree) add(key interface{}, id int, item interface{}) {
 		s.tree.Put(key, v)
 	}
 	set := v.(*fastSet)
-	set.add(id, item)
+	if set.add(id, item) {
+		s.entries++
+	}
 }
 
-func (s setTree) remove(key interface{}, id int) {
+func (s *setTree) remove(key interface{}, id int) {
 	if s.tree == nil {
 		return
 	}
@@ -45,7 +49,9 @@ func (s setTree) remove(key interface{}, id int) {
 		return
 	}
 	set := v.(*fastSet)
-	set.remove(id)
+	if set.remove(id) {
+		s.entries--
+	}
 	if set.size() == 0 {
 		s.tree.Remove(key)
 	}
@@ -65,6 +71,18 @@ func (s setTree) find(key interface{}) Iterator {
 	return withSize(itr, set.size())
 }
 
+func (s setTree) stats() IndexStats {
+	if s.tree == nil {
+		return IndexStats{}
+	}
+	distinct := s.tree.Size()
+	return IndexStats{
+		Entries:        s.entries,
+		DistinctValues: distinct,
+		MemoryEstimate: distinct*(treeNodeBytes+setBytes) + s.entries*(mapEntryBytes+listElementBytes),
+	}
+}
+
 func (s setTree) valueItr() Iterator {
 	if s.tree == nil {
 		return emptyIterator{}
@@ -81,3 +99,53 @@ func (s setTree) valueItr() Iterator {
 		},
 	}
 }
+
+// rangeItr returns an iterator over the items whose keys are in a
+// range. before(key) returns true if the key is before the range, and
+// after(key) returns true if the key is after the range. Both must be
+// monotonic in key order.
+func (s setTree) rangeItr(before, after func(interface{}) bool) Iterator {
+	if s.tree == nil {
+		return emptyIterator{}
+	}
+	sets := make([]*fastSet, 0)
+	size := 0
+	var visit func(*btree.Node) bool
+	visit = func(node *btree.Node) bool {
+		for i, entry := range node.Entries {
+			// All keys in Children[i] are less than entry.Key
+			skip := before(entry.Key)
+			if !skip && len(node.Children) > 0 {
+				if !visit(node.Children[i]) {
+					return false
+				}
+			}
+			if after(entry.Key) {
+				return false
+			}
+			if !skip {
+				set := entry.Value.(*fastSet)
+				sets = append(sets, set)
+				size += set.size()
+			}
+		}
+		if len(node.Children) > 0 {
+			return visit(node.Children[len(node.Entries)])
+		}
+		return true
+	}
+	if s.tree.Root != nil {
+		visit(s.tree.Root)
+	}
+	itr := &funcIterator{
+		iteratorFunc: func() Iterator {
+			if len(sets) == 0 {
+				return nil
+			}
+			ret := sets[0].iterator()
+			sets = sets[1:]
+			return ret
+		},
+	}
+	return withSize(itr, size)
+}
@@ -18,8 +18,12 @@ type withProperties interface {
 	ForEachProperty(func(string, interface{}) bool) bool
 }
 
-// CopyGraph copies source graph into target, using clonePropertyFunc to clone properties
+// CopyGraph copies source graph into target, using clonePropertyFunc
+// to clone properties. External IDs of nodes and edges are
+// copied. If an external ID is already used in the target graph, this
+// call panics with ErrDuplicateExternalID.
 func CopyGraph(source, target *Graph, clonePropertyFunc func(string, interface{}) interface{}) map[*Node]*Node {
+	defer target.endMutation(target.mutation(), nil)
 	return CopyGraphf(source, func(node *Node, nodeMap map[*Node]*Node) *Node {
 		return target.cloneNode(source, node, clonePropertyFunc)
 	}, func(edge *Edge, nodeMap map[*Node]*Node) *Edge {
@@ -65,12 +69,16 @@ func CopySubgraph(sourceNode *Node, target *Graph, clonePropertyFunc func(string
 	}
 }
 
-// CopyNode copies the sourceNode into target graph
+// CopyNode copies the sourceNode into target graph. Panics with
+// ErrDuplicateExternalID if the external ID of the node is already
+// used in the target graph.
 func CopyNode(sourceNode *Node, target *Graph, clonePropertyFunc func(string, interface{}) interface{}) *Node {
 	return target.cloneNode(sourceNode.GetGraph(), sourceNode, clonePropertyFunc)
 }
 
-// CopyEdge copies the edge into graph
+// CopyEdge copies the edge into graph. Panics with
+// ErrDuplicateExternalID if the external ID of the edge is already
+// used in the target graph.
 func CopyEdge(edge *Edge, target *Graph, clonePropertyFunc func(string, interface{}) interface{}, nodeMap map[*Node]*Node) *Edge {
 	return target.cloneEdge(nodeMap[edge.GetFrom()], nodeMap[edge.GetTo()], edge, clonePropertyFunc)
 }
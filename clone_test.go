@@ -54,11 +54,11 @@ func TestClone(t *testing.T) {
 	})
 
 	if ok, _ := CheckIsomorphism(context.Background(), source, target, func(n1, n2 *Node) bool {
-		result := n1.GetLabels().HasAll(n2.GetLabels().Slice()...) && reflect.DeepEqual(n1.properties, n2.properties)
+		result := n1.GetLabels().HasAll(n2.GetLabels().Slice()...) && reflect.DeepEqual(n1.properties.load(), n2.properties.load())
 		return result
 	},
 		func(e1, e2 *Edge) bool {
-			result := e1.label == e2.label && reflect.DeepEqual(e1.properties, e2.properties)
+			result := e1.label == e2.label && reflect.DeepEqual(e1.properties.load(), e2.properties.load())
 			return result
 		}); !ok {
 		t.Errorf("Clone result not isomorphic")
@@ -0,0 +1,447 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrIncomparable is returned when two property values cannot be
+// compared
+type ErrIncomparable struct {
+	A, B interface{}
+}
+
+func (e ErrIncomparable) Error() string {
+	return fmt.Sprintf("Incomparable values: %v (%T) vs %v (%T)", e.A, e.A, e.B, e.B)
+}
+
+// Type ranks for ordering values of different types. The order
+// follows openCypher: maps, nodes, edges, lists, custom types,
+// temporal values, durations, strings, booleans, numbers, NaN, and
+// null.
+const (
+	rankMap = iota
+	rankNode
+	rankEdge
+	rankList
+	rankCustom
+	rankDateTime
+	rankDate
+	rankDuration
+	rankString
+	rankBool
+	rankNumber
+	rankNaN
+	rankNull
+)
+
+// A PropertyComparator compares two values of the same type. It
+// returns -1 if a<b, 0 if a==b, and 1 if a>b.
+type PropertyComparator func(a, b interface{}) (int, error)
+
+var comparatorRegistry = struct {
+	sync.RWMutex
+	m map[reflect.Type]PropertyComparator
+}{m: make(map[reflect.Type]PropertyComparator)}
+
+// RegisterPropertyComparator registers a comparator for the type of
+// sample. The comparator is used to compare two values of that
+// type. Values of registered types are ordered after lists and before
+// temporal values, and values of different registered types are
+// ordered by their type names.
+func RegisterPropertyComparator(sample interface{}, cmp PropertyComparator) {
+	comparatorRegistry.Lock()
+	defer comparatorRegistry.Unlock()
+	comparatorRegistry.m[reflect.TypeOf(sample)] = cmp
+}
+
+func getPropertyComparator(t reflect.Type) PropertyComparator {
+	comparatorRegistry.RLock()
+	defer comparatorRegistry.RUnlock()
+	return comparatorRegistry.m[t]
+}
+
+// numeric is a number normalized for comparison
+type numeric struct {
+	kind int
+	i    int64
+	u    uint64
+	f    float64
+}
+
+const (
+	numInt = iota
+	numUint
+	numFloat
+)
+
+// valueRank returns the type rank of the value. The second return
+// value is true if the value is of a known type.
+func valueRank(v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case nil:
+		return rankNull, true
+	case string:
+		return rankString, true
+	case bool:
+		return rankBool, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return rankNumber, true
+	case float32:
+		if math.IsNaN(float64(t)) {
+			return rankNaN, true
+		}
+		return rankNumber, true
+	case float64:
+		if math.IsNaN(t) {
+			return rankNaN, true
+		}
+		return rankNumber, true
+	case time.Time:
+		return rankDateTime, true
+	case Date:
+		return rankDate, true
+	case Duration:
+		return rankDuration, true
+	case *Node:
+		return rankNode, true
+	case *Edge:
+		return rankEdge, true
+	}
+	if getPropertyComparator(reflect.TypeOf(v)) != nil {
+		return rankCustom, true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rankList, true
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			return rankMap, true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rankNumber, true
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(rv.Float()) {
+			return rankNaN, true
+		}
+		return rankNumber, true
+	case reflect.String:
+		return rankString, true
+	case reflect.Bool:
+		return rankBool, true
+	}
+	return 0, false
+}
+
+func toNumeric(v interface{}) numeric {
+	switch t := v.(type) {
+	case int:
+		return numeric{kind: numInt, i: int64(t)}
+	case int8:
+		return numeric{kind: numInt, i: int64(t)}
+	case int16:
+		return numeric{kind: numInt, i: int64(t)}
+	case int32:
+		return numeric{kind: numInt, i: int64(t)}
+	case int64:
+		return numeric{kind: numInt, i: t}
+	case uint:
+		return numeric{kind: numUint, u: uint64(t)}
+	case uint8:
+		return numeric{kind: numUint, u: uint64(t)}
+	case uint16:
+		return numeric{kind: numUint, u: uint64(t)}
+	case uint32:
+		return numeric{kind: numUint, u: uint64(t)}
+	case uint64:
+		return numeric{kind: numUint, u: t}
+	case float32:
+		return numeric{kind: numFloat, f: float64(t)}
+	case float64:
+		return numeric{kind: numFloat, f: t}
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return numeric{kind: numInt, i: rv.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return numeric{kind: numUint, u: rv.Uint()}
+	}
+	return numeric{kind: numFloat, f: rv.Float()}
+}
+
+func cmpInt(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func cmpUint(a, b uint64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func cmpString(a, b string) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+const (
+	two63 = 9223372036854775808.0
+	two64 = 18446744073709551616.0
+)
+
+// compareIntFloat compares an integer and a float exactly
+func compareIntFloat(i int64, f float64) int {
+	if f >= two63 {
+		return -1
+	}
+	if f < -two63 {
+		return 1
+	}
+	t := int64(f)
+	if c := cmpInt(i, t); c != 0 {
+		return c
+	}
+	// f-t is exact, since t is f truncated
+	return cmpFloat(0, f-float64(t))
+}
+
+func compareUintFloat(u uint64, f float64) int {
+	if f < 0 {
+		return 1
+	}
+	if f >= two64 {
+		return -1
+	}
+	t := uint64(f)
+	if c := cmpUint(u, t); c != 0 {
+		return c
+	}
+	return cmpFloat(0, f-float64(t))
+}
+
+func compareNumeric(a, b numeric) int {
+	switch a.kind {
+	case numInt:
+		switch b.kind {
+		case numInt:
+			return cmpInt(a.i, b.i)
+		case numUint:
+			if a.i < 0 {
+				return -1
+			}
+			return cmpUint(uint64(a.i), b.u)
+		}
+		return compareIntFloat(a.i, b.f)
+	case numUint:
+		switch b.kind {
+		case numInt:
+			return -compareNumeric(b, a)
+		case numUint:
+			return cmpUint(a.u, b.u)
+		}
+		return compareUintFloat(a.u, b.f)
+	}
+	if b.kind != numFloat {
+		return -compareNumeric(b, a)
+	}
+	return cmpFloat(a.f, b.f)
+}
+
+// ComparePropertyValueE compares a and b, and returns -1 if a<b, 0 if
+// a==b, and 1 if a>b. Values are ordered as in openCypher: values of
+// different types are ordered by type as
+//
+//	maps < nodes < edges < lists < custom types < time.Time < Date < Duration < strings < booleans < numbers < NaN < nil
+//
+// All integer and floating point types are numbers, and numbers of
+// different types are compared by value, so 1 == int64(1) == 1.0.
+// Lists (slices and arrays) are compared element by element, and maps
+// with string keys are compared by their sorted keys, and then by
+// their values. Nodes and edges are compared by ID. false < true.
+//
+// If a value implements WithNativeValue, its native value is
+// compared. Values of custom types can be compared using a comparator
+// registered with RegisterPropertyComparator. Returns ErrIncomparable
+// if a value is of an unknown type.
+func ComparePropertyValueE(a, b interface{}) (int, error) {
+	if n, ok := a.(WithNativeValue); ok {
+		a = n.GetNativeValue()
+	}
+	if n, ok := b.(WithNativeValue); ok {
+		b = n.GetNativeValue()
+	}
+
+	// Fast paths
+	switch v1 := a.(type) {
+	case string:
+		if v2, ok := b.(string); ok {
+			return cmpString(v1, v2), nil
+		}
+	case int:
+		if v2, ok := b.(int); ok {
+			return cmpInt(int64(v1), int64(v2)), nil
+		}
+	case float64:
+		if v2, ok := b.(float64); ok && !math.IsNaN(v1) && !math.IsNaN(v2) {
+			return cmpFloat(v1, v2), nil
+		}
+	}
+
+	rankA, okA := valueRank(a)
+	rankB, okB := valueRank(b)
+	if !okA || !okB {
+		return 0, ErrIncomparable{A: a, B: b}
+	}
+	if rankA != rankB {
+		return cmpInt(int64(rankA), int64(rankB)), nil
+	}
+	switch rankA {
+	case rankNull, rankNaN:
+		return 0, nil
+	case rankNumber:
+		return compareNumeric(toNumeric(a), toNumeric(b)), nil
+	case rankString:
+		return cmpString(reflect.ValueOf(a).String(), reflect.ValueOf(b).String()), nil
+	case rankBool:
+		v1, v2 := reflect.ValueOf(a).Bool(), reflect.ValueOf(b).Bool()
+		if v1 == v2 {
+			return 0, nil
+		}
+		if !v1 {
+			return -1, nil
+		}
+		return 1, nil
+	case rankDateTime:
+		t1, t2 := a.(time.Time), b.(time.Time)
+		if t1.Before(t2) {
+			return -1, nil
+		}
+		if t1.After(t2) {
+			return 1, nil
+		}
+		return 0, nil
+	case rankDate:
+		return compareDates(a.(Date), b.(Date)), nil
+	case rankDuration:
+		return compareDurations(a.(Duration), b.(Duration)), nil
+	case rankNode:
+		return cmpInt(int64(a.(*Node).id), int64(b.(*Node).id)), nil
+	case rankEdge:
+		return cmpInt(int64(a.(*Edge).id), int64(b.(*Edge).id)), nil
+	case rankList:
+		return compareLists(reflect.ValueOf(a), reflect.ValueOf(b))
+	case rankMap:
+		return compareMaps(reflect.ValueOf(a), reflect.ValueOf(b))
+	case rankCustom:
+		ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+		if ta != tb {
+			return cmpString(ta.String(), tb.String()), nil
+		}
+		return getPropertyComparator(ta)(a, b)
+	}
+	return 0, ErrIncomparable{A: a, B: b}
+}
+
+func compareLists(a, b reflect.Value) (int, error) {
+	l1, l2 := a.Len(), b.Len()
+	for i := 0; i < l1 && i < l2; i++ {
+		c, err := ComparePropertyValueE(a.Index(i).Interface(), b.Index(i).Interface())
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+	return cmpInt(int64(l1), int64(l2)), nil
+}
+
+func sortedMapKeys(m reflect.Value) []string {
+	keys := make([]string, 0, m.Len())
+	for _, k := range m.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func compareMaps(a, b reflect.Value) (int, error) {
+	k1, k2 := sortedMapKeys(a), sortedMapKeys(b)
+	for i := 0; i < len(k1) && i < len(k2); i++ {
+		if c := cmpString(k1[i], k2[i]); c != 0 {
+			return c, nil
+		}
+	}
+	if c := cmpInt(int64(len(k1)), int64(len(k2))); c != 0 {
+		return c, nil
+	}
+	keyType := a.Type().Key()
+	for _, k := range k1 {
+		c, err := ComparePropertyValueE(a.MapIndex(reflect.ValueOf(k).Convert(keyType)).Interface(),
+			b.MapIndex(reflect.ValueOf(k).Convert(b.Type().Key())).Interface())
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+// ComparePropertyValue compares a and b, and returns -1 if a<b, 0 if
+// a==b, and 1 if a>b. See ComparePropertyValueE for the ordering of
+// values. Panics with ErrIncomparable if a value is of an unknown
+// type.
+func ComparePropertyValue(a, b interface{}) int {
+	c, err := ComparePropertyValueE(a, b)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type caseInsensitive string
+
+func TestComparePropertyValue(t *testing.T) {
+	RegisterPropertyComparator(caseInsensitive(""), func(a, b interface{}) (int, error) {
+		return cmpString(strings.ToLower(string(a.(caseInsensitive))), strings.ToLower(string(b.(caseInsensitive)))), nil
+	})
+	t1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		a, b     interface{}
+		expected int
+	}{
+		{1, 2, -1},
+		{1, int64(1), 0},
+		{uint64(math.MaxUint64), int64(-1), 1},
+		{1, 1.0, 0},
+		{1, 1.5, -1},
+		{int64(math.MaxInt64), float64(math.MaxInt64), -1},
+		{uint8(3), float32(2.5), 1},
+		{math.NaN(), 1e300, 1},
+		{math.NaN(), math.NaN(), 0},
+		{nil, math.NaN(), 1},
+		{true, false, 1},
+		{true, 1, -1},
+		{"a", true, -1},
+		{"b", "a", 1},
+		{t1, t1.Add(time.Second), -1},
+		{t1, t1.In(time.FixedZone("x", 3600)), 0},
+		{t1, "a", -1},
+		{t1, NewDate(2020, 1, 1), -1},
+		{NewDate(2021, 1, 2), NewDate(2021, 2, 1), -1},
+		{NewDate(2021, 1, 2), Duration{}, -1},
+		{Duration{Months: 1}, Duration{Days: 30}, 1},
+		{Duration{Days: 1}, DurationOf(24 * time.Hour), 1},
+		{Duration{Nanos: 1}, "a", -1},
+		{[]int{1, 2}, []interface{}{1, 2.0}, 0},
+		{[]string{"a"}, []string{"a", "b"}, -1},
+		{[]int{1}, t1, -1},
+		{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}, -1},
+		{map[string]interface{}{"a": 1}, map[string]int{"b": 0}, -1},
+		{map[string]interface{}{"a": 1}, []int{1}, -1},
+		{caseInsensitive("A"), caseInsensitive("a"), 0},
+		{caseInsensitive("b"), t1, -1},
+	} {
+		c, err := ComparePropertyValueE(tc.a, tc.b)
+		if err != nil {
+			t.Errorf("%v %v: %v", tc.a, tc.b, err)
+			continue
+		}
+		if c != tc.expected {
+			t.Errorf("%v (%T) %v (%T): expected %d got %d", tc.a, tc.a, tc.b, tc.b, tc.expected, c)
+		}
+		if r := ComparePropertyValue(tc.b, tc.a); r != -tc.expected {
+			t.Errorf("%v %v: not antisymmetric", tc.b, tc.a)
+		}
+	}
+	if _, err := ComparePropertyValueE(struct{}{}, 1); err == nil {
+		t.Errorf("Expecting error")
+	}
+}
+
+func TestMixedNumericIndex(t *testing.T) {
+	t1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, ix := range []IndexType{HashIndex, BtreeIndex} {
+		g := NewGraph()
+		g.AddNodePropertyIndex("key", ix)
+		g.NewNode(nil, map[string]interface{}{"key": 1})
+		g.NewNode(nil, map[string]interface{}{"key": 2.5})
+		g.NewNode(nil, map[string]interface{}{"key": true})
+		g.NewNode(nil, map[string]interface{}{"key": t1})
+		for _, v := range []interface{}{1.0, int64(1), uint8(1), 2.5, true, t1.In(time.Local)} {
+			if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": v}))); n != 1 {
+				t.Errorf("Index %v: %v: expected 1 got %d", ix, v, n)
+			}
+		}
+	}
+}
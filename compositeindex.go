@@ -0,0 +1,369 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+)
+
+// ErrIndexScan is returned when an index scan is not possible, for
+// instance because there is no index for the keys, or the index is a
+// hash index and the scan is a range scan
+type ErrIndexScan struct {
+	Keys []string
+	Msg  string
+}
+
+func (e ErrIndexScan) Error() string {
+	return fmt.Sprintf("Index scan on %v: %s", e.Keys, e.Msg)
+}
+
+// A compositeIndex indexes an ordered list of property keys. A node
+// or edge is in the index if it has all the properties. A hash index
+// is keyed by the encoded values, and a btree index is keyed by the
+// list of values, so it is ordered by the first key, then the second
+// key, etc.
+type compositeIndex struct {
+	keys []string
+	typ  IndexType
+	ix   index
+}
+
+func newCompositeIndex(keys []string, typ IndexType) *compositeIndex {
+	return &compositeIndex{
+		keys: append([]string{}, keys...),
+		typ:  typ,
+		ix:   newIndex(typ),
+	}
+}
+
+func (c *compositeIndex) hasKey(key string) bool {
+	for _, k := range c.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compositeIndex) sameKeys(keys []string) bool {
+	if len(keys) != len(c.keys) {
+		return false
+	}
+	for i := range keys {
+		if keys[i] != c.keys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexKey returns the index key for the values of the composite keys
+func (c *compositeIndex) indexKey(values []interface{}) interface{} {
+	if c.typ == HashIndex {
+		return encodeKey(values...)
+	}
+	return values
+}
+
+// values returns the values of the composite keys. Returns false if
+// one of the properties is missing.
+func (c *compositeIndex) values(p *properties) ([]interface{}, bool) {
+	ret := make([]interface{}, len(c.keys))
+	for i, k := range c.keys {
+		v, ok := p.getProperty(k)
+		if !ok {
+			return nil, false
+		}
+		ret[i] = v
+	}
+	return ret, true
+}
+
+func (c *compositeIndex) add(p *properties, id int, item interface{}) {
+	if values, ok := c.values(p); ok {
+		c.ix.add(c.indexKey(values), id, item)
+	}
+}
+
+func (c *compositeIndex) remove(p *properties, id int) {
+	if values, ok := c.values(p); ok {
+		c.ix.remove(c.indexKey(values), id)
+	}
+}
+
+// prefixLen returns the number of leading keys of the index that are
+// in the properties
+func (c *compositeIndex) prefixLen(props map[string]interface{}) int {
+	for i, k := range c.keys {
+		if _, ok := props[k]; !ok {
+			return i
+		}
+	}
+	return len(c.keys)
+}
+
+// CompositeRange selects the entries of a composite index. The first
+// len(Prefix) values of an entry must be equal to Prefix. If Min or
+// Max is not nil, the value of the next key must be greater than or
+// equal to Min, and less than or equal to Max. ExcludeMin and
+// ExcludeMax make the bounds exclusive.
+type CompositeRange struct {
+	Prefix     []interface{}
+	Min        interface{}
+	Max        interface{}
+	ExcludeMin bool
+	ExcludeMax bool
+}
+
+// comparePrefix compares the first len(prefix) values of key with
+// prefix
+func comparePrefix(key interface{}, prefix []interface{}) int {
+	values := key.([]interface{})
+	for i := range prefix {
+		if c := ComparePropertyValue(values[i], prefix[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// scan returns the items in the range
+func (c *compositeIndex) scan(r CompositeRange) (Iterator, error) {
+	n := len(r.Prefix)
+	if n > len(c.keys) || (n == len(c.keys) && (r.Min != nil || r.Max != nil)) {
+		return nil, ErrIndexScan{Keys: c.keys, Msg: "Too many values"}
+	}
+	if c.typ == HashIndex {
+		if n != len(c.keys) {
+			return nil, ErrIndexScan{Keys: c.keys, Msg: "Hash index requires all values"}
+		}
+		return c.ix.find(c.indexKey(r.Prefix)), nil
+	}
+	lo := r.Prefix
+	if r.Min != nil {
+		lo = append(append([]interface{}{}, r.Prefix...), r.Min)
+	}
+	hi := r.Prefix
+	if r.Max != nil {
+		hi = append(append([]interface{}{}, r.Prefix...), r.Max)
+	}
+	return c.ix.(*setTree).rangeItr(
+		func(key interface{}) bool {
+			c := comparePrefix(key, lo)
+			return c < 0 || (c == 0 && r.Min != nil && r.ExcludeMin)
+		},
+		func(key interface{}) bool {
+			c := comparePrefix(key, hi)
+			return c > 0 || (c == 0 && r.Max != nil && r.ExcludeMax)
+		}), nil
+}
+
+// findComposite returns an iterator for the properties using the composite
+// index that covers the most properties, or nil if there is no such
+// index. A hash index can only be used if all its keys are in the
+// properties. A btree index can be used if its first key is in the
+// properties.
+func findComposite(composites []*compositeIndex, props map[string]interface{}) Iterator {
+	var best *compositeIndex
+	bestLen := 0
+	for _, c := range composites {
+		n := c.prefixLen(props)
+		if n == 0 || (c.typ == HashIndex && n < len(c.keys)) {
+			continue
+		}
+		// Prefer hash indexes for the same number of keys
+		if n > bestLen || (n == bestLen && c.typ == HashIndex) {
+			best = c
+			bestLen = n
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	prefix := make([]interface{}, bestLen)
+	for i := range prefix {
+		prefix[i] = props[best.keys[i]]
+	}
+	itr, err := best.scan(CompositeRange{Prefix: prefix})
+	if err != nil {
+		return nil
+	}
+	return itr
+}
+
+// GetIteratorForNodeComposite returns an iterator for the nodes that
+// may have the given property values using a composite index, or nil
+// if there is no suitable composite index
+func (g *graphIndex) GetIteratorForNodeComposite(props map[string]interface{}) NodeIterator {
+	if len(g.nodeComposites) == 0 {
+		return nil
+	}
+	itr := findComposite(g.nodeComposites, props)
+	if itr == nil {
+		return nil
+	}
+	return nodeIterator{itr}
+}
+
+// GetIteratorForEdgeComposite returns an iterator for the edges that
+// may have the given property values using a composite index, or nil
+// if there is no suitable composite index
+func (g *graphIndex) GetIteratorForEdgeComposite(props map[string]interface{}) EdgeIterator {
+	if len(g.edgeComposites) == 0 {
+		return nil
+	}
+	itr := findComposite(g.edgeComposites, props)
+	if itr == nil {
+		return nil
+	}
+	return edgeIterator{itr}
+}
+
+// NodeCompositeIndex sets up a composite index for the given node
+// property keys
+func (g *graphIndex) NodeCompositeIndex(keys []string, graph *Graph, it IndexType) {
+	for _, c := range g.nodeComposites {
+		if c.typ == it && c.sameKeys(keys) {
+			return
+		}
+	}
+	c := newCompositeIndex(keys, it)
+	g.nodeComposites = append(g.nodeComposites, c)
+	for nodes := graph.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		c.add(&node.properties, node.id, node)
+	}
+}
+
+// EdgeCompositeIndex sets up a composite index for the given edge
+// property keys
+func (g *graphIndex) EdgeCompositeIndex(keys []string, graph *Graph, it IndexType) {
+	for _, c := range g.edgeComposites {
+		if c.typ == it && c.sameKeys(keys) {
+			return
+		}
+	}
+	c := newCompositeIndex(keys, it)
+	g.edgeComposites = append(g.edgeComposites, c)
+	for edges := graph.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		c.add(&edge.properties, edge.id, edge)
+	}
+}
+
+// removeNodeComposites removes the node from the composite indexes
+// that include key. This is called before the property changes, and
+// addNodeComposites is called after.
+func (g *graphIndex) removeNodeComposites(node *Node, key string) {
+	for _, c := range g.nodeComposites {
+		if c.hasKey(key) {
+			c.remove(&node.properties, node.id)
+		}
+	}
+}
+
+func (g *graphIndex) addNodeComposites(node *Node, key string) {
+	for _, c := range g.nodeComposites {
+		if c.hasKey(key) {
+			c.add(&node.properties, node.id, node)
+		}
+	}
+}
+
+func (g *graphIndex) removeEdgeComposites(edge *Edge, key string) {
+	for _, c := range g.edgeComposites {
+		if c.hasKey(key) {
+			c.remove(&edge.properties, edge.id)
+		}
+	}
+}
+
+func (g *graphIndex) addEdgeComposites(edge *Edge, key string) {
+	for _, c := range g.edgeComposites {
+		if c.hasKey(key) {
+			c.add(&edge.properties, edge.id, edge)
+		}
+	}
+}
+
+// AddNodeCompositeIndex adds a composite index over the ordered list
+// of node property keys. A node is indexed if it has all the
+// properties. FindNodes and pattern searches use composite indexes
+// when the properties include all the keys of a hash index, or the
+// leading keys of a btree index. Btree composite indexes also support
+// prefix and range scans using ScanNodeCompositeIndex. Other index
+// types panic with ErrUnsupportedIndexType.
+func (g *Graph) AddNodeCompositeIndex(keys []string, ix IndexType) {
+	checkIndexType(ix)
+	g.indexesChanged()
+	g.index.NodeCompositeIndex(keys, g, ix)
+}
+
+// AddEdgeCompositeIndex adds a composite index over the ordered list
+// of edge property keys.
+func (g *Graph) AddEdgeCompositeIndex(keys []string, ix IndexType) {
+	checkIndexType(ix)
+	g.indexesChanged()
+	g.index.EdgeCompositeIndex(keys, g, ix)
+}
+
+func selectComposite(composites []*compositeIndex, keys []string, r CompositeRange) *compositeIndex {
+	var ret *compositeIndex
+	for _, c := range composites {
+		if !c.sameKeys(keys) {
+			continue
+		}
+		// Use the hash index for equality lookups on all keys
+		if ret == nil || (c.typ == HashIndex && len(r.Prefix) == len(keys)) {
+			ret = c
+		} else if c.typ == BtreeIndex && ret.typ == HashIndex && len(r.Prefix) < len(keys) {
+			ret = c
+		}
+	}
+	return ret
+}
+
+// ScanNodeCompositeIndex returns the nodes in the range of the
+// composite index with the given keys. A hash index can only be used
+// to look up all the keys. Returns ErrIndexScan if there is no
+// suitable index.
+func (g *Graph) ScanNodeCompositeIndex(keys []string, r CompositeRange) (NodeIterator, error) {
+	c := selectComposite(g.index.nodeComposites, keys, r)
+	if c == nil {
+		return nil, ErrIndexScan{Keys: keys, Msg: "No index"}
+	}
+	itr, err := c.scan(r)
+	if err != nil {
+		return nil, err
+	}
+	return nodeIterator{itr}, nil
+}
+
+// ScanEdgeCompositeIndex returns the edges in the range of the
+// composite index with the given keys. A hash index can only be used
+// to look up all the keys. Returns ErrIndexScan if there is no
+// suitable index.
+func (g *Graph) ScanEdgeCompositeIndex(keys []string, r CompositeRange) (EdgeIterator, error) {
+	c := selectComposite(g.index.edgeComposites, keys, r)
+	if c == nil {
+		return nil, ErrIndexScan{Keys: keys, Msg: "No index"}
+	}
+	itr, err := c.scan(r)
+	if err != nil {
+		return nil, err
+	}
+	return edgeIterator{itr}, nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentGraph wraps a graph to make it safe for concurrent
+// use. Writers get exclusive access to the graph, and readers do not
+// wait for writers.
+//
+// Readers use a read-only replica of the graph. There are two
+// replicas, and one of them is published for the readers. When a
+// writer commits, the committed changes are applied to the other
+// replica, which is then published. So, a reader sees the graph as of
+// the last completed write, and writers and readers run at the same
+// time. A writer waits only for the readers that are still using the
+// replica published before the last write. The replicas have the
+// nodes, edges, indexes, and constraints of the graph. Other features
+// of the graph, such as versioning, are only available to writers.
+//
+// The replicas share the property maps with the graph until they are
+// modified, but they have their own nodes, edges, and indexes, so a
+// concurrent graph uses about three times the memory of the graph for
+// those. Snapshot hands out the published replica itself, which is
+// not modified after that; the writer copies a new replica from the
+// graph in its place.
+//
+// The graph, its nodes, edges, and iterators must only be used within
+// the Read and Write callbacks. Iterators must not be retained after
+// the callback returns.
+type ConcurrentGraph struct {
+	// Serializes the writers
+	mu sync.Mutex
+	g  *Graph
+
+	replicas [2]*graphReplica
+	// The index of the published replica in replicas
+	current int
+	// published is the *graphReplica used by the readers
+	published atomic.Value
+	// The committed events of the last write, not yet applied to the
+	// unpublished replica
+	pending []GraphEvent
+	// The events of the active write
+	events []GraphEvent
+}
+
+// graphReplica is a read-only copy of the graph. Readers hold the
+// read lock, and the writer holds the write lock while it applies
+// changes.
+type graphReplica struct {
+	mu           sync.RWMutex
+	g            *Graph
+	indexVersion int
+	// Set if g is returned by Snapshot, so it must not be modified
+	taken atomic.Bool
+}
+
+// NewConcurrentGraph returns a concurrent graph wrapping g. If g is
+// nil, a new graph is created. After this call g should only be
+// accessed through the returned concurrent graph.
+func NewConcurrentGraph(g *Graph) *ConcurrentGraph {
+	if g == nil {
+		g = NewGraph()
+	}
+	c := &ConcurrentGraph{g: g}
+	for i := range c.replicas {
+		c.replicas[i] = &graphReplica{}
+		c.replicas[i].reset(g)
+	}
+	c.published.Store(c.replicas[0])
+	g.Observe(func(e GraphEvent) {
+		c.events = append(c.events, e)
+	})
+	return c
+}
+
+// Read calls f with a read-only replica of the graph. Multiple
+// readers may run concurrently, and they do not wait for the
+// writers. f sees the graph as of the last completed Write. Modifying
+// the graph in f panics with ErrReadOnlyGraph.
+func (c *ConcurrentGraph) Read(f func(*Graph) error) error {
+	r := c.published.Load().(*graphReplica)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return f(r.g)
+}
+
+// Write calls f with the graph. While f runs, there are no other
+// writers. f runs in a transaction: if f returns an error or panics,
+// all changes made by f are rolled back. A panic is returned as an
+// error. When the transaction commits, the changes are published to
+// the readers before Write returns. If the changes cannot be applied
+// to the replica of the readers, the replica is copied from the graph
+// again, and Write returns the error even though the transaction is
+// committed.
+func (c *ConcurrentGraph) Write(f func(*Graph) error) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = nil
+	tx := c.g.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+		if err != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				err = rerr
+			}
+		} else {
+			err = tx.Commit()
+		}
+		if err == nil {
+			err = c.publish(c.events)
+		}
+		c.events = nil
+	}()
+	return f(c.g)
+}
+
+// publish applies the committed events to the unpublished replica,
+// and publishes it. If the events cannot be applied, the replica is
+// copied from the graph again, and the error is returned.
+func (c *ConcurrentGraph) publish(events []GraphEvent) error {
+	next := 1 - c.current
+	r := c.replicas[next]
+	// Wait for the readers that started before the last write
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	if r.taken.Load() {
+		// The snapshot keeps the replica
+		r.reset(c.g)
+	} else if err = r.update(c.g, c.pending, events); err != nil {
+		r.reset(c.g)
+	}
+	c.published.Store(r)
+	c.current = next
+	c.pending = events
+	return err
+}
+
+// update applies the event batches to the replica, and copies the
+// indexes and constraints of g
+func (r *graphReplica) update(g *Graph, batches ...[]GraphEvent) error {
+	r.g.readOnly = false
+	defer func() { r.g.readOnly = true }()
+	// The changes are validated by the graph
+	r.g.constraints = nil
+	for _, batch := range batches {
+		for _, e := range batch {
+			if err := r.g.ApplyEvent(e); err != nil {
+				return err
+			}
+		}
+	}
+	if r.indexVersion != g.indexVersion {
+		for _, entry := range r.g.index.catalog() {
+			entry.drop()
+		}
+		g.index.copyIndexes(r.g)
+		r.indexVersion = g.indexVersion
+	}
+	r.g.constraints = append([]Constraint(nil), g.constraints...)
+	r.g.idBase = g.idBase
+	return nil
+}
+
+// reset copies the replica from g
+func (r *graphReplica) reset(g *Graph) {
+	// Not g.Snapshot, because the replica is modified, and the shared
+	// snapshot of g must not be
+	r.g = g.snapshot()
+	r.taken.Store(false)
+	r.g.constraints = append([]Constraint(nil), g.constraints...)
+	r.indexVersion = g.indexVersion
+}
+
+// Snapshot returns a read-only snapshot of the graph as of the last
+// completed write. The snapshot can be used without locking, while
+// the graph is being modified. Like Read, Snapshot does not wait for
+// the writers.
+//
+// Snapshot is O(1): the snapshot is the published replica, shared
+// with the readers and with the other snapshots taken before the next
+// write. The replica is not modified after that, and the next write
+// that would modify it copies a new replica from the graph instead.
+func (c *ConcurrentGraph) Snapshot() *Graph {
+	r := c.published.Load().(*graphReplica)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.taken.Store(true)
+	return r.g
+}
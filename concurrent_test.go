@@ -0,0 +1,170 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentGraph(t *testing.T) {
+	cg := NewConcurrentGraph(nil)
+	cg.Write(func(g *Graph) error {
+		g.AddNodePropertyIndex("key", BtreeIndex)
+		return nil
+	})
+	wg := sync.WaitGroup{}
+	// Writers add chains of two nodes. Readers check that they never
+	// see a node without its edge.
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				cg.Write(func(g *Graph) error {
+					n1 := g.NewNode([]string{"a"}, map[string]interface{}{"key": w*100 + i})
+					n2 := g.NewNode([]string{"b"}, nil)
+					g.NewEdge(n1, n2, "e", nil)
+					return nil
+				})
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				cg.Read(func(g *Graph) error {
+					if g.NumNodes() != 2*g.NumEdges() {
+						t.Error("Torn read")
+					}
+					pat := Pattern{{Labels: NewStringSet("a")}, {Min: 1, Max: 1}, {Labels: NewStringSet("b")}}
+					acc, err := pat.FindPaths(g, map[string]*PatternSymbol{})
+					if err != nil {
+						t.Error(err)
+					}
+					if len(acc.Paths) != g.NumEdges() {
+						t.Error("Wrong number of paths")
+					}
+					for nodes := g.FindNodes(NewStringSet("a"), map[string]interface{}{"key": 1}); nodes.Next(); {
+					}
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Failed writes are rolled back
+	err := cg.Write(func(g *Graph) error {
+		g.NewNode(nil, nil)
+		panic("fail")
+	})
+	if err == nil {
+		t.Errorf("Expecting error")
+	}
+	cg.Read(func(g *Graph) error {
+		if g.NumNodes() != 400 {
+			t.Errorf("Wrong number of nodes: %d", g.NumNodes())
+		}
+		return nil
+	})
+}
+
+func TestConcurrentReadDuringWrite(t *testing.T) {
+	cg := NewConcurrentGraph(nil)
+	cg.Write(func(g *Graph) error {
+		g.NewNode([]string{"a"}, map[string]interface{}{"key": 1})
+		return nil
+	})
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cg.Write(func(g *Graph) error {
+			g.AddNodePropertyIndex("key", HashIndex)
+			g.NewNode([]string{"a"}, map[string]interface{}{"key": 2})
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+	// The reader does not wait for the writer, and does not see the
+	// uncommitted changes
+	cg.Read(func(g *Graph) error {
+		if g.NumNodes() != 1 || g.index.isNodePropertyIndexed("key") != nil {
+			t.Errorf("Uncommitted changes visible")
+		}
+		return nil
+	})
+	if snap := cg.Snapshot(); snap.NumNodes() != 1 {
+		t.Errorf("Wrong snapshot")
+	}
+	close(finish)
+	<-done
+	for i := 0; i < 2; i++ {
+		cg.Read(func(g *Graph) error {
+			if g.NumNodes() != 2 || g.index.isNodePropertyIndexed("key") == nil {
+				t.Errorf("Committed changes not visible")
+			}
+			if len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 2}))) != 1 {
+				t.Errorf("Cannot find node")
+			}
+			func() {
+				defer func() {
+					if _, ok := recover().(ErrReadOnlyGraph); !ok {
+						t.Errorf("Expecting read-only graph")
+					}
+				}()
+				g.NewNode(nil, nil)
+			}()
+			return nil
+		})
+		// The next write updates the other replica
+		cg.Write(func(g *Graph) error { return nil })
+	}
+}
+
+func TestConcurrentGraphPublishError(t *testing.T) {
+	cg := NewConcurrentGraph(nil)
+	cg.Write(func(g *Graph) error {
+		g.NewNode([]string{"a"}, nil)
+		return nil
+	})
+	// An event that cannot be applied to the replica
+	cg.pending = append(cg.pending, GraphEvent{Type: NodeRemovedEvent, NodeID: 100})
+	err := cg.Write(func(g *Graph) error {
+		g.NewNode([]string{"b"}, nil)
+		return nil
+	})
+	if _, ok := err.(ErrInvalidEvent); !ok {
+		t.Errorf("Expecting invalid event error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		// The replica is copied again, and it is not left locked
+		cg.Read(func(g *Graph) error {
+			if g.NumNodes() != 2 {
+				t.Errorf("Wrong replica: %d", g.NumNodes())
+			}
+			return nil
+		})
+		if err := cg.Write(func(g *Graph) error { return nil }); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Constraint is a schema rule for the nodes and edges of a graph.
+//
+// Constraints are registered using Graph.AddConstraint. Once a
+// constraint is registered, the nodes and edges modified in a
+// transaction are validated when the transaction is committed. If
+// there is a violation, the transaction is rolled back and Commit
+// returns the error. Modifications made outside a transaction are not
+// validated, so a graph built without a transaction, for example by an
+// importer, can be checked using Graph.ValidateConstraints.
+type Constraint interface {
+	// ValidateNode returns an error if the node violates the
+	// constraint
+	ValidateNode(*Node) error
+	// ValidateEdge returns an error if the edge violates the
+	// constraint
+	ValidateEdge(*Edge) error
+}
+
+// ErrUniqueConstraint is returned when two nodes with the same label
+// have the same value for a unique property
+type ErrUniqueConstraint struct {
+	// ID of the node
+	ID       int
+	Label    string
+	Property string
+	Value    interface{}
+}
+
+func (e ErrUniqueConstraint) Error() string {
+	return fmt.Sprintf("Unique constraint violation: :%s.%s=%v", e.Label, e.Property, e.Value)
+}
+
+// ErrRequiredProperty is returned when a node or edge does not have a
+// required property
+type ErrRequiredProperty struct {
+	// ID of the node or edge
+	ID       int
+	Label    string
+	Property string
+}
+
+func (e ErrRequiredProperty) Error() string {
+	return fmt.Sprintf("Required property missing: :%s.%s", e.Label, e.Property)
+}
+
+// ErrEdgeEndpoint is returned when an edge connects nodes that are
+// not allowed by an edge endpoint constraint
+type ErrEdgeEndpoint struct {
+	// ID of the edge
+	ID         int
+	Label      string
+	FromLabels []string
+	ToLabels   []string
+}
+
+func (e ErrEdgeEndpoint) Error() string {
+	return fmt.Sprintf("Edge endpoint violation: (:%s)-[:%s]->(:%s)", strings.Join(e.FromLabels, ":"), e.Label, strings.Join(e.ToLabels, ":"))
+}
+
+// UniqueConstraint requires that no two nodes with the label have the
+// same value for the property. Adding this constraint to a graph adds
+// a hash index for the property if the property is not indexed.
+type UniqueConstraint struct {
+	Label    string
+	Property string
+}
+
+func (c UniqueConstraint) ValidateNode(node *Node) error {
+	if !node.HasLabel(c.Label) {
+		return nil
+	}
+	value, ok := node.GetProperty(c.Property)
+	if !ok || value == nil {
+		return nil
+	}
+	var itr NodeIterator
+	if node.graph.index.isNodePropertyIndexed(c.Property) != nil {
+		itr = node.graph.index.GetIteratorForNodeProperty(c.Property, value)
+	} else {
+		itr = node.graph.GetNodesWithAllLabels(NewStringSet(c.Label))
+	}
+	filter := GetNodeFilterFunc(NewStringSet(c.Label), map[string]interface{}{c.Property: value})
+	for itr.Next() {
+		n := itr.Node()
+		if n != node && filter(n) {
+			return ErrUniqueConstraint{ID: node.id, Label: c.Label, Property: c.Property, Value: value}
+		}
+	}
+	return nil
+}
+
+func (c UniqueConstraint) ValidateEdge(*Edge) error { return nil }
+
+// RequiredPropertyConstraint requires that all nodes with the label
+// have the property. If OnEdges is set, the constraint applies to the
+// edges with the label instead.
+type RequiredPropertyConstraint struct {
+	Label    string
+	Property string
+	OnEdges  bool
+}
+
+func (c RequiredPropertyConstraint) ValidateNode(node *Node) error {
+	if c.OnEdges || !node.HasLabel(c.Label) {
+		return nil
+	}
+	if _, ok := node.GetProperty(c.Property); !ok {
+		return ErrRequiredProperty{ID: node.id, Label: c.Label, Property: c.Property}
+	}
+	return nil
+}
+
+func (c RequiredPropertyConstraint) ValidateEdge(edge *Edge) error {
+	if !c.OnEdges || edge.label != c.Label {
+		return nil
+	}
+	if _, ok := edge.GetProperty(c.Property); !ok {
+		return ErrRequiredProperty{ID: edge.id, Label: c.Label, Property: c.Property}
+	}
+	return nil
+}
+
+// PropertyTypeConstraint requires that the property values of the
+// nodes with the label are of the given type. If OnEdges is set, the
+// constraint applies to the edges with the label instead. Nil values
+// are accepted. Violations are reported using ErrPropertyType.
+type PropertyTypeConstraint struct {
+	Label    string
+	Property string
+	Type     PropertyType
+	OnEdges  bool
+}
+
+func (c PropertyTypeConstraint) validate(obj WithProperties) error {
+	value, ok := obj.GetProperty(c.Property)
+	if !ok || value == nil || c.Type == AnyPropertyType {
+		return nil
+	}
+	if TypeOfPropertyValue(value) != c.Type {
+		return ErrPropertyType{Key: c.Property, Expected: c.Type, Value: value}
+	}
+	return nil
+}
+
+func (c PropertyTypeConstraint) ValidateNode(node *Node) error {
+	if c.OnEdges || !node.HasLabel(c.Label) {
+		return nil
+	}
+	return c.validate(node)
+}
+
+func (c PropertyTypeConstraint) ValidateEdge(edge *Edge) error {
+	if !c.OnEdges || edge.label != c.Label {
+		return nil
+	}
+	return c.validate(edge)
+}
+
+// EdgeEndpointConstraint requires that the edges with the label go
+// from a node with one of the FromLabels to a node with one of the
+// ToLabels. If FromLabels or ToLabels is empty, any node is allowed
+// for that end.
+type EdgeEndpointConstraint struct {
+	Label      string
+	FromLabels []string
+	ToLabels   []string
+}
+
+func (c EdgeEndpointConstraint) ValidateNode(*Node) error { return nil }
+
+func (c EdgeEndpointConstraint) ValidateEdge(edge *Edge) error {
+	if edge.label != c.Label {
+		return nil
+	}
+	if (len(c.FromLabels) > 0 && !edge.from.labels.HasAny(c.FromLabels...)) ||
+		(len(c.ToLabels) > 0 && !edge.to.labels.HasAny(c.ToLabels...)) {
+		return ErrEdgeEndpoint{
+			ID:         edge.id,
+			Label:      c.Label,
+			FromLabels: edge.from.labels.SortedSlice(),
+			ToLabels:   edge.to.labels.SortedSlice(),
+		}
+	}
+	return nil
+}
+
+// AddConstraint adds a constraint to the graph. Returns the first
+// violation if the graph does not satisfy the constraint, and does not
+// add the constraint. If there is an active transaction, rolling it
+// back removes the constraint and the index created for it.
+//
+// The changes made outside a transaction are validated as their own
+// transactions: a mutation that violates a constraint is rolled back,
+// and it panics with the constraint error.
+func (g *Graph) AddConstraint(c Constraint) error {
+	var newIndex *IndexInfo
+	if u, ok := c.(UniqueConstraint); ok && g.index.isNodePropertyIndexed(u.Property) == nil {
+		g.AddNodePropertyIndex(u.Property, HashIndex)
+		newIndex = &IndexInfo{Type: HashIndex, Keys: []string{u.Property}}
+	}
+	if errs := g.validateConstraints([]Constraint{c}, 1); len(errs) > 0 {
+		if newIndex != nil {
+			g.DropIndex(*newIndex)
+		}
+		return errs[0]
+	}
+	n := len(g.constraints)
+	g.constraints = append(g.constraints, c)
+	g.record(func() { g.constraints = g.constraints[:n] })
+	return nil
+}
+
+// GetConstraints returns the constraints of the graph
+func (g *Graph) GetConstraints() []Constraint {
+	return g.constraints
+}
+
+// ValidateConstraints checks all the nodes and edges of the graph
+// against the constraints, and returns the violations.
+func (g *Graph) ValidateConstraints() []error {
+	return g.validateConstraints(g.constraints, -1)
+}
+
+// validateConstraints returns at most max errors. If max is negative,
+// returns all errors.
+func (g *Graph) validateConstraints(constraints []Constraint, max int) []error {
+	errs := make([]error, 0)
+	for nodes := g.GetNodes(); nodes.Next(); {
+		for _, c := range constraints {
+			if err := c.ValidateNode(nodes.Node()); err != nil {
+				errs = append(errs, err)
+				if len(errs) == max {
+					return errs
+				}
+			}
+		}
+	}
+	for edges := g.GetEdges(); edges.Next(); {
+		for _, c := range constraints {
+			if err := c.ValidateEdge(edges.Edge()); err != nil {
+				errs = append(errs, err)
+				if len(errs) == max {
+					return errs
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// markNodeDirty records that the node is modified in the transaction,
+// so it is validated when the transaction commits
+func (g *Graph) markNodeDirty(node *Node) {
+	if g.tx == nil || len(g.constraints) == 0 {
+		return
+	}
+	if g.dirtyNodes == nil {
+		g.dirtyNodes = make(map[*Node]struct{})
+	}
+	g.dirtyNodes[node] = struct{}{}
+}
+
+// markEdgeDirty records that the edge is modified in the transaction
+func (g *Graph) markEdgeDirty(edge *Edge) {
+	if g.tx == nil || len(g.constraints) == 0 {
+		return
+	}
+	if g.dirtyEdges == nil {
+		g.dirtyEdges = make(map[*Edge]struct{})
+	}
+	g.dirtyEdges[edge] = struct{}{}
+}
+
+// validateDirty validates the nodes and edges modified in the
+// transaction that are still in the graph, and clears the dirty sets
+func (g *Graph) validateDirty() error {
+	defer func() {
+		g.dirtyNodes = nil
+		g.dirtyEdges = nil
+	}()
+	for node := range g.dirtyNodes {
+		if g.index.nodesByID[node.id] != node {
+			continue
+		}
+		for _, c := range g.constraints {
+			if err := c.ValidateNode(node); err != nil {
+				return err
+			}
+		}
+	}
+	for edge := range g.dirtyEdges {
+		if g.index.edgesByID[edge.id] != edge {
+			continue
+		}
+		for _, c := range g.constraints {
+			if err := c.ValidateEdge(edge); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"strings"
+	"testing"
+)
+
+// commitViolation runs f in a transaction, and returns the error of
+// the commit
+func commitViolation(t *testing.T, g *Graph, f func()) error {
+	tx := g.Begin()
+	f()
+	err := tx.Commit()
+	if err == nil {
+		t.Errorf("Expecting constraint violation")
+	}
+	return err
+}
+
+func TestConstraints(t *testing.T) {
+	g := NewGraph()
+	p1 := g.NewNode([]string{"Person"}, map[string]interface{}{"email": "a@x", "age": 1})
+	c := g.NewNode([]string{"Company"}, nil)
+	g.NewEdge(p1, c, "WORKS_AT", nil)
+
+	for _, constraint := range []Constraint{
+		UniqueConstraint{Label: "Person", Property: "email"},
+		RequiredPropertyConstraint{Label: "Person", Property: "email"},
+		PropertyTypeConstraint{Label: "Person", Property: "age", Type: IntPropertyType},
+		EdgeEndpointConstraint{Label: "WORKS_AT", FromLabels: []string{"Person"}, ToLabels: []string{"Company"}},
+	} {
+		if err := g.AddConstraint(constraint); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := g.AddConstraint(RequiredPropertyConstraint{Label: "Company", Property: "name"}); err == nil {
+		t.Errorf("Expecting violation")
+	}
+
+	if _, ok := commitViolation(t, g, func() {
+		g.NewNode([]string{"Person"}, map[string]interface{}{"email": "a@x"})
+	}).(ErrUniqueConstraint); !ok {
+		t.Errorf("Expecting unique violation")
+	}
+	if g.NumNodes() != 2 {
+		t.Errorf("Violation not rolled back")
+	}
+	if _, ok := commitViolation(t, g, func() { p1.RemoveProperty("email") }).(ErrRequiredProperty); !ok {
+		t.Errorf("Expecting required violation")
+	}
+	if _, ok := commitViolation(t, g, func() { p1.SetProperty("age", "x") }).(ErrPropertyType); !ok {
+		t.Errorf("Expecting type violation")
+	}
+	if v, _ := p1.GetProperty("age"); v != 1 {
+		t.Errorf("Violation not rolled back")
+	}
+	if _, ok := commitViolation(t, g, func() { g.NewEdge(c, p1, "WORKS_AT", nil) }).(ErrEdgeEndpoint); !ok {
+		t.Errorf("Expecting endpoint violation")
+	}
+	if _, ok := commitViolation(t, g, func() { c.SetLabels(NewStringSet("X")) }).(ErrEdgeEndpoint); !ok {
+		t.Errorf("Expecting endpoint violation")
+	}
+
+	// Multi-step changes in a transaction
+	tx := g.Begin()
+	p2 := g.NewNode([]string{"Person"}, nil)
+	p2.SetProperty("email", "b@x")
+	g.NewEdge(p2, c, "WORKS_AT", nil)
+	if err := tx.Commit(); err != nil {
+		t.Error(err)
+	}
+	tx = g.Begin()
+	p3 := g.NewNode([]string{"Person"}, nil)
+	p3.SetProperty("email", "b@x")
+	if _, ok := tx.Commit().(ErrUniqueConstraint); !ok {
+		t.Errorf("Expecting unique violation")
+	}
+	if g.NumNodes() != 3 || g.InTx() {
+		t.Errorf("Violation not rolled back")
+	}
+	if errs := g.ValidateConstraints(); len(errs) != 0 {
+		t.Errorf("Unexpected violations: %v", errs)
+	}
+}
+
+func TestConstraintsWithoutTx(t *testing.T) {
+	g := NewGraph()
+	if err := g.AddConstraint(RequiredPropertyConstraint{Label: "Person", Property: "name"}); err != nil {
+		t.Error(err)
+	}
+	// Modifications outside a transaction are validated as their own
+	// transactions
+	if err := (CypherImporter{}).Import(g, strings.NewReader("CREATE (a:Person {name: 'x'});")); err != nil {
+		t.Error(err)
+	}
+	if _, ok := (CypherImporter{}).Import(g, strings.NewReader("CREATE (a:Person {key: 1});")).(ErrRequiredProperty); !ok {
+		t.Errorf("Expecting violation")
+	}
+	violation := func(f func()) {
+		t.Helper()
+		defer func() {
+			if _, ok := recover().(ErrRequiredProperty); !ok {
+				t.Errorf("Expecting violation")
+			}
+		}()
+		f()
+	}
+	violation(func() { g.NewNode([]string{"Person"}, nil) })
+	node := NodeSlice(g.GetNodes())[0]
+	violation(func() { node.RemoveProperty("name") })
+	if g.NumNodes() != 1 || len(g.ValidateConstraints()) != 0 {
+		t.Errorf("Violations not rolled back: %d %v", g.NumNodes(), g.ValidateConstraints())
+	}
+	if _, err := g.NewNodeWithID(100, []string{"Person"}, nil); err == nil || g.GetNode(100) != nil {
+		t.Errorf("Expecting violation")
+	}
+
+	// Adding a constraint is rolled back
+	tx := g.Begin()
+	if err := g.AddConstraint(UniqueConstraint{Label: "Person", Property: "key"}); err != nil {
+		t.Error(err)
+	}
+	tx.Rollback()
+	if len(g.GetConstraints()) != 1 || g.index.isNodePropertyIndexed("key") != nil {
+		t.Errorf("Constraint not rolled back")
+	}
+
+	// A failed unique constraint does not leave its index behind
+	g.NewNode([]string{"Person"}, map[string]interface{}{"name": "x"})
+	if err := g.AddConstraint(UniqueConstraint{Label: "Person", Property: "name"}); err == nil {
+		t.Errorf("Expecting violation")
+	}
+	if len(g.GetConstraints()) != 1 || g.index.isNodePropertyIndexed("name") != nil {
+		t.Errorf("Constraint or index added")
+	}
+	g.AddNodePropertyIndex("name", BtreeIndex)
+	if err := g.AddConstraint(UniqueConstraint{Label: "Person", Property: "name"}); err == nil {
+		t.Errorf("Expecting violation")
+	}
+	if ix := g.index.isNodePropertyIndexed("name"); ix == nil || indexTypeOf(ix) != BtreeIndex {
+		t.Errorf("Existing index dropped")
+	}
+}
@@ -0,0 +1,1364 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultCypherBatchSize is the number of rows written in a single
+// UNWIND statement if CypherExporter.BatchSize is not set
+const DefaultCypherBatchSize = 1000
+
+// DefaultCypherIDProperty is the temporary node property used to
+// keep node identity between Cypher statements
+const DefaultCypherIDProperty = "_lpg_id"
+
+// DefaultCypherImportLabel is the temporary label of the exported
+// nodes, used to find nodes by their IDProperty using an index
+const DefaultCypherImportLabel = "_LpgImport"
+
+// CypherDialect selects the syntax of the index statements written by
+// CypherExporter
+type CypherDialect int
+
+const (
+	// Neo4jCypher writes Neo4j 4.x and later index statements
+	Neo4jCypher CypherDialect = iota
+	// MemgraphCypher writes Memgraph index statements
+	MemgraphCypher
+)
+
+// CypherExporter writes a graph as a sequence of openCypher
+// statements that can be run on Neo4j or Memgraph to recreate the
+// graph.
+//
+// Every node gets a temporary ImportLabel and a temporary IDProperty
+// that are used to connect edges. The script starts by creating an
+// index on the IDProperty of the ImportLabel:
+//
+//	CREATE INDEX _LpgImport__lpg_id IF NOT EXISTS FOR (n:_LpgImport) ON (n._lpg_id);
+//	CALL db.awaitIndexes();
+//
+// Nodes are grouped by their label set, and written in batches using
+// UNWIND:
+//
+//	UNWIND [{_lpg_id: 0, name: 'a'}, {_lpg_id: 1, name: 'b'}] AS row
+//	CREATE (n:Person:_LpgImport) SET n = row;
+//
+// Edges are grouped by label, and written in batches. The nodes are
+// matched using the index:
+//
+//	UNWIND [{from: 0, to: 1, properties: {since: 2010}}] AS row
+//	MATCH (a:_LpgImport {_lpg_id: row.from}), (b:_LpgImport {_lpg_id: row.to})
+//	CREATE (a)-[e:KNOWS]->(b) SET e = row.properties;
+//
+// Finally, the ImportLabel is removed from the nodes, and the index is
+// dropped. If RemoveIDProperty is set, the IDProperty is also removed
+// from the nodes.
+type CypherExporter struct {
+	// BatchSize is the maximum number of rows in a single UNWIND
+	// statement. If zero, DefaultCypherBatchSize is used.
+	BatchSize int
+
+	// IDProperty is the temporary node property used to keep node
+	// identities. If empty, DefaultCypherIDProperty is used.
+	IDProperty string
+
+	// ImportLabel is the temporary label of the exported nodes. If
+	// empty, DefaultCypherImportLabel is used.
+	ImportLabel string
+
+	// If true, IDProperty is removed from the nodes at the end of the
+	// script.
+	RemoveIDProperty bool
+
+	// Dialect is the syntax of the index statements
+	Dialect CypherDialect
+}
+
+// ErrCypherSyntax is returned by the Cypher importer for statements
+// it cannot parse, or for statements outside the supported subset
+type ErrCypherSyntax struct {
+	// Offset is the byte offset of the error in the input
+	Offset int
+	Msg    string
+}
+
+func (e ErrCypherSyntax) Error() string {
+	return fmt.Sprintf("Cypher syntax error at %d: %s", e.Offset, e.Msg)
+}
+
+func (c CypherExporter) batchSize() int {
+	if c.BatchSize <= 0 {
+		return DefaultCypherBatchSize
+	}
+	return c.BatchSize
+}
+
+func (c CypherExporter) idProperty() string {
+	if len(c.IDProperty) == 0 {
+		return DefaultCypherIDProperty
+	}
+	return c.IDProperty
+}
+
+func (c CypherExporter) importLabel() string {
+	if len(c.ImportLabel) == 0 {
+		return DefaultCypherImportLabel
+	}
+	return c.ImportLabel
+}
+
+// indexStatements returns the statements that create and drop the
+// index on the IDProperty of the ImportLabel
+func (c CypherExporter) indexStatements() (create, drop string) {
+	label, id := cypherName(c.importLabel()), cypherName(c.idProperty())
+	if c.Dialect == MemgraphCypher {
+		return fmt.Sprintf("CREATE INDEX ON :%s(%s);\n", label, id),
+			fmt.Sprintf("DROP INDEX ON :%s(%s);\n", label, id)
+	}
+	name := cypherName(c.importLabel() + "_" + c.idProperty())
+	return fmt.Sprintf("CREATE INDEX %s IF NOT EXISTS FOR (n:%s) ON (n.%s);\nCALL db.awaitIndexes();\n", name, label, id),
+		fmt.Sprintf("DROP INDEX %s IF EXISTS;\n", name)
+}
+
+// Export writes the graph as Cypher statements
+func (c CypherExporter) Export(g *Graph, out io.Writer) error {
+	idProperty := c.idProperty()
+	batchSize := c.batchSize()
+	importLabel := cypherName(c.importLabel())
+	createIndex, dropIndex := c.indexStatements()
+	if _, err := io.WriteString(out, createIndex); err != nil {
+		return err
+	}
+
+	// Give each node an index, and group nodes by label set
+	nodeMap := make(map[*Node]int)
+	groupOrder := make([]string, 0)
+	groups := make(map[string][]*Node)
+	for nodes := g.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		nodeMap[node] = len(nodeMap)
+		key := strings.Join(node.labels.SortedSlice(), ":")
+		if _, exists := groups[key]; !exists {
+			groupOrder = append(groupOrder, key)
+		}
+		groups[key] = append(groups[key], node)
+	}
+
+	for _, key := range groupOrder {
+		nodes := groups[key]
+		labels := cypherLabels(nodes[0].labels.SortedSlice()) + ":" + importLabel
+		for len(nodes) > 0 {
+			n := len(nodes)
+			if n > batchSize {
+				n = batchSize
+			}
+			rows := make([]string, 0, n)
+			for _, node := range nodes[:n] {
+				props := make(map[string]interface{}, node.properties.numProperties()+1)
+				for k, v := range node.properties.load() {
+					props[k] = v
+				}
+				props[idProperty] = nodeMap[node]
+				row, err := cypherValue(props)
+				if err != nil {
+					return err
+				}
+				rows = append(rows, row)
+			}
+			nodes = nodes[n:]
+			if _, err := fmt.Fprintf(out, "UNWIND [%s] AS row\nCREATE (n%s) SET n = row;\n", strings.Join(rows, ", "), labels); err != nil {
+				return err
+			}
+		}
+	}
+
+	edgeOrder := make([]string, 0)
+	edgeGroups := make(map[string][]*Edge)
+	for edges := g.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		if len(edge.label) == 0 {
+			return ErrInvalidGraph{Msg: "Edges without labels cannot be exported to Cypher"}
+		}
+		if _, exists := edgeGroups[edge.label]; !exists {
+			edgeOrder = append(edgeOrder, edge.label)
+		}
+		edgeGroups[edge.label] = append(edgeGroups[edge.label], edge)
+	}
+	id := cypherName(idProperty)
+	for _, label := range edgeOrder {
+		edges := edgeGroups[label]
+		for len(edges) > 0 {
+			n := len(edges)
+			if n > batchSize {
+				n = batchSize
+			}
+			rows := make([]string, 0, n)
+			for _, edge := range edges[:n] {
+				props := make(map[string]interface{}, edge.properties.numProperties())
+				for k, v := range edge.properties.load() {
+					props[k] = v
+				}
+				row, err := cypherValue(map[string]interface{}{
+					"from":       nodeMap[edge.from],
+					"to":         nodeMap[edge.to],
+					"properties": props,
+				})
+				if err != nil {
+					return err
+				}
+				rows = append(rows, row)
+			}
+			edges = edges[n:]
+			if _, err := fmt.Fprintf(out, "UNWIND [%s] AS row\nMATCH (a:%s {%s: row.from}), (b:%s {%s: row.to})\nCREATE (a)-[e:%s]->(b) SET e = row.properties;\n", strings.Join(rows, ", "), importLabel, id, importLabel, id, cypherName(label)); err != nil {
+				return err
+			}
+		}
+	}
+
+	remove := "n:" + importLabel
+	if c.RemoveIDProperty {
+		remove += ", n." + id
+	}
+	if _, err := fmt.Fprintf(out, "MATCH (n:%s) REMOVE %s;\n", importLabel, remove); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, dropIndex)
+	return err
+}
+
+func cypherLabels(labels []string) string {
+	sb := strings.Builder{}
+	for _, l := range labels {
+		sb.WriteRune(':')
+		sb.WriteString(cypherName(l))
+	}
+	return sb.String()
+}
+
+func isCypherIdentifier(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			continue
+		}
+		if i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// cypherName returns the name as a Cypher symbolic name, quoting it
+// with backticks if necessary
+func cypherName(s string) string {
+	if isCypherIdentifier(s) {
+		return s
+	}
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// cypherString returns s as a single-quoted Cypher string literal
+func cypherString(s string) string {
+	sb := strings.Builder{}
+	sb.WriteRune('\'')
+	for _, c := range s {
+		switch c {
+		case '\'':
+			sb.WriteString(`\'`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(&sb, `\u%04X`, c)
+			} else {
+				sb.WriteRune(c)
+			}
+		}
+	}
+	sb.WriteRune('\'')
+	return sb.String()
+}
+
+// cypherValue returns the Cypher literal for a property value
+func cypherValue(value interface{}) (string, error) {
+	if n, ok := value.(WithNativeValue); ok {
+		value = n.GetNativeValue()
+	}
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return cypherString(v), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8, int16, int32, int64:
+		return strconv.FormatInt(reflect.ValueOf(v).Int(), 10), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return strconv.FormatUint(reflect.ValueOf(v).Uint(), 10), nil
+	case float32:
+		return cypherFloat(float64(v))
+	case float64:
+		return cypherFloat(v)
+	case time.Time:
+		return "datetime(" + cypherString(v.Format(time.RFC3339Nano)) + ")", nil
+	case Date:
+		return "date(" + cypherString(v.String()) + ")", nil
+	case Duration:
+		return "duration(" + cypherString(v.String()) + ")", nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		elements := make([]string, 0, len(keys))
+		for _, k := range keys {
+			s, err := cypherValue(v[k])
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, cypherName(k)+": "+s)
+		}
+		return "{" + strings.Join(elements, ", ") + "}", nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			s, err := cypherValue(rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, s)
+		}
+		return "[" + strings.Join(elements, ", ") + "]", nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, rv.Len())
+			for itr := rv.MapRange(); itr.Next(); {
+				m[itr.Key().String()] = itr.Value().Interface()
+			}
+			return cypherValue(m)
+		}
+	}
+	return "", fmt.Errorf("Cannot write value of type %T in Cypher", value)
+}
+
+func cypherFloat(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("Cannot write %v in Cypher", f)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+// CypherImporter reads a subset of openCypher statements into a
+// graph. The supported subset includes the statements written by
+// CypherExporter, and simple CREATE statements:
+//
+//	CREATE (a:Person {name: 'a'}), (b:Person {name: 'b'}), (a)-[:KNOWS {since: 2010}]->(b);
+//	UNWIND [{name: 'a'}, {name: 'b'}] AS row CREATE (n:Person) SET n = row;
+//	MATCH (a {_lpg_id: 0}), (b {_lpg_id: 1}) CREATE (a)<-[:KNOWS]-(b);
+//	MATCH (n:_LpgImport) REMOVE n:_LpgImport, n._lpg_id;
+//
+// Each statement may start with an UNWIND clause, followed by MATCH,
+// CREATE, SET, and REMOVE clauses. MATCH only supports node patterns
+// with labels and property maps. Statements are separated by ';'.
+// Index and constraint statements, and procedure calls, are ignored.
+//
+// The importer keeps track of the nodes by their IDProperty. MATCH
+// patterns containing the IDProperty are resolved using these node
+// identities. If StripIDProperty is set, the IDProperty is not stored
+// in the nodes.
+type CypherImporter struct {
+	// IDProperty is the node property used to keep node
+	// identities. If empty, DefaultCypherIDProperty is used.
+	IDProperty string
+
+	// If true, IDProperty is not stored as a node property
+	StripIDProperty bool
+}
+
+// Import reads Cypher statements from in, and adds the nodes and
+// edges to g. Each statement runs in a transaction, so the statement
+// is validated against the constraints of g when it completes. If a
+// statement fails, its changes are rolled back, and the error is
+// returned.
+func (c CypherImporter) Import(g *Graph, in io.Reader) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	idProperty := c.IDProperty
+	if len(idProperty) == 0 {
+		idProperty = DefaultCypherIDProperty
+	}
+	tokens, err := cypherTokenize(string(data))
+	if err != nil {
+		return err
+	}
+	imp := &cypherImport{
+		graph:      g,
+		idProperty: idProperty,
+		strip:      c.StripIDProperty,
+		ids:        make(map[string]*Node),
+	}
+	p := &cypherParser{tokens: tokens}
+	for !p.eof() {
+		if p.acceptPunct(";") || p.skipSchemaStatement() {
+			continue
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return err
+		}
+		if err := imp.runTx(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cypherTokenKind int
+
+const (
+	cypherIdent cypherTokenKind = iota
+	cypherQuotedIdent
+	cypherStringLiteral
+	cypherNumber
+	cypherPunct
+)
+
+type cypherToken struct {
+	kind   cypherTokenKind
+	text   string
+	offset int
+}
+
+// cypherTokenize splits the input into tokens. Token offsets are byte
+// offsets in the input.
+func cypherTokenize(input string) ([]cypherToken, error) {
+	tokens := make([]cypherToken, 0)
+	isIdent := func(c byte) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+	}
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(input) && input[i+1] == '/':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i < len(input) && isIdent(input[i]) {
+				i++
+			}
+			tokens = append(tokens, cypherToken{kind: cypherIdent, text: input[start:i], offset: start})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(input) && ((input[i] >= '0' && input[i] <= '9') || input[i] == '.' || input[i] == 'e' || input[i] == 'E' ||
+				((input[i] == '-' || input[i] == '+') && (input[i-1] == 'e' || input[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, cypherToken{kind: cypherNumber, text: input[start:i], offset: start})
+		case c == '`':
+			start := i
+			sb := strings.Builder{}
+			i++
+			for {
+				if i >= len(input) {
+					return nil, ErrCypherSyntax{Offset: start, Msg: "Unterminated identifier"}
+				}
+				if input[i] == '`' {
+					if i+1 < len(input) && input[i+1] == '`' {
+						sb.WriteByte('`')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, cypherToken{kind: cypherQuotedIdent, text: sb.String(), offset: start})
+		case c == '\'' || c == '"':
+			start := i
+			sb := strings.Builder{}
+			i++
+			for {
+				if i >= len(input) {
+					return nil, ErrCypherSyntax{Offset: start, Msg: "Unterminated string"}
+				}
+				if input[i] == c {
+					i++
+					break
+				}
+				if input[i] != '\\' {
+					sb.WriteByte(input[i])
+					i++
+					continue
+				}
+				if i+1 >= len(input) {
+					return nil, ErrCypherSyntax{Offset: i, Msg: "Invalid escape"}
+				}
+				i++
+				switch input[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				case 'b':
+					sb.WriteByte('\b')
+				case 'f':
+					sb.WriteByte('\f')
+				case 'u':
+					if i+4 >= len(input) {
+						return nil, ErrCypherSyntax{Offset: i, Msg: "Invalid unicode escape"}
+					}
+					v, err := strconv.ParseUint(input[i+1:i+5], 16, 32)
+					if err != nil {
+						return nil, ErrCypherSyntax{Offset: i, Msg: "Invalid unicode escape"}
+					}
+					sb.WriteRune(rune(v))
+					i += 4
+				default:
+					sb.WriteByte(input[i])
+				}
+				i++
+			}
+			tokens = append(tokens, cypherToken{kind: cypherStringLiteral, text: sb.String(), offset: start})
+		default:
+			_, size := utf8.DecodeRuneInString(input[i:])
+			tokens = append(tokens, cypherToken{kind: cypherPunct, text: input[i : i+size], offset: i})
+			i += size
+		}
+	}
+	return tokens, nil
+}
+
+// cypherExpr is a literal, a variable, or a property of a variable
+type cypherExpr struct {
+	literal  interface{}
+	list     []cypherExpr
+	mapValue map[string]cypherExpr
+	variable string
+	property string
+	function string
+	args     []cypherExpr
+	kind     int
+}
+
+const (
+	cypherExprLiteral = iota
+	cypherExprList
+	cypherExprMap
+	cypherExprVariable
+	cypherExprFunction
+)
+
+type cypherNodePattern struct {
+	variable   string
+	labels     []string
+	properties map[string]cypherExpr
+}
+
+type cypherEdgePattern struct {
+	variable   string
+	label      string
+	properties map[string]cypherExpr
+	toLeft     bool
+}
+
+// cypherPath is a node, optionally followed by edge-node pairs
+type cypherPath struct {
+	nodes []cypherNodePattern
+	edges []cypherEdgePattern
+}
+
+type cypherSetItem struct {
+	variable string
+	property string
+	label    string
+	merge    bool
+	value    cypherExpr
+}
+
+type cypherStatement struct {
+	unwind    *cypherExpr
+	unwindVar string
+	match     []cypherNodePattern
+	create    []cypherPath
+	set       []cypherSetItem
+	remove    []cypherSetItem
+}
+
+type cypherParser struct {
+	tokens []cypherToken
+	pos    int
+}
+
+func (p *cypherParser) eof() bool { return p.pos >= len(p.tokens) }
+
+func (p *cypherParser) offset() int {
+	if p.eof() {
+		if len(p.tokens) == 0 {
+			return 0
+		}
+		return p.tokens[len(p.tokens)-1].offset
+	}
+	return p.tokens[p.pos].offset
+}
+
+func (p *cypherParser) errorf(format string, args ...interface{}) error {
+	return ErrCypherSyntax{Offset: p.offset(), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *cypherParser) peekPunct(s string) bool {
+	return !p.eof() && p.tokens[p.pos].kind == cypherPunct && p.tokens[p.pos].text == s
+}
+
+func (p *cypherParser) acceptPunct(s string) bool {
+	if p.peekPunct(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *cypherParser) expectPunct(s string) error {
+	if !p.acceptPunct(s) {
+		return p.errorf("Expecting '%s'", s)
+	}
+	return nil
+}
+
+func (p *cypherParser) peekKeyword(kw string) bool {
+	return !p.eof() && p.tokens[p.pos].kind == cypherIdent && strings.EqualFold(p.tokens[p.pos].text, kw)
+}
+
+func (p *cypherParser) acceptKeyword(kw string) bool {
+	if p.peekKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *cypherParser) name() (string, error) {
+	if p.eof() || (p.tokens[p.pos].kind != cypherIdent && p.tokens[p.pos].kind != cypherQuotedIdent) {
+		return "", p.errorf("Name expected")
+	}
+	p.pos++
+	return p.tokens[p.pos-1].text, nil
+}
+
+// skipSchemaStatement skips an index or constraint statement, or a
+// procedure call, up to the next ';'. Returns false if the next
+// statement is not one of those.
+func (p *cypherParser) skipSchemaStatement() bool {
+	start := p.pos
+	if !p.acceptKeyword("CALL") {
+		if !p.acceptKeyword("CREATE") && !p.acceptKeyword("DROP") {
+			return false
+		}
+		if !p.peekKeyword("INDEX") && !p.peekKeyword("CONSTRAINT") {
+			p.pos = start
+			return false
+		}
+	}
+	for !p.eof() && !p.peekPunct(";") {
+		p.pos++
+	}
+	return true
+}
+
+func (p *cypherParser) statement() (cypherStatement, error) {
+	stmt := cypherStatement{}
+	if p.acceptKeyword("UNWIND") {
+		expr, err := p.expr()
+		if err != nil {
+			return stmt, err
+		}
+		if !p.acceptKeyword("AS") {
+			return stmt, p.errorf("AS expected")
+		}
+		if stmt.unwindVar, err = p.name(); err != nil {
+			return stmt, err
+		}
+		stmt.unwind = &expr
+	}
+	for !p.eof() && !p.peekPunct(";") {
+		switch {
+		case p.acceptKeyword("MATCH"):
+			for {
+				node, err := p.nodePattern()
+				if err != nil {
+					return stmt, err
+				}
+				stmt.match = append(stmt.match, node)
+				if !p.acceptPunct(",") {
+					break
+				}
+			}
+		case p.acceptKeyword("CREATE"):
+			for {
+				path, err := p.pathPattern()
+				if err != nil {
+					return stmt, err
+				}
+				stmt.create = append(stmt.create, path)
+				if !p.acceptPunct(",") {
+					break
+				}
+			}
+		case p.acceptKeyword("SET"):
+			for {
+				item, err := p.setItem()
+				if err != nil {
+					return stmt, err
+				}
+				stmt.set = append(stmt.set, item)
+				if !p.acceptPunct(",") {
+					break
+				}
+			}
+		case p.acceptKeyword("REMOVE"):
+			for {
+				item := cypherSetItem{}
+				var err error
+				if item.variable, err = p.name(); err != nil {
+					return stmt, err
+				}
+				if p.acceptPunct(":") {
+					item.label, err = p.name()
+				} else if err = p.expectPunct("."); err == nil {
+					item.property, err = p.name()
+				}
+				if err != nil {
+					return stmt, err
+				}
+				stmt.remove = append(stmt.remove, item)
+				if !p.acceptPunct(",") {
+					break
+				}
+			}
+		default:
+			return stmt, p.errorf("Unsupported clause")
+		}
+	}
+	return stmt, nil
+}
+
+func (p *cypherParser) setItem() (cypherSetItem, error) {
+	item := cypherSetItem{}
+	var err error
+	if item.variable, err = p.name(); err != nil {
+		return item, err
+	}
+	if p.acceptPunct(".") {
+		if item.property, err = p.name(); err != nil {
+			return item, err
+		}
+	} else if p.acceptPunct("+") {
+		item.merge = true
+	}
+	if err := p.expectPunct("="); err != nil {
+		return item, err
+	}
+	item.value, err = p.expr()
+	return item, err
+}
+
+func (p *cypherParser) nodePattern() (cypherNodePattern, error) {
+	ret := cypherNodePattern{}
+	if err := p.expectPunct("("); err != nil {
+		return ret, err
+	}
+	if !p.eof() && (p.tokens[p.pos].kind == cypherIdent || p.tokens[p.pos].kind == cypherQuotedIdent) {
+		ret.variable = p.tokens[p.pos].text
+		p.pos++
+	}
+	for p.acceptPunct(":") {
+		label, err := p.name()
+		if err != nil {
+			return ret, err
+		}
+		ret.labels = append(ret.labels, label)
+	}
+	if p.peekPunct("{") {
+		m, err := p.mapLiteral()
+		if err != nil {
+			return ret, err
+		}
+		ret.properties = m.mapValue
+	}
+	return ret, p.expectPunct(")")
+}
+
+func (p *cypherParser) edgePattern() (cypherEdgePattern, error) {
+	ret := cypherEdgePattern{}
+	if p.acceptPunct("<") {
+		ret.toLeft = true
+	}
+	if err := p.expectPunct("-"); err != nil {
+		return ret, err
+	}
+	if err := p.expectPunct("["); err != nil {
+		return ret, err
+	}
+	if !p.eof() && (p.tokens[p.pos].kind == cypherIdent || p.tokens[p.pos].kind == cypherQuotedIdent) {
+		ret.variable = p.tokens[p.pos].text
+		p.pos++
+	}
+	if !p.acceptPunct(":") {
+		return ret, p.errorf("Relationship type expected")
+	}
+	var err error
+	if ret.label, err = p.name(); err != nil {
+		return ret, err
+	}
+	if p.peekPunct("{") {
+		m, err := p.mapLiteral()
+		if err != nil {
+			return ret, err
+		}
+		ret.properties = m.mapValue
+	}
+	if err := p.expectPunct("]"); err != nil {
+		return ret, err
+	}
+	if err := p.expectPunct("-"); err != nil {
+		return ret, err
+	}
+	if p.acceptPunct(">") {
+		if ret.toLeft {
+			return ret, p.errorf("Bidirectional relationships are not supported")
+		}
+	} else if !ret.toLeft {
+		return ret, p.errorf("Directed relationship expected")
+	}
+	return ret, nil
+}
+
+func (p *cypherParser) pathPattern() (cypherPath, error) {
+	ret := cypherPath{}
+	node, err := p.nodePattern()
+	if err != nil {
+		return ret, err
+	}
+	ret.nodes = append(ret.nodes, node)
+	for p.peekPunct("-") || p.peekPunct("<") {
+		edge, err := p.edgePattern()
+		if err != nil {
+			return ret, err
+		}
+		node, err := p.nodePattern()
+		if err != nil {
+			return ret, err
+		}
+		ret.edges = append(ret.edges, edge)
+		ret.nodes = append(ret.nodes, node)
+	}
+	return ret, nil
+}
+
+func (p *cypherParser) mapLiteral() (cypherExpr, error) {
+	ret := cypherExpr{kind: cypherExprMap, mapValue: make(map[string]cypherExpr)}
+	if err := p.expectPunct("{"); err != nil {
+		return ret, err
+	}
+	if p.acceptPunct("}") {
+		return ret, nil
+	}
+	for {
+		key, err := p.name()
+		if err != nil {
+			return ret, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return ret, err
+		}
+		value, err := p.expr()
+		if err != nil {
+			return ret, err
+		}
+		ret.mapValue[key] = value
+		if p.acceptPunct("}") {
+			return ret, nil
+		}
+		if err := p.expectPunct(","); err != nil {
+			return ret, err
+		}
+	}
+}
+
+func (p *cypherParser) expr() (cypherExpr, error) {
+	if p.eof() {
+		return cypherExpr{}, p.errorf("Expression expected")
+	}
+	if p.peekPunct("{") {
+		return p.mapLiteral()
+	}
+	if p.acceptPunct("[") {
+		ret := cypherExpr{kind: cypherExprList, list: make([]cypherExpr, 0)}
+		if p.acceptPunct("]") {
+			return ret, nil
+		}
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return ret, err
+			}
+			ret.list = append(ret.list, e)
+			if p.acceptPunct("]") {
+				return ret, nil
+			}
+			if err := p.expectPunct(","); err != nil {
+				return ret, err
+			}
+		}
+	}
+	negative := p.acceptPunct("-")
+	if p.eof() {
+		return cypherExpr{}, p.errorf("Expression expected")
+	}
+	tok := p.tokens[p.pos]
+	switch tok.kind {
+	case cypherNumber:
+		p.pos++
+		text := tok.text
+		if negative {
+			text = "-" + text
+		}
+		if strings.ContainsAny(text, ".eE") {
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return cypherExpr{}, ErrCypherSyntax{Offset: tok.offset, Msg: err.Error()}
+			}
+			return cypherExpr{literal: f}, nil
+		}
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return cypherExpr{}, ErrCypherSyntax{Offset: tok.offset, Msg: err.Error()}
+		}
+		return cypherExpr{literal: int(i)}, nil
+	case cypherStringLiteral:
+		if negative {
+			return cypherExpr{}, ErrCypherSyntax{Offset: tok.offset, Msg: "Number expected"}
+		}
+		p.pos++
+		return cypherExpr{literal: tok.text}, nil
+	}
+	if negative {
+		return cypherExpr{}, p.errorf("Number expected")
+	}
+	name, err := p.name()
+	if err != nil {
+		return cypherExpr{}, err
+	}
+	if tok.kind == cypherIdent {
+		switch strings.ToLower(name) {
+		case "true":
+			return cypherExpr{literal: true}, nil
+		case "false":
+			return cypherExpr{literal: false}, nil
+		case "null":
+			return cypherExpr{literal: nil}, nil
+		}
+	}
+	if p.acceptPunct("(") {
+		ret := cypherExpr{kind: cypherExprFunction, function: strings.ToLower(name)}
+		if p.acceptPunct(")") {
+			return ret, nil
+		}
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return ret, err
+			}
+			ret.args = append(ret.args, e)
+			if p.acceptPunct(")") {
+				return ret, nil
+			}
+			if err := p.expectPunct(","); err != nil {
+				return ret, err
+			}
+		}
+	}
+	ret := cypherExpr{kind: cypherExprVariable, variable: name}
+	if p.acceptPunct(".") {
+		if ret.property, err = p.name(); err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// cypherImport keeps the state of an import
+type cypherImport struct {
+	graph      *Graph
+	idProperty string
+	strip      bool
+	// Nodes by the Cypher literal of their ids, so ids that are lists
+	// or maps can be used as keys
+	ids map[string]*Node
+}
+
+func (imp *cypherImport) eval(expr cypherExpr, vars map[string]interface{}) (interface{}, error) {
+	switch expr.kind {
+	case cypherExprLiteral:
+		return expr.literal, nil
+	case cypherExprList:
+		ret := make([]interface{}, 0, len(expr.list))
+		for _, x := range expr.list {
+			v, err := imp.eval(x, vars)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	case cypherExprMap:
+		ret := make(map[string]interface{}, len(expr.mapValue))
+		for k, x := range expr.mapValue {
+			v, err := imp.eval(x, vars)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = v
+		}
+		return ret, nil
+	case cypherExprFunction:
+		if len(expr.args) != 1 {
+			return nil, fmt.Errorf("Unsupported function: %s", expr.function)
+		}
+		var parse func(string) (interface{}, error)
+		switch expr.function {
+		case "datetime":
+			parse = func(s string) (interface{}, error) { return time.Parse(time.RFC3339Nano, s) }
+		case "date":
+			parse = func(s string) (interface{}, error) { return ParseDate(s) }
+		case "duration":
+			parse = func(s string) (interface{}, error) { return ParseDuration(s) }
+		default:
+			return nil, fmt.Errorf("Unsupported function: %s", expr.function)
+		}
+		v, err := imp.eval(expr.args[0], vars)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("String expected in %s", expr.function)
+		}
+		return parse(s)
+	}
+	v, ok := vars[expr.variable]
+	if !ok {
+		return nil, fmt.Errorf("Unknown variable: %s", expr.variable)
+	}
+	if len(expr.property) == 0 {
+		return v, nil
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return t[expr.property], nil
+	case *Node:
+		x, _ := t.GetProperty(expr.property)
+		return x, nil
+	case *Edge:
+		x, _ := t.GetProperty(expr.property)
+		return x, nil
+	}
+	return nil, fmt.Errorf("Cannot get property %s of %s", expr.property, expr.variable)
+}
+
+func (imp *cypherImport) evalMap(m map[string]cypherExpr, vars map[string]interface{}) (map[string]interface{}, error) {
+	if m == nil {
+		return nil, nil
+	}
+	v, err := imp.eval(cypherExpr{kind: cypherExprMap, mapValue: m}, vars)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// setNodeProperty sets a node property, keeping track of node ids
+func (imp *cypherImport) setNodeProperty(node *Node, key string, value interface{}) error {
+	if key == imp.idProperty {
+		id, err := cypherValue(value)
+		if err != nil {
+			return err
+		}
+		imp.ids[id] = node
+		if imp.strip {
+			return nil
+		}
+	}
+	if value == nil {
+		node.RemoveProperty(key)
+		return nil
+	}
+	node.SetProperty(key, value)
+	return nil
+}
+
+// runTx runs the statement in a transaction
+func (imp *cypherImport) runTx(stmt cypherStatement) error {
+	tx := imp.graph.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err := imp.run(stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (imp *cypherImport) run(stmt cypherStatement) error {
+	if stmt.unwind == nil {
+		return imp.runRow(stmt, map[string]interface{}{})
+	}
+	rows, err := imp.eval(*stmt.unwind, nil)
+	if err != nil {
+		return err
+	}
+	list, ok := rows.([]interface{})
+	if !ok {
+		return fmt.Errorf("UNWIND expects a list")
+	}
+	for _, row := range list {
+		if err := imp.runRow(stmt, map[string]interface{}{stmt.unwindVar: row}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imp *cypherImport) runRow(stmt cypherStatement, vars map[string]interface{}) error {
+	// Find all matching node combinations
+	var match func(int, map[string]interface{}) error
+	match = func(i int, vars map[string]interface{}) error {
+		if i == len(stmt.match) {
+			return imp.runUpdates(stmt, vars)
+		}
+		pattern := stmt.match[i]
+		props, err := imp.evalMap(pattern.properties, vars)
+		if err != nil {
+			return err
+		}
+		var candidates []*Node
+		if value, ok := props[imp.idProperty]; ok {
+			id, err := cypherValue(value)
+			if err != nil {
+				return err
+			}
+			if node := imp.ids[id]; node != nil {
+				candidates = []*Node{node}
+			}
+			delete(props, imp.idProperty)
+		} else {
+			candidates = NodeSlice(imp.graph.FindNodes(NewStringSet(pattern.labels...), props))
+		}
+		filter := GetNodeFilterFunc(NewStringSet(pattern.labels...), props)
+		for _, node := range candidates {
+			if !filter(node) {
+				continue
+			}
+			if len(pattern.variable) > 0 {
+				vars[pattern.variable] = node
+			}
+			if err := match(i+1, vars); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return match(0, vars)
+}
+
+func (imp *cypherImport) createNode(pattern cypherNodePattern, vars map[string]interface{}) (*Node, error) {
+	if len(pattern.variable) > 0 {
+		if v, ok := vars[pattern.variable]; ok {
+			node, ok := v.(*Node)
+			if !ok {
+				return nil, fmt.Errorf("Node expected: %s", pattern.variable)
+			}
+			return node, nil
+		}
+	}
+	props, err := imp.evalMap(pattern.properties, vars)
+	if err != nil {
+		return nil, err
+	}
+	node := imp.graph.NewNode(pattern.labels, nil)
+	for k, v := range props {
+		if err := imp.setNodeProperty(node, k, v); err != nil {
+			return nil, err
+		}
+	}
+	if len(pattern.variable) > 0 {
+		vars[pattern.variable] = node
+	}
+	return node, nil
+}
+
+func (imp *cypherImport) runUpdates(stmt cypherStatement, vars map[string]interface{}) error {
+	for _, path := range stmt.create {
+		prev, err := imp.createNode(path.nodes[0], vars)
+		if err != nil {
+			return err
+		}
+		for i, edgePattern := range path.edges {
+			next, err := imp.createNode(path.nodes[i+1], vars)
+			if err != nil {
+				return err
+			}
+			props, err := imp.evalMap(edgePattern.properties, vars)
+			if err != nil {
+				return err
+			}
+			from, to := prev, next
+			if edgePattern.toLeft {
+				from, to = next, prev
+			}
+			edge := imp.graph.NewEdge(from, to, edgePattern.label, props)
+			if len(edgePattern.variable) > 0 {
+				vars[edgePattern.variable] = edge
+			}
+			prev = next
+		}
+	}
+	for _, item := range stmt.set {
+		target, ok := vars[item.variable]
+		if !ok {
+			return fmt.Errorf("Unknown variable: %s", item.variable)
+		}
+		value, err := imp.eval(item.value, vars)
+		if err != nil {
+			return err
+		}
+		var props map[string]interface{}
+		if len(item.property) > 0 {
+			props = map[string]interface{}{item.property: value}
+		} else {
+			if props, ok = value.(map[string]interface{}); !ok && value != nil {
+				return fmt.Errorf("Map expected in SET %s", item.variable)
+			}
+		}
+		switch t := target.(type) {
+		case *Node:
+			if len(item.property) == 0 && !item.merge {
+				for _, k := range t.propertyKeys() {
+					if _, keep := props[k]; !keep {
+						t.RemoveProperty(k)
+					}
+				}
+			}
+			for k, v := range props {
+				if err := imp.setNodeProperty(t, k, v); err != nil {
+					return err
+				}
+			}
+		case *Edge:
+			if len(item.property) == 0 && !item.merge {
+				for _, k := range t.propertyKeys() {
+					if _, keep := props[k]; !keep {
+						t.RemoveProperty(k)
+					}
+				}
+			}
+			for k, v := range props {
+				if v == nil {
+					t.RemoveProperty(k)
+				} else {
+					t.SetProperty(k, v)
+				}
+			}
+		default:
+			return fmt.Errorf("Cannot set properties of %s", item.variable)
+		}
+	}
+	for _, item := range stmt.remove {
+		target, ok := vars[item.variable]
+		if !ok {
+			return fmt.Errorf("Unknown variable: %s", item.variable)
+		}
+		switch t := target.(type) {
+		case *Node:
+			if len(item.label) > 0 {
+				if t.HasLabel(item.label) {
+					labels := t.GetLabels()
+					labels.Remove(item.label)
+					t.SetLabels(labels)
+				}
+			} else {
+				t.RemoveProperty(item.property)
+			}
+		case *Edge:
+			if len(item.label) > 0 {
+				return fmt.Errorf("Cannot remove the label of %s", item.variable)
+			}
+			t.RemoveProperty(item.property)
+		default:
+			return fmt.Errorf("Cannot remove properties of %s", item.variable)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCypherRoundTrip(t *testing.T) {
+	g := NewGraph()
+	nodes := make([]*Node, 0)
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, g.NewNode([]string{"Person"}, map[string]interface{}{"key": i, "name": "it's \"x\"\n"}))
+	}
+	nodes = append(nodes, g.NewNode([]string{"a b", "c`d"}, map[string]interface{}{"list": []interface{}{"x", 1.5, true}}))
+	for i := 0; i < len(nodes)-1; i++ {
+		g.NewEdge(nodes[i], nodes[i+1], "NEXT", map[string]interface{}{"key": i})
+	}
+
+	buf := bytes.Buffer{}
+	if err := (CypherExporter{BatchSize: 3, RemoveIDProperty: true}).Export(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if n := strings.Count(buf.String(), "UNWIND"); n != 9 {
+		t.Errorf("Expecting 9 batches, got %d: %s", n, buf.String())
+	}
+	// Edges are matched using the index on the import label
+	for _, stmt := range []string{
+		"CREATE INDEX _LpgImport__lpg_id IF NOT EXISTS FOR (n:_LpgImport) ON (n._lpg_id);",
+		"CREATE (n:Person:_LpgImport) SET n = row;",
+		"MATCH (a:_LpgImport {_lpg_id: row.from}), (b:_LpgImport {_lpg_id: row.to})",
+		"MATCH (n:_LpgImport) REMOVE n:_LpgImport, n._lpg_id;",
+		"DROP INDEX _LpgImport__lpg_id IF EXISTS;",
+	} {
+		if !strings.Contains(buf.String(), stmt) {
+			t.Errorf("Missing %s", stmt)
+		}
+	}
+
+	target := NewGraph()
+	if err := (CypherImporter{}).Import(target, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if ok, _ := CheckIsomorphism(context.Background(), g, target, func(n1, n2 *Node) bool {
+		return n1.GetLabels().IsEqual(n2.GetLabels()) && reflect.DeepEqual(n1.properties.load(), n2.properties.load())
+	}, func(e1, e2 *Edge) bool {
+		return e1.label == e2.label && reflect.DeepEqual(e1.properties.load(), e2.properties.load())
+	}); !ok {
+		t.Errorf("Imported graph is not isomorphic")
+	}
+}
+
+func TestCypherImportCreate(t *testing.T) {
+	input := `CREATE (a:Person {name: 'a', _lpg_id: 1}), (b:Person {name: "b", _lpg_id: 2}), (a)-[:KNOWS {since: -2010}]->(b);
+// Comment
+MATCH (x {_lpg_id: 1}), (y {_lpg_id: 2}) CREATE (x)<-[:KNOWS]-(y);
+`
+	g := NewGraph()
+	if err := (CypherImporter{StripIDProperty: true}).Import(g, strings.NewReader(input)); err != nil {
+		t.Error(err)
+		return
+	}
+	if g.NumNodes() != 2 || g.NumEdges() != 2 {
+		t.Errorf("Wrong graph: %d nodes %d edges", g.NumNodes(), g.NumEdges())
+	}
+	for nodes := g.GetNodes(); nodes.Next(); {
+		if _, ok := nodes.Node().GetProperty(DefaultCypherIDProperty); ok {
+			t.Errorf("ID property not stripped")
+		}
+	}
+	a := NodeSlice(g.FindNodes(NewStringSet("Person"), map[string]interface{}{"name": "a"}))
+	if len(a) != 1 {
+		t.Errorf("Cannot find a")
+		return
+	}
+	if len(EdgeSlice(a[0].GetEdges(OutgoingEdge))) != 1 || len(EdgeSlice(a[0].GetEdges(IncomingEdge))) != 1 {
+		t.Errorf("Wrong edges")
+	}
+	if v, _ := EdgeSlice(a[0].GetEdges(OutgoingEdge))[0].GetProperty("since"); v != -2010 {
+		t.Errorf("Wrong property: %v", v)
+	}
+
+	if err := (CypherImporter{}).Import(g, strings.NewReader("DELETE (n)")); err == nil {
+		t.Errorf("Expecting error")
+	}
+	// Offsets are byte offsets
+	err := (CypherImporter{}).Import(g, strings.NewReader("CREATE (a {name: 'ü'}) DELETE (n)"))
+	if e, ok := err.(ErrCypherSyntax); !ok || e.Offset != 24 {
+		t.Errorf("Expecting error at 24, got %v", err)
+	}
+	// Lists and maps can be used as ids
+	g = NewGraph()
+	input = `CREATE (a {_lpg_id: [1, 'x']}), (b {_lpg_id: {k: 2}});
+MATCH (x {_lpg_id: [1, 'x']}), (y {_lpg_id: {k: 2}}) CREATE (x)-[:R]->(y);
+`
+	if err := (CypherImporter{}).Import(g, strings.NewReader(input)); err != nil {
+		t.Error(err)
+	}
+	if g.NumNodes() != 2 || g.NumEdges() != 1 {
+		t.Errorf("Wrong graph: %d nodes %d edges", g.NumNodes(), g.NumEdges())
+	}
+}
+
+func TestCypherMemgraphExport(t *testing.T) {
+	g := NewGraph()
+	a := g.NewNode([]string{"A"}, nil)
+	g.NewEdge(a, g.NewNode(nil, nil), "E", nil)
+	buf := bytes.Buffer{}
+	if err := (CypherExporter{Dialect: MemgraphCypher, ImportLabel: "Tmp"}).Export(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "CREATE INDEX ON :Tmp(_lpg_id);\n") || !strings.HasSuffix(out, "MATCH (n:Tmp) REMOVE n:Tmp;\nDROP INDEX ON :Tmp(_lpg_id);\n") {
+		t.Errorf("Wrong index statements: %s", out)
+	}
+	target := NewGraph()
+	if err := (CypherImporter{}).Import(target, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if target.NumNodes() != 2 || target.NumEdges() != 1 || len(NodeSlice(target.FindNodes(NewStringSet("Tmp"), nil))) != 0 {
+		t.Errorf("Wrong import")
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrDiskGraph is the panic value when the property pages of a disk
+// graph cannot be read or written, or when a closed disk graph is
+// used
+type ErrDiskGraph struct {
+	Msg string
+}
+
+func (e ErrDiskGraph) Error() string { return "Disk graph error: " + e.Msg }
+
+// DiskGraphOptions are the options of a disk graph
+type DiskGraphOptions struct {
+	// Dir is the directory of the page file. If empty, a temporary
+	// directory is created, and removed when the graph is closed.
+	Dir string
+
+	// CacheSize is the maximum number of nodes and edges whose
+	// properties are kept in memory. If zero, DefaultDiskGraphCacheSize
+	// is used.
+	CacheSize int
+}
+
+// DefaultDiskGraphCacheSize is the default number of nodes and edges
+// whose properties are kept in memory by a disk graph
+const DefaultDiskGraphCacheSize = 100000
+
+const (
+	diskGraphPageFile = "properties.pages"
+	// The page file is compacted when it is larger than this, and
+	// more than half of it is unused
+	diskGraphMinCompactSize = 1 << 20
+	// The smallest cache size. The graph operations access a few
+	// nodes and edges at a time, so they must fit in the cache.
+	diskGraphMinCacheSize = 16
+)
+
+// NewDiskGraph returns a graph that keeps the properties of its nodes
+// and edges in a page file on disk, and caches the properties of the
+// recently used nodes and edges in memory. The graph has the same API
+// as a graph returned by NewGraph: properties are paged in when they
+// are accessed, and paged out when the cache is full, so iterators,
+// FindNodes, and pattern searches work unchanged.
+//
+// Node and edge objects, labels, edges of nodes, and indexes are kept
+// in memory, because they are referenced by the *Node and *Edge values
+// held by callers. So a disk graph is useful when properties make up
+// most of the graph. Property values that cannot be decoded exactly
+// by DecodeTypedJSONValue, such as PropertyValue, *Node, or values of
+// other types, are kept in memory with the rest of the properties of
+// the node or edge.
+//
+// Only the properties are paged: a disk graph does not reduce the
+// memory used by the structure of the graph.
+//
+// The page file is not a persistent store: it is truncated when the
+// graph is created, and removed by Close. Use PersistentGraph to
+// persist a graph. If the page file cannot be read or written, graph
+// operations panic with ErrDiskGraph.
+//
+// Like any graph, a disk graph can be read by multiple goroutines at
+// the same time if there are no writers. Reads page properties in and
+// out, so the pager is locked while it reads or writes the page file.
+// The page file is compacted only when properties are modified.
+func NewDiskGraph(opts DiskGraphOptions) (*Graph, error) {
+	dir := opts.Dir
+	removeDir := false
+	if len(dir) == 0 {
+		var err error
+		dir, err = os.MkdirTemp("", "lpg")
+		if err != nil {
+			return nil, err
+		}
+		removeDir = true
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, diskGraphPageFile), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		if removeDir {
+			os.RemoveAll(dir)
+		}
+		return nil, err
+	}
+	capacity := opts.CacheSize
+	if capacity == 0 {
+		capacity = DefaultDiskGraphCacheSize
+	}
+	if capacity < diskGraphMinCacheSize {
+		capacity = diskGraphMinCacheSize
+	}
+	g := NewGraph()
+	g.pager = &propertyPager{
+		g:         g,
+		dir:       dir,
+		removeDir: removeDir,
+		file:      file,
+		capacity:  capacity,
+		lru:       list.New(),
+	}
+	return g, nil
+}
+
+// IsDiskGraph returns true if the graph pages properties to disk
+func (g *Graph) IsDiskGraph() bool { return g.pager != nil }
+
+// Close releases the page file of a disk graph. The graph cannot be
+// used after it is closed. Close does nothing for other graphs.
+func (g *Graph) Close() error {
+	if g.pager == nil {
+		return nil
+	}
+	return g.pager.close()
+}
+
+// DiskGraphStats are the page statistics of a disk graph
+type DiskGraphStats struct {
+	// The number of nodes and edges whose properties are in memory
+	Cached int
+	// The number of nodes and edges whose properties are kept in
+	// memory because they cannot be paged out
+	Pinned int
+	// The size of the page file, and the size of the unused records in
+	// the page file
+	FileSize    int64
+	GarbageSize int64
+	// The number of records read and written
+	Reads  int
+	Writes int
+}
+
+// DiskGraphStats returns the page statistics of a disk graph. Returns
+// zero statistics for other graphs.
+func (g *Graph) DiskGraphStats() DiskGraphStats {
+	if g.pager == nil {
+		return DiskGraphStats{}
+	}
+	g.pager.mu.Lock()
+	defer g.pager.mu.Unlock()
+	ret := g.pager.stats
+	ret.Cached = g.pager.lru.Len()
+	ret.Pinned = g.pager.pinned
+	ret.FileSize = g.pager.size
+	ret.GarbageSize = g.pager.garbage
+	return ret
+}
+
+// propertyPage is the page state of the properties of a node or edge
+type propertyPage struct {
+	pager *propertyPager
+	// The position and size of the stored record in the page file. pos
+	// is -1 if the properties are not stored.
+	pos  int64
+	size int64
+	// If true, the properties in memory are not stored
+	dirty bool
+	// If true, the properties cannot be paged out
+	pinned bool
+	// The element of the LRU list while the properties are in memory
+	elem *list.Element
+}
+
+// propertyPager keeps the properties of the nodes and edges of a disk
+// graph in a page file. The page file is a sequence of records, each
+// with the length and the CRC of the payload, followed by the
+// properties encoded as JSON with EncodeTypedJSONValue. A modified
+// record is written at the end of the file, and the file is compacted
+// when most of it is unused.
+//
+// Concurrent readers of the graph page properties in and out, so mu
+// protects the pager, the page states, and the property maps of paged
+// nodes and edges.
+type propertyPager struct {
+	mu        sync.Mutex
+	g         *Graph
+	dir       string
+	removeDir bool
+	file      *os.File
+	// The size of the page file, and of the unused records
+	size    int64
+	garbage int64
+
+	capacity int
+	// Properties in memory that can be paged out, most recently used
+	// first
+	lru    *list.List
+	pinned int
+	stats  DiskGraphStats
+}
+
+func (pager *propertyPager) fail(err error) {
+	panic(ErrDiskGraph{Msg: err.Error()})
+}
+
+func (pager *propertyPager) checkOpen() {
+	if pager.file == nil {
+		panic(ErrDiskGraph{Msg: "Graph is closed"})
+	}
+}
+
+// attach starts paging the properties of a node or edge added to the
+// graph
+func (pager *propertyPager) attach(p *properties) {
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	pager.checkOpen()
+	p.page = &propertyPage{pager: pager, pos: -1}
+	if len(p.m) > 0 {
+		pager.setModified(p)
+	}
+}
+
+// detach loads the properties of a node or edge removed from the
+// graph, and stops paging them
+func (pager *propertyPager) detach(p *properties) {
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	pager.pageIn(p)
+	page := p.page
+	if page.elem != nil {
+		pager.lru.Remove(page.elem)
+	}
+	pager.unpin(page)
+	pager.release(page)
+	p.page = nil
+}
+
+func (pager *propertyPager) unpin(page *propertyPage) {
+	if page.pinned {
+		page.pinned = false
+		pager.pinned--
+	}
+}
+
+// release marks the stored record of the page as unused
+func (pager *propertyPager) release(page *propertyPage) {
+	if page.pos >= 0 {
+		pager.garbage += page.size
+		page.pos = -1
+		page.size = 0
+	}
+}
+
+// load reads the properties if they are paged out, marks them as
+// recently used, and returns them. The returned map is not modified by
+// the pager, so it can be used after it is paged out.
+func (pager *propertyPager) load(p *properties) map[string]any {
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	pager.pageIn(p)
+	return p.m
+}
+
+// pageIn reads the properties if they are paged out, and marks them as
+// recently used. Paging in may page out other properties, but it does
+// not compact the page file, so the records of the other nodes and
+// edges do not move while the graph is read.
+func (pager *propertyPager) pageIn(p *properties) {
+	page := p.page
+	if page.elem != nil {
+		pager.lru.MoveToFront(page.elem)
+		return
+	}
+	if page.pinned {
+		return
+	}
+	if p.m == nil {
+		if page.pos < 0 {
+			// No properties
+			return
+		}
+		pager.checkOpen()
+		m, err := pager.read(page.pos, page.size)
+		if err != nil {
+			pager.fail(err)
+		}
+		p.m = m
+		p.shared = false
+		page.dirty = false
+	}
+	page.elem = pager.lru.PushFront(p)
+	pager.evict()
+}
+
+// modified marks the properties as changed and recently used, and
+// compacts the page file if most of it is unused
+func (pager *propertyPager) modified(p *properties) {
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	pager.checkOpen()
+	pager.setModified(p)
+}
+
+func (pager *propertyPager) setModified(p *properties) {
+	page := p.page
+	page.dirty = true
+	pager.unpin(page)
+	if page.elem != nil {
+		pager.lru.MoveToFront(page.elem)
+	} else {
+		page.elem = pager.lru.PushFront(p)
+		pager.evict()
+	}
+	if pager.size > diskGraphMinCompactSize && pager.garbage > pager.size/2 {
+		pager.compact()
+	}
+}
+
+// evict pages out the least recently used properties until the cache
+// is within its capacity
+func (pager *propertyPager) evict() {
+	for pager.lru.Len() > pager.capacity {
+		elem := pager.lru.Back()
+		pager.lru.Remove(elem)
+		p := elem.Value.(*properties)
+		p.page.elem = nil
+		pager.pageOut(p)
+	}
+}
+
+// pageOut writes the properties if they are modified, and removes
+// them from memory
+func (pager *propertyPager) pageOut(p *properties) {
+	page := p.page
+	if page.dirty {
+		if len(p.m) == 0 {
+			pager.release(page)
+		} else {
+			data, ok := encodePropertyPage(p.m)
+			if !ok {
+				pager.release(page)
+				page.pinned = true
+				pager.pinned++
+				return
+			}
+			pager.release(page)
+			pos, err := pager.write(data)
+			if err != nil {
+				pager.fail(err)
+			}
+			page.pos = pos
+			page.size = int64(len(data))
+		}
+		page.dirty = false
+	}
+	// If the map is shared with a snapshot, the snapshot keeps it
+	p.m = nil
+	p.shared = false
+}
+
+// write appends the record to the page file, and returns its position
+func (pager *propertyPager) write(data []byte) (int64, error) {
+	pos := pager.size
+	if _, err := pager.file.WriteAt(data, pos); err != nil {
+		return 0, err
+	}
+	pager.size += int64(len(data))
+	pager.stats.Writes++
+	return pos, nil
+}
+
+// read reads and decodes the record at pos
+func (pager *propertyPager) read(pos, size int64) (map[string]any, error) {
+	data := make([]byte, size)
+	if _, err := pager.file.ReadAt(data, pos); err != nil {
+		return nil, err
+	}
+	pager.stats.Reads++
+	return decodePropertyPage(data)
+}
+
+// compact rewrites the page file with the stored records of the nodes
+// and edges of the graph
+func (pager *propertyPager) compact() {
+	tmpName := filepath.Join(pager.dir, diskGraphPageFile+".tmp")
+	tmp, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		pager.fail(err)
+	}
+	size := int64(0)
+	move := func(p *properties) {
+		page := p.page
+		if page == nil || page.pos < 0 {
+			return
+		}
+		data := make([]byte, page.size)
+		if _, err := pager.file.ReadAt(data, page.pos); err != nil {
+			tmp.Close()
+			pager.fail(err)
+		}
+		if _, err := tmp.WriteAt(data, size); err != nil {
+			tmp.Close()
+			pager.fail(err)
+		}
+		page.pos = size
+		size += page.size
+	}
+	for nodes := pager.g.GetNodes(); nodes.Next(); {
+		move(&nodes.Node().properties)
+	}
+	for edges := pager.g.GetEdges(); edges.Next(); {
+		move(&edges.Edge().properties)
+	}
+	pager.file.Close()
+	if err := os.Rename(tmpName, filepath.Join(pager.dir, diskGraphPageFile)); err != nil {
+		pager.file = tmp
+		pager.fail(err)
+	}
+	pager.file = tmp
+	pager.size = size
+	pager.garbage = 0
+}
+
+func (pager *propertyPager) close() error {
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	if pager.file == nil {
+		return nil
+	}
+	err := pager.file.Close()
+	pager.file = nil
+	if pager.removeDir {
+		if e := os.RemoveAll(pager.dir); err == nil {
+			err = e
+		}
+	} else if e := os.Remove(filepath.Join(pager.dir, diskGraphPageFile)); err == nil {
+		err = e
+	}
+	return err
+}
+
+var diskGraphCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// encodePropertyPage returns the record for the properties. Returns
+// false if a value cannot be paged out.
+func encodePropertyPage(m map[string]any) ([]byte, bool) {
+	values := make(map[string]json.RawMessage, len(m))
+	for k, v := range m {
+		if !isPageableValue(v) {
+			return nil, false
+		}
+		data, err := EncodeTypedJSONValue(v)
+		if err != nil {
+			return nil, false
+		}
+		values[k] = data
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return nil, false
+	}
+	buf := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, diskGraphCRCTable))
+	copy(buf[8:], payload)
+	return buf, true
+}
+
+func decodePropertyPage(data []byte) (map[string]any, error) {
+	if len(data) < 8 {
+		return nil, ErrDiskGraph{Msg: "Corrupt page"}
+	}
+	length := binary.LittleEndian.Uint32(data)
+	payload := data[8:]
+	if int(length) != len(payload) || crc32.Checksum(payload, diskGraphCRCTable) != binary.LittleEndian.Uint32(data[4:]) {
+		return nil, ErrDiskGraph{Msg: "Corrupt page"}
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]any, len(values))
+	for k, v := range values {
+		value, err := DecodeTypedJSONValue(v)
+		if err != nil {
+			return nil, err
+		}
+		ret[k] = value
+	}
+	return ret, nil
+}
+
+// isPageableValue returns true if the value is decoded with the same
+// Go type by DecodeTypedJSONValue
+func isPageableValue(value interface{}) bool {
+	switch t := value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64,
+		Point, Date, Duration, []int, []int64, []string, []float64, []bool:
+		return true
+	case time.Time:
+		// The location of the time is not stored
+		return t.Location() == time.UTC
+	case []interface{}:
+		for _, x := range t {
+			if !isPageableValue(x) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		for _, x := range t {
+			if !isPageableValue(x) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDiskGraph(t *testing.T) *Graph {
+	g, err := NewDiskGraph(DiskGraphOptions{Dir: t.TempDir(), CacheSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestDiskGraph(t *testing.T) {
+	g := newTestDiskGraph(t)
+	g.AddNodePropertyIndex("key", HashIndex)
+	tm := time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC)
+	var prev *Node
+	for i := 0; i < 1000; i++ {
+		node := g.NewNode([]string{"a"}, map[string]interface{}{
+			"key":  i,
+			"name": fmt.Sprint("n", i),
+			"time": tm,
+			"list": []string{"x", fmt.Sprint(i)},
+		})
+		if prev != nil {
+			g.NewEdge(prev, node, "next", map[string]interface{}{"w": float64(i)})
+		}
+		prev = node
+	}
+	stats := g.DiskGraphStats()
+	if stats.Cached > 16 || stats.Writes == 0 {
+		t.Errorf("Wrong stats: %+v", stats)
+	}
+
+	i := 0
+	for nodes := g.GetNodes(); nodes.Next(); i++ {
+		node := nodes.Node()
+		expected := map[string]interface{}{
+			"key":  i,
+			"name": fmt.Sprint("n", i),
+			"time": tm,
+			"list": []string{"x", fmt.Sprint(i)},
+		}
+		actual := map[string]interface{}{}
+		node.ForEachProperty(func(k string, v interface{}) bool {
+			actual[k] = v
+			return true
+		})
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Expecting %v, got %v", expected, actual)
+		}
+	}
+	for edges := g.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		w, _ := edge.GetProperty("w")
+		key, _ := edge.GetTo().GetProperty("key")
+		if w != float64(key.(int)) {
+			t.Errorf("Wrong edge property: %v %v", w, key)
+		}
+	}
+
+	// Indexed and unindexed lookups
+	if n := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 500})); len(n) != 1 {
+		t.Errorf("Expecting 1 node, got %d", len(n))
+	}
+	if n := NodeSlice(g.FindNodes(NewStringSet("a"), map[string]interface{}{"name": "n700"})); len(n) != 1 {
+		t.Errorf("Expecting 1 node, got %d", len(n))
+	}
+	if e := EdgeSlice(g.FindEdges(StringSet{}, map[string]interface{}{"w": float64(20)})); len(e) != 1 {
+		t.Errorf("Expecting 1 edge, got %d", len(e))
+	}
+	acc, err := Pattern{{Properties: map[string]interface{}{"key": 10}}, {Labels: NewStringSet("next"), Min: 1, Max: 1}, {}}.FindPaths(g, map[string]*PatternSymbol{})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(acc.Paths) != 1 {
+		t.Errorf("Expecting 1 path, got %d", len(acc.Paths))
+	} else if key, _ := acc.Paths[0].Last().GetProperty("key"); key != 11 {
+		t.Errorf("Wrong path: %v", key)
+	}
+
+	// Modifications of paged out properties
+	node := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 1}))[0]
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().GetProperty("key")
+	}
+	node.SetProperty("key", -1)
+	node.RemoveProperty("name")
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().GetProperty("key")
+	}
+	if v, _ := node.GetProperty("key"); v != -1 {
+		t.Errorf("Wrong value: %v", v)
+	}
+	if _, ok := node.GetProperty("name"); ok {
+		t.Errorf("Property not removed")
+	}
+	if n := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": -1})); len(n) != 1 {
+		t.Errorf("Expecting 1 node, got %d", len(n))
+	}
+
+	// Rollback
+	tx := g.Begin()
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().SetProperty("name", "x")
+	}
+	node.DetachAndRemove()
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+	if v, _ := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 900}))[0].GetProperty("name"); v != "n900" {
+		t.Errorf("Rollback failed: %v", v)
+	}
+	if v, _ := node.GetProperty("key"); v != -1 || g.NumNodes() != 1000 {
+		t.Errorf("Rollback failed: %v", v)
+	}
+
+	// Removed nodes keep their properties
+	node.DetachAndRemove()
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().GetProperty("key")
+	}
+	if v, _ := node.GetProperty("key"); v != -1 {
+		t.Errorf("Wrong value of removed node: %v", v)
+	}
+
+	// Snapshots are not affected by paging
+	snap := g.Snapshot()
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().SetProperty("name", "y")
+	}
+	if n := NodeSlice(snap.FindNodes(StringSet{}, map[string]interface{}{"name": "n900"})); len(n) != 1 {
+		t.Errorf("Expecting 1 node in snapshot, got %d", len(n))
+	}
+}
+
+func TestDiskGraphUnpageableValues(t *testing.T) {
+	type custom struct{ X int }
+	g := newTestDiskGraph(t)
+	local := time.Date(2021, 1, 2, 3, 4, 5, 0, time.FixedZone("x", 3600))
+	n1 := g.NewNode(nil, map[string]interface{}{"value": custom{X: 1}})
+	n2 := g.NewNode(nil, map[string]interface{}{"value": local})
+	for i := 0; i < 100; i++ {
+		g.NewNode(nil, map[string]interface{}{"key": i})
+	}
+	if stats := g.DiskGraphStats(); stats.Pinned != 2 {
+		t.Errorf("Expecting 2 pinned, got %+v", stats)
+	}
+	if v, _ := n1.GetProperty("value"); v != (custom{X: 1}) {
+		t.Errorf("Wrong value: %v", v)
+	}
+	if v, _ := n2.GetProperty("value"); v != local {
+		t.Errorf("Wrong value: %v", v)
+	}
+	// The properties can be paged out once the value is removed
+	n1.RemoveProperty("value")
+	n2.SetProperty("value", local.UTC())
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().GetProperty("key")
+	}
+	if stats := g.DiskGraphStats(); stats.Pinned != 0 {
+		t.Errorf("Expecting 0 pinned, got %+v", stats)
+	}
+	if v, _ := n2.GetProperty("value"); v != local.UTC() {
+		t.Errorf("Wrong value: %v", v)
+	}
+}
+
+func TestDiskGraphCompaction(t *testing.T) {
+	dir := t.TempDir()
+	g, err := NewDiskGraph(DiskGraphOptions{Dir: dir, CacheSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make([]*Node, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		nodes = append(nodes, g.NewNode(nil, map[string]interface{}{"key": i}))
+	}
+	for round := 0; round < 5; round++ {
+		value := strings.Repeat(fmt.Sprint(round), 1000)
+		for _, node := range nodes {
+			node.SetProperty("value", value)
+		}
+	}
+	stats := g.DiskGraphStats()
+	if stats.FileSize > 3*1000*1100 {
+		t.Errorf("Page file not compacted: %+v", stats)
+	}
+	value := strings.Repeat("4", 1000)
+	for i, node := range nodes {
+		if v, _ := node.GetProperty("value"); v != value {
+			t.Errorf("Wrong value: %v", v)
+		}
+		if v, _ := node.GetProperty("key"); v != i {
+			t.Errorf("Wrong key: %v", v)
+		}
+	}
+	if err := g.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, diskGraphPageFile)); !os.IsNotExist(err) {
+		t.Errorf("Page file not removed: %v", err)
+	}
+	func() {
+		defer func() {
+			if _, ok := recover().(ErrDiskGraph); !ok {
+				t.Errorf("Expecting disk graph panic")
+			}
+		}()
+		nodes[0].GetProperty("key")
+	}()
+}
+
+func TestDiskGraphConcurrentReads(t *testing.T) {
+	g := newTestDiskGraph(t)
+	for i := 0; i < 1000; i++ {
+		g.NewNode(nil, map[string]interface{}{"key": i, "value": strings.Repeat("x", 2000)})
+	}
+	for nodes := g.GetNodes(); nodes.Next(); {
+		key, _ := nodes.Node().GetProperty("key")
+		if key.(int)%4 != 0 {
+			nodes.Node().RemoveProperty("value")
+		}
+	}
+	before := g.DiskGraphStats()
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 8)
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < 3; round++ {
+				i := 0
+				for nodes := g.GetNodes(); nodes.Next(); i++ {
+					if key, _ := nodes.Node().GetProperty("key"); key != i {
+						errs <- fmt.Errorf("Wrong key: %v %d", key, i)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	// Reads may write modified properties, but they do not compact
+	if after := g.DiskGraphStats(); after.FileSize < before.FileSize || after.GarbageSize < before.GarbageSize {
+		t.Errorf("Page file compacted by reads: %+v %+v", before, after)
+	}
+}
@@ -17,6 +17,8 @@ package lpg
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 )
 
 // DOTRenderer renders a graph in Graphviz dot format
@@ -26,27 +28,55 @@ type DOTRenderer struct {
 	// EdgeRenderer renders an edge. The from and to nodes are rendered
 	// if this is called. If the edge is to be excluded, returns false
 	EdgeRenderer func(fromID string, toID string, edge *Edge, w io.Writer) (bool, error)
+
+	// GraphAttributes are written at the beginning of the graph. If
+	// nil, rankdir=LR is used.
+	GraphAttributes map[string]string
+
+	// If Style is set, the default node and edge renderers use it to
+	// render nodes and edges, and nodes are grouped into clusters
+	// based on the style.
+	Style *DOTStyle
 }
 
 // RenderNode renders a node. If node renderer is not set, calls the default renderer
 func (d DOTRenderer) RenderNode(ID string, node *Node, w io.Writer) (bool, error) {
-	if d.NodeRenderer == nil {
-		return true, DefaultDOTNodeRender(ID, node, w)
-	}
-	return d.NodeRenderer(ID, node, w)
+	return d.renderNode(ID, node, false, w)
 }
 
 // RenderEdge renders an edge. If edge renderer is not set, call the default rendeded
 func (d DOTRenderer) RenderEdge(fromID, toID string, edge *Edge, w io.Writer) (bool, error) {
-	if d.EdgeRenderer == nil {
-		return true, DefaultDOTEdgeRender(fromID, toID, edge, w)
+	return d.renderEdge(fromID, toID, edge, false, w)
+}
+
+func (d DOTRenderer) renderNode(ID string, node *Node, highlighted bool, w io.Writer) (bool, error) {
+	if d.NodeRenderer != nil {
+		return d.NodeRenderer(ID, node, w)
+	}
+	if d.Style != nil {
+		return true, d.Style.RenderNode(ID, node, highlighted, w)
+	}
+	if highlighted {
+		return true, (&DOTStyle{}).RenderNode(ID, node, true, w)
+	}
+	return true, DefaultDOTNodeRender(ID, node, w)
+}
+
+func (d DOTRenderer) renderEdge(fromID, toID string, edge *Edge, highlighted bool, w io.Writer) (bool, error) {
+	if d.EdgeRenderer != nil {
+		return d.EdgeRenderer(fromID, toID, edge, w)
 	}
-	return d.EdgeRenderer(fromID, toID, edge, w)
+	if d.Style != nil {
+		return true, d.Style.RenderEdge(fromID, toID, edge, highlighted, w)
+	}
+	if highlighted {
+		return true, (&DOTStyle{}).RenderEdge(fromID, toID, edge, true, w)
+	}
+	return true, DefaultDOTEdgeRender(fromID, toID, edge, w)
 }
 
-// DefaultDOTNodeRender renders the node with the given ID. If the
-// node has a label, it uses that label, otherwise node is not
-// labeled.
+// DefaultDOTNodeRender renders the node with the given ID, without a
+// label. Use a DOTStyle to render node labels and properties.
 func DefaultDOTNodeRender(ID string, node *Node, w io.Writer) error {
 	_, err := fmt.Fprintf(w, "  %s;\n", ID)
 	return err
@@ -57,7 +87,7 @@ func DefaultDOTNodeRender(ID string, node *Node, w io.Writer) error {
 func DefaultDOTEdgeRender(fromNode, toNode string, edge *Edge, w io.Writer) error {
 	lbl := edge.GetLabel()
 	if len(lbl) != 0 {
-		if _, err := fmt.Fprintf(w, "  %s -> %s [label=\"%s\"];\n", fromNode, toNode, lbl); err != nil {
+		if _, err := fmt.Fprintf(w, "  %s -> %s [label=\"%s\"];\n", fromNode, toNode, EscapeDOTString(lbl)); err != nil {
 			return err
 		}
 	} else {
@@ -68,46 +98,210 @@ func DefaultDOTEdgeRender(fromNode, toNode string, edge *Edge, w io.Writer) erro
 	return nil
 }
 
+// RenderNodesEdges renders the nodes and edges of the graph, without
+// the graph header
 func (d DOTRenderer) RenderNodesEdges(g *Graph, out io.Writer) error {
-	// Give nodes unique IDs for the graph
+	return d.renderNodesEdges(NodeSlice(g.GetNodes()), EdgeSlice(g.GetEdges()), nil, nil, out)
+}
+
+// renderNodesEdges renders the given nodes, and the edges among them,
+// grouping nodes into clusters if there is a style.
+func (d DOTRenderer) renderNodesEdges(nodes []*Node, edges []*Edge, highlightNodes map[*Node]struct{}, highlightEdges map[*Edge]struct{}, out io.Writer) error {
 	nodeMap := map[*Node]string{}
 	x := 0
+	renderNodes := func(nodes []*Node) error {
+		for _, node := range nodes {
+			nodeId := fmt.Sprintf("n%d", x)
+			_, highlighted := highlightNodes[node]
+			rendered, err := d.renderNode(nodeId, node, highlighted, out)
+			if err != nil {
+				return err
+			}
+			if rendered {
+				x++
+				nodeMap[node] = nodeId
+			}
+		}
+		return nil
+	}
+
+	if d.Style != nil && (len(d.Style.ClusterByLabels) > 0 || len(d.Style.ClusterByProperty) > 0) {
+		clusterOrder := make([]string, 0)
+		clusters := make(map[string][]*Node)
+		unclustered := make([]*Node, 0)
+		for _, node := range nodes {
+			c := d.Style.cluster(node)
+			if len(c) == 0 {
+				unclustered = append(unclustered, node)
+				continue
+			}
+			if _, exists := clusters[c]; !exists {
+				clusterOrder = append(clusterOrder, c)
+			}
+			clusters[c] = append(clusters[c], node)
+		}
+		for i, c := range clusterOrder {
+			if _, err := fmt.Fprintf(out, "subgraph cluster_%d {\n  label=\"%s\";\n", i, EscapeDOTString(c)); err != nil {
+				return err
+			}
+			if err := renderNodes(clusters[c]); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(out, "}\n"); err != nil {
+				return err
+			}
+		}
+		nodes = unclustered
+	}
+	if err := renderNodes(nodes); err != nil {
+		return err
+	}
+
+	for _, edge := range edges {
+		fromNodeId, ok1 := nodeMap[edge.GetFrom()]
+		toNodeId, ok2 := nodeMap[edge.GetTo()]
+		if ok1 && ok2 {
+			_, highlighted := highlightEdges[edge]
+			if _, err := d.renderEdge(fromNodeId, toNodeId, edge, highlighted, out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderGraphNodesEdges gives the nodes of the graph unique IDs using the
+// prefix, and calls renderNode for each node. Then it calls
+// renderEdge for the edges whose endpoints are both rendered. If
+// maxNodes or maxEdges are positive, rendering stops after that many
+// nodes or edges are rendered. Returns the number of nodes and edges
+// omitted because of these limits.
+func renderGraphNodesEdges(g *Graph, prefix string, maxNodes, maxEdges int, renderNode func(string, *Node) (bool, error), renderEdge func(string, string, *Edge) (bool, error)) (int, int, error) {
+	nodeMap := map[*Node]string{}
+	x := 0
+	omittedNodes := 0
 	for itr := g.GetNodes(); itr.Next(); {
+		if maxNodes > 0 && x >= maxNodes {
+			omittedNodes++
+			continue
+		}
 		node := itr.Node()
-		nodeId := fmt.Sprintf("n%d", x)
-		rendered, err := d.RenderNode(nodeId, node, out)
+		nodeId := fmt.Sprintf("%s%d", prefix, x)
+		rendered, err := renderNode(nodeId, node)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
 		if rendered {
 			x++
 			nodeMap[node] = nodeId
 		}
 	}
+	nEdges := 0
+	omittedEdges := 0
 	for edgeItr := g.GetEdges(); edgeItr.Next(); {
 		edge := edgeItr.Edge()
 		fromNodeId, ok1 := nodeMap[edge.GetFrom()]
 		toNodeId, ok2 := nodeMap[edge.GetTo()]
 		if ok1 && ok2 {
-			_, err := d.RenderEdge(fromNodeId, toNodeId, edge, out)
+			if maxEdges > 0 && nEdges >= maxEdges {
+				omittedEdges++
+				continue
+			}
+			rendered, err := renderEdge(fromNodeId, toNodeId, edge)
 			if err != nil {
-				return err
+				return 0, 0, err
+			}
+			if rendered {
+				nEdges++
 			}
 		}
 	}
-	return nil
+	return omittedNodes, omittedEdges, nil
+}
+
+// displayLabels returns the labels as :l1:l2
+func displayLabels(labels StringSet) string {
+	sb := strings.Builder{}
+	for _, l := range labels.SortedSlice() {
+		sb.WriteRune(':')
+		sb.WriteString(l)
+	}
+	return sb.String()
+}
+
+// displayProperties returns "key: value" strings for the given
+// property keys that exist in p
+func displayProperties(p WithProperties, keys []string) []string {
+	ret := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v, ok := p.GetProperty(k)
+		if !ok {
+			continue
+		}
+		ret = append(ret, fmt.Sprintf("%s: %v", k, v))
+	}
+	return ret
 }
 
 // Render writes a DOT graph with the given name
 func (d DOTRenderer) Render(g *Graph, graphName string, out io.Writer) error {
+	return d.render(graphName, NodeSlice(g.GetNodes()), EdgeSlice(g.GetEdges()), nil, nil, out)
+}
+
+// RenderNodes writes a DOT graph containing the given nodes, and the
+// nodes that are at most hops edges away from them. The given nodes
+// are highlighted. Only the edges between the rendered nodes are
+// included.
+func (d DOTRenderer) RenderNodes(nodes []*Node, hops int, graphName string, out io.Writer) error {
+	highlight := make(map[*Node]struct{}, len(nodes))
+	for _, node := range nodes {
+		highlight[node] = struct{}{}
+	}
+	all := Neighborhood(nodes, hops, AnyEdge)
+	return d.render(graphName, all.Slice(), InducedEdges(all), highlight, nil, out)
+}
+
+// RenderPath writes a DOT graph containing the nodes of the path,
+// and the nodes that are at most hops edges away from the path. The
+// nodes and edges of the path are highlighted.
+func (d DOTRenderer) RenderPath(path *Path, hops int, graphName string, out io.Writer) error {
+	highlightNodes := make(map[*Node]struct{})
+	highlightEdges := make(map[*Edge]struct{})
+	nodes := make([]*Node, 0, path.NumNodes())
+	for i := 0; i < path.NumNodes(); i++ {
+		node := path.GetNode(i)
+		highlightNodes[node] = struct{}{}
+		nodes = append(nodes, node)
+	}
+	for i := 0; i < path.NumEdges(); i++ {
+		highlightEdges[path.GetEdge(i)] = struct{}{}
+	}
+	all := Neighborhood(nodes, hops, AnyEdge)
+	return d.render(graphName, all.Slice(), InducedEdges(all), highlightNodes, highlightEdges, out)
+}
+
+func (d DOTRenderer) render(graphName string, nodes []*Node, edges []*Edge, highlightNodes map[*Node]struct{}, highlightEdges map[*Edge]struct{}, out io.Writer) error {
 	if _, err := fmt.Fprintf(out, "digraph %s {\n", graphName); err != nil {
 		return err
 	}
-	if _, err := fmt.Fprintf(out, "rankdir=\"LR\";\n"); err != nil {
-		return err
+	if d.GraphAttributes == nil {
+		if _, err := fmt.Fprintf(out, "rankdir=\"LR\";\n"); err != nil {
+			return err
+		}
+	} else {
+		keys := make([]string, 0, len(d.GraphAttributes))
+		for k := range d.GraphAttributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(out, "%s=\"%s\";\n", k, EscapeDOTString(d.GraphAttributes[k])); err != nil {
+				return err
+			}
+		}
 	}
 
-	if err := d.RenderNodesEdges(g, out); err != nil {
+	if err := d.renderNodesEdges(nodes, edges, highlightNodes, highlightEdges, out); err != nil {
 		return err
 	}
 
@@ -0,0 +1,102 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDOTStyle(t *testing.T) {
+	g := getRendererTestGraph()
+	style := &DOTStyle{
+		Properties: []string{"name"},
+		NodeRules: []DOTRule{
+			{Attributes: map[string]string{"shape": "box"}},
+			{Label: "Company", Attributes: map[string]string{"shape": "ellipse", "color": "blue"}, LabelTemplate: `<b>{{.Properties.name}}</b>`, HTMLLabel: true},
+		},
+		EdgeRules: []DOTRule{
+			{Label: "WORKS_AT", Attributes: map[string]string{"style": "dashed"}},
+		},
+		ClusterByLabels: []string{"Person"},
+	}
+	buf := bytes.Buffer{}
+	if err := (DOTRenderer{Style: style, GraphAttributes: map[string]string{"rankdir": "TB"}}).Render(g, "g", &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	out := buf.String()
+	for _, s := range []string{
+		`rankdir="TB";`,
+		"subgraph cluster_0 {\n  label=\"Person\";\n  n0 [label=\":Person\\nname: John \\\"J\\\" <Doe>\", shape=\"box\"];\n}",
+		`n1 [label=<<b>Acme &amp; Co</b>>, color="blue", shape="ellipse"];`,
+		`n2 [label="n2", shape="box"];`,
+		`n0 -> n1 [label="WORKS_AT\nname: x", style="dashed"];`,
+		`n1 -> n2;`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Missing %s in %s", s, out)
+		}
+	}
+}
+
+func TestDOTLabelEscaping(t *testing.T) {
+	g := NewGraph()
+	g.NewNode([]string{"A"}, map[string]interface{}{"name": "<b>x"})
+	g.NewNode([]string{"B"}, map[string]interface{}{"name": "<b>x"})
+	style := &DOTStyle{
+		NodeRules: []DOTRule{
+			{Label: "A", LabelTemplate: `{{.Properties.name}}>`},
+			{Label: "B", LabelTemplate: `<i>{{.Properties.name}}</i>`, HTMLLabel: true},
+		},
+	}
+	buf := bytes.Buffer{}
+	if err := (DOTRenderer{Style: style}).Render(g, "g", &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	// Only opted-in labels are HTML, and node data is escaped
+	for _, s := range []string{`n0 [label="<b>x>"];`, `n1 [label=<<i>&lt;b&gt;x</i>>];`} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Missing %s in %s", s, buf.String())
+		}
+	}
+}
+
+func TestDOTRenderPath(t *testing.T) {
+	g := NewGraph()
+	nodes := make([]*Node, 0)
+	for i := 0; i < 6; i++ {
+		nodes = append(nodes, g.NewNode([]string{"a"}, nil))
+	}
+	edges := make([]*Edge, 0)
+	for i := 0; i < 5; i++ {
+		edges = append(edges, g.NewEdge(nodes[i], nodes[i+1], "next", nil))
+	}
+	path := NewPathFromElements(NewPathElementsFromEdges(edges[2:3])...)
+	buf := bytes.Buffer{}
+	if err := (DOTRenderer{}).RenderPath(path, 1, "g", &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	out := buf.String()
+	if strings.Count(out, "->") != 3 {
+		t.Errorf("Expecting 3 edges: %s", out)
+	}
+	if strings.Count(out, `color="red"`) != 3 {
+		t.Errorf("Expecting 2 highlighted nodes and one edge: %s", out)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DOTStyle declares how nodes and edges are rendered by the default
+// DOT node and edge renderers.
+//
+// Node rules are matched against node labels, and edge rules are
+// matched against edge labels. All matching rules are applied in
+// order, so attributes of a later rule override the attributes of
+// earlier rules.
+type DOTStyle struct {
+	// Properties are the property keys shown in node and edge labels
+	// if there is no label template
+	Properties []string
+
+	NodeRules []DOTRule
+	EdgeRules []DOTRule
+
+	// If ClusterByLabels is nonempty, nodes are grouped into clusters
+	// by the first label of the list they have
+	ClusterByLabels []string
+
+	// If ClusterByProperty is nonempty, nodes are grouped into
+	// clusters by the value of this property
+	ClusterByProperty string
+
+	// HighlightAttributes are used for highlighted nodes and edges. If
+	// nil, color=red and penwidth=2 is used.
+	HighlightAttributes map[string]string
+
+	templateMu sync.Mutex
+	templates  map[dotTemplateKey]dotTemplate
+}
+
+// DOTRule sets the attributes of the nodes or edges with a label.
+type DOTRule struct {
+	// Label is the node or edge label the rule applies to. If empty,
+	// the rule applies to all nodes or edges.
+	Label string
+
+	// Attributes are the DOT attributes, such as shape, color,
+	// fillcolor, and style
+	Attributes map[string]string
+
+	// LabelTemplate is a text/template that is executed with
+	// DOTTemplateData to produce the node or edge label. The label is
+	// escaped and written as a quoted string.
+	LabelTemplate string
+
+	// If HTMLLabel is true, LabelTemplate is an html/template that
+	// produces the markup of a DOT HTML label, without the enclosing
+	// <>. The values inserted by the template are escaped, so node and
+	// edge data cannot change the markup.
+	HTMLLabel bool
+}
+
+// DOTTemplateData is passed to DOT label templates
+type DOTTemplateData struct {
+	ID         string
+	Labels     []string
+	Label      string
+	Properties map[string]interface{}
+	Node       *Node
+	Edge       *Edge
+}
+
+var defaultDOTHighlightAttributes = map[string]string{"color": "red", "penwidth": "2"}
+
+// EscapeDOTString escapes s so it can be used in a quoted DOT string
+func EscapeDOTString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+// dotTemplate is a text/template or an html/template
+type dotTemplate interface {
+	Execute(io.Writer, interface{}) error
+}
+
+type dotTemplateKey struct {
+	template string
+	html     bool
+}
+
+func (style *DOTStyle) getTemplate(key dotTemplateKey) (dotTemplate, error) {
+	style.templateMu.Lock()
+	defer style.templateMu.Unlock()
+	if t, ok := style.templates[key]; ok {
+		return t, nil
+	}
+	var t dotTemplate
+	var err error
+	if key.html {
+		t, err = htmltemplate.New("").Parse(key.template)
+	} else {
+		t, err = template.New("").Parse(key.template)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if style.templates == nil {
+		style.templates = make(map[dotTemplateKey]dotTemplate)
+	}
+	style.templates[key] = t
+	return t, nil
+}
+
+// apply the matching rules, and return the attributes and the label
+// template
+func (style *DOTStyle) apply(rules []DOTRule, match func(string) bool, highlighted bool) (map[string]string, dotTemplateKey) {
+	attributes := make(map[string]string)
+	labelTemplate := dotTemplateKey{}
+	for _, rule := range rules {
+		if len(rule.Label) > 0 && !match(rule.Label) {
+			continue
+		}
+		for k, v := range rule.Attributes {
+			attributes[k] = v
+		}
+		if len(rule.LabelTemplate) > 0 {
+			labelTemplate = dotTemplateKey{template: rule.LabelTemplate, html: rule.HTMLLabel}
+		}
+	}
+	if highlighted {
+		hl := style.HighlightAttributes
+		if hl == nil {
+			hl = defaultDOTHighlightAttributes
+		}
+		for k, v := range hl {
+			attributes[k] = v
+		}
+	}
+	return attributes, labelTemplate
+}
+
+func (style *DOTStyle) label(labelTemplate dotTemplateKey, data DOTTemplateData, defaultLabel func() string) (string, error) {
+	if len(labelTemplate.template) == 0 {
+		return `"` + EscapeDOTString(defaultLabel()) + `"`, nil
+	}
+	tmpl, err := style.getTemplate(labelTemplate)
+	if err != nil {
+		return "", err
+	}
+	sb := strings.Builder{}
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	if labelTemplate.html {
+		return "<" + sb.String() + ">", nil
+	}
+	return `"` + EscapeDOTString(sb.String()) + `"`, nil
+}
+
+func writeDOTAttributes(w io.Writer, label string, attributes map[string]string) error {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		if k != "label" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	items := make([]string, 0, len(keys)+1)
+	if len(label) > 0 {
+		items = append(items, "label="+label)
+	}
+	for _, k := range keys {
+		items = append(items, fmt.Sprintf("%s=\"%s\"", k, EscapeDOTString(attributes[k])))
+	}
+	if len(items) == 0 {
+		_, err := io.WriteString(w, ";\n")
+		return err
+	}
+	_, err := io.WriteString(w, " ["+strings.Join(items, ", ")+"];\n")
+	return err
+}
+
+// RenderNode renders the node using the style
+func (style *DOTStyle) RenderNode(ID string, node *Node, highlighted bool, w io.Writer) error {
+	attributes, labelTemplate := style.apply(style.NodeRules, node.HasLabel, highlighted)
+	props := make(map[string]interface{})
+	node.ForEachProperty(func(k string, v interface{}) bool {
+		props[k] = v
+		return true
+	})
+	label, err := style.label(labelTemplate, DOTTemplateData{
+		ID:         ID,
+		Labels:     node.labels.SortedSlice(),
+		Properties: props,
+		Node:       node,
+	}, func() string {
+		lines := []string{displayLabels(node.labels)}
+		if len(lines[0]) == 0 {
+			lines[0] = ID
+		}
+		return strings.Join(append(lines, displayProperties(node, style.Properties)...), "\n")
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "  %s", ID); err != nil {
+		return err
+	}
+	return writeDOTAttributes(w, label, attributes)
+}
+
+// RenderEdge renders the edge using the style
+func (style *DOTStyle) RenderEdge(fromID, toID string, edge *Edge, highlighted bool, w io.Writer) error {
+	attributes, labelTemplate := style.apply(style.EdgeRules, func(s string) bool { return s == edge.label }, highlighted)
+	props := make(map[string]interface{})
+	edge.ForEachProperty(func(k string, v interface{}) bool {
+		props[k] = v
+		return true
+	})
+	label, err := style.label(labelTemplate, DOTTemplateData{
+		Label:      edge.label,
+		Properties: props,
+		Edge:       edge,
+	}, func() string {
+		lines := make([]string, 0, len(style.Properties)+1)
+		if len(edge.label) > 0 {
+			lines = append(lines, edge.label)
+		}
+		return strings.Join(append(lines, displayProperties(edge, style.Properties)...), "\n")
+	})
+	if err != nil {
+		return err
+	}
+	if label == `""` {
+		label = ""
+	}
+	if _, err := fmt.Fprintf(w, "  %s -> %s", fromID, toID); err != nil {
+		return err
+	}
+	return writeDOTAttributes(w, label, attributes)
+}
+
+// cluster returns the cluster name for the node, or empty string if
+// the node is not in a cluster
+func (style *DOTStyle) cluster(node *Node) string {
+	for _, l := range style.ClusterByLabels {
+		if node.HasLabel(l) {
+			return l
+		}
+	}
+	if len(style.ClusterByProperty) > 0 {
+		if v, ok := node.GetProperty(style.ClusterByProperty); ok {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
@@ -29,6 +29,9 @@ type Edge struct {
 	// 1: outgoing edges list
 	// 2: incoming edges list
 	listElements [3]edgeElement
+
+	// User-defined unique key, if nonempty
+	externalID string
 }
 
 // EdgeDir is used to show edge direction
@@ -61,17 +64,20 @@ func (edge *Edge) GetTo() *Node { return edge.to }
 // SetLabel sets the edge label
 func (edge *Edge) SetLabel(label string) {
 	if label != edge.label {
+		defer edge.from.graph.endMutation(edge.from.graph.mutation(), nil)
 		edge.from.graph.setEdgeLabel(edge, label)
 	}
 }
 
 // SetProperty sets an edge property
 func (edge *Edge) SetProperty(key string, value interface{}) {
+	defer edge.from.graph.endMutation(edge.from.graph.mutation(), nil)
 	edge.from.graph.setEdgeProperty(edge, key, value)
 }
 
 // RemoveProperty removes an edge property
 func (edge *Edge) RemoveProperty(key string) {
+	defer edge.from.graph.endMutation(edge.from.graph.mutation(), nil)
 	edge.from.graph.removeEdgeProperty(edge, key)
 }
 
@@ -86,12 +92,13 @@ func (edge *Edge) ForEachProperty(f func(string, interface{}) bool) bool {
 
 // Remove an edge
 func (edge *Edge) Remove() {
+	defer edge.from.graph.endMutation(edge.from.graph.mutation(), nil)
 	edge.from.graph.removeEdge(edge)
 }
 
 // Returns the string representation of an edge
 func (edge *Edge) String() string {
-	return fmt.Sprintf("[:%s %s]", edge.label, edge.properties)
+	return fmt.Sprintf("[:%s %s]", edge.label, &edge.properties)
 }
 
 func (edge *Edge) MarshalJSON() ([]byte, error) {
@@ -106,6 +106,36 @@ func (em *edgeMap) isEmpty() bool { return em.n == 0 }
 
 func (em *edgeMap) size() int { return em.n }
 
+// sizeLabel returns the number of edges with the label
+func (em *edgeMap) sizeLabel(label string) int {
+	if em.n == 0 {
+		return 0
+	}
+	if em.n == 1 {
+		if em.only.label == label {
+			return 1
+		}
+		return 0
+	}
+	if el := em.labelMap[label]; el != nil {
+		return el.Value.(*edgeLabelList).edges.n
+	}
+	return 0
+}
+
+// labels returns the labels of the edges
+func (em *edgeMap) labels() StringSet {
+	ret := NewStringSet()
+	if em.n == 1 {
+		ret.Add(em.only.label)
+	} else if em.n > 1 {
+		for label := range em.labelMap {
+			ret.Add(label)
+		}
+	}
+	return ret
+}
+
 type singleEdgeIterator struct {
 	edge *Edge
 	done bool
@@ -168,7 +198,11 @@ func (em edgeMap) iteratorAnyLabel(labels StringSet, listIndex int) EdgeIterator
 		return edgeIterator{emptyIterator{}}
 	}
 	strings := labels.Slice()
-	return edgeIterator{&funcIterator{
+	size := 0
+	for _, label := range strings {
+		size += em.sizeLabel(label)
+	}
+	return edgeIterator{withSize(&funcIterator{
 		iteratorFunc: func() Iterator {
 			for len(strings) != 0 {
 				if _, found := em.labelMap[strings[0]]; !found {
@@ -181,8 +215,7 @@ func (em edgeMap) iteratorAnyLabel(labels StringSet, listIndex int) EdgeIterator
 			}
 			return nil
 		},
-	},
-	}
+	}, size)}
 }
 
 type allEdgesItr struct {
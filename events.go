@@ -0,0 +1,348 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+)
+
+// GraphEventType is the type of a graph mutation event
+type GraphEventType int
+
+const (
+	// A node is created. The event has NodeID, Labels, Properties, and
+	// ExternalID
+	NodeCreatedEvent GraphEventType = iota
+	// A node is removed. The event has NodeID, Labels, Properties, and
+	// ExternalID. The edges of the node are removed before the node.
+	NodeRemovedEvent
+	// The labels of a node changed. The event has NodeID, Labels, and
+	// OldLabels
+	NodeLabelsChangedEvent
+	// A node property is set. The event has NodeID, Key, Value,
+	// OldValue, and HasOldValue
+	NodePropertySetEvent
+	// A node property is removed. The event has NodeID, Key, and
+	// OldValue
+	NodePropertyRemovedEvent
+	// The external ID of a node changed. The event has NodeID,
+	// ExternalID, and OldExternalID
+	NodeExternalIDChangedEvent
+	// An edge is created. The event has EdgeID, FromID, ToID, Label,
+	// Properties, and ExternalID
+	EdgeCreatedEvent
+	// An edge is removed. The event has EdgeID, FromID, ToID, Label,
+	// Properties, and ExternalID
+	EdgeRemovedEvent
+	// The label of an edge changed. The event has EdgeID, Label, and
+	// OldLabel
+	EdgeRelabeledEvent
+	// An edge property is set. The event has EdgeID, Key, Value,
+	// OldValue, and HasOldValue
+	EdgePropertySetEvent
+	// An edge property is removed. The event has EdgeID, Key, and
+	// OldValue
+	EdgePropertyRemovedEvent
+	// The external ID of an edge changed. The event has EdgeID,
+	// ExternalID, and OldExternalID
+	EdgeExternalIDChangedEvent
+)
+
+var graphEventTypeNames = []string{
+	"nodeCreated",
+	"nodeRemoved",
+	"nodeLabelsChanged",
+	"nodePropertySet",
+	"nodePropertyRemoved",
+	"nodeExternalIDChanged",
+	"edgeCreated",
+	"edgeRemoved",
+	"edgeRelabeled",
+	"edgePropertySet",
+	"edgePropertyRemoved",
+	"edgeExternalIDChanged",
+}
+
+func (t GraphEventType) String() string {
+	if t >= 0 && int(t) < len(graphEventTypeNames) {
+		return graphEventTypeNames[t]
+	}
+	return fmt.Sprintf("GraphEventType(%d)", int(t))
+}
+
+// GraphEvent describes a mutation of a graph. The fields used by an
+// event depend on the event type.
+//
+// The event contains copies of the labels and properties, so it
+// describes the mutation even if the node or edge is modified
+// later. The Node and Edge fields point to the live objects.
+type GraphEvent struct {
+	Type GraphEventType
+
+	// The node for node events, nil for edge events
+	Node *Node
+	// The edge for edge events, nil for node events
+	Edge *Edge
+
+	NodeID int
+	EdgeID int
+	FromID int
+	ToID   int
+
+	Labels    StringSet
+	OldLabels StringSet
+	Label     string
+	OldLabel  string
+
+	Properties map[string]interface{}
+
+	Key         string
+	Value       interface{}
+	OldValue    interface{}
+	HasOldValue bool
+
+	ExternalID    string
+	OldExternalID string
+}
+
+func (e GraphEvent) String() string {
+	switch e.Type {
+	case NodeCreatedEvent, NodeRemovedEvent:
+		return fmt.Sprintf("%s %d (%s) %v", e.Type, e.NodeID, displayLabels(e.Labels), e.Properties)
+	case NodeLabelsChangedEvent:
+		return fmt.Sprintf("%s %d %s -> %s", e.Type, e.NodeID, displayLabels(e.OldLabels), displayLabels(e.Labels))
+	case NodePropertySetEvent, NodePropertyRemovedEvent:
+		return fmt.Sprintf("%s %d %s: %v -> %v", e.Type, e.NodeID, e.Key, e.OldValue, e.Value)
+	case NodeExternalIDChangedEvent:
+		return fmt.Sprintf("%s %d %q -> %q", e.Type, e.NodeID, e.OldExternalID, e.ExternalID)
+	case EdgeCreatedEvent, EdgeRemovedEvent:
+		return fmt.Sprintf("%s %d (%d)-[:%s]->(%d) %v", e.Type, e.EdgeID, e.FromID, e.Label, e.ToID, e.Properties)
+	case EdgeRelabeledEvent:
+		return fmt.Sprintf("%s %d %s -> %s", e.Type, e.EdgeID, e.OldLabel, e.Label)
+	case EdgePropertySetEvent, EdgePropertyRemovedEvent:
+		return fmt.Sprintf("%s %d %s: %v -> %v", e.Type, e.EdgeID, e.Key, e.OldValue, e.Value)
+	case EdgeExternalIDChangedEvent:
+		return fmt.Sprintf("%s %d %q -> %q", e.Type, e.EdgeID, e.OldExternalID, e.ExternalID)
+	}
+	return e.Type.String()
+}
+
+// ErrInvalidEvent is returned when an event cannot be applied to a
+// graph
+type ErrInvalidEvent struct {
+	Event GraphEvent
+	Msg   string
+}
+
+func (e ErrInvalidEvent) Error() string {
+	return fmt.Sprintf("Invalid event: %s: %s", e.Event, e.Msg)
+}
+
+type graphObserver struct {
+	f func(GraphEvent)
+}
+
+// Observe registers f to receive the mutation events of the graph. The
+// events are delivered synchronously, in the order the mutations
+// happen, and f is called before the mutating call returns. f must not
+// modify the graph. The returned function unregisters the observer.
+//
+// Events are delivered as the mutations happen, including the
+// mutations made in a transaction. When a transaction is rolled back,
+// the observers receive the events undoing the changes, so the events
+// always describe the current state of the graph.
+func (g *Graph) Observe(f func(GraphEvent)) (cancel func()) {
+	o := &graphObserver{f: f}
+	// The observer list is copied on write, so observers can be
+	// removed while an event is delivered
+	observers := make([]*graphObserver, 0, len(g.observers)+1)
+	observers = append(observers, g.observers...)
+	g.observers = append(observers, o)
+	return func() {
+		observers := make([]*graphObserver, 0, len(g.observers))
+		for _, x := range g.observers {
+			if x != o {
+				observers = append(observers, x)
+			}
+		}
+		g.observers = observers
+	}
+}
+
+// ObserveChan registers a buffered channel of the given size to
+// receive the mutation events of the graph. The events are sent to the
+// channel in order. When the channel is full, the mutating call blocks
+// until the receiver catches up. The returned function unregisters
+// the observer and closes the channel.
+//
+// The Node and Edge fields of the events received from the channel
+// refer to the live graph, so they must not be accessed while the
+// graph is being modified.
+func (g *Graph) ObserveChan(size int) (<-chan GraphEvent, func()) {
+	ch := make(chan GraphEvent, size)
+	cancel := g.Observe(func(e GraphEvent) { ch <- e })
+	return ch, func() {
+		cancel()
+		close(ch)
+	}
+}
+
+func (g *Graph) emit(e GraphEvent) {
+	for _, o := range g.observers {
+		o.f(e)
+	}
+}
+
+func copyProperties(p *properties) map[string]interface{} {
+	m := p.load()
+	if len(m) == 0 {
+		return nil
+	}
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
+
+// nodeEvent returns a node created or removed event
+func nodeEvent(t GraphEventType, node *Node) GraphEvent {
+	return GraphEvent{
+		Type:       t,
+		Node:       node,
+		NodeID:     node.id,
+		Labels:     node.labels.Clone(),
+		Properties: copyProperties(&node.properties),
+		ExternalID: node.externalID,
+	}
+}
+
+// edgeEvent returns an edge created or removed event
+func edgeEvent(t GraphEventType, edge *Edge) GraphEvent {
+	return GraphEvent{
+		Type:       t,
+		Edge:       edge,
+		EdgeID:     edge.id,
+		FromID:     edge.from.id,
+		ToID:       edge.to.id,
+		Label:      edge.label,
+		Properties: copyProperties(&edge.properties),
+		ExternalID: edge.externalID,
+	}
+}
+
+func (g *Graph) emitNode(t GraphEventType, node *Node) {
+	if len(g.observers) > 0 {
+		g.emit(nodeEvent(t, node))
+	}
+}
+
+func (g *Graph) emitEdge(t GraphEventType, edge *Edge) {
+	if len(g.observers) > 0 {
+		g.emit(edgeEvent(t, edge))
+	}
+}
+
+// ApplyEvent applies the mutation described by the event to the
+// graph. Nodes and edges are identified by their IDs, so events
+// received from a graph can be applied to an empty graph to rebuild
+// it with the same IDs.
+func (g *Graph) ApplyEvent(e GraphEvent) (err error) {
+	defer g.endMutation(g.mutation(), &err)
+	getNode := func(id int) (*Node, error) {
+		node := g.GetNode(id)
+		if node == nil {
+			return nil, ErrInvalidEvent{Event: e, Msg: fmt.Sprintf("Node not found: %d", id)}
+		}
+		return node, nil
+	}
+	getEdge := func(id int) (*Edge, error) {
+		edge := g.GetEdge(id)
+		if edge == nil {
+			return nil, ErrInvalidEvent{Event: e, Msg: fmt.Sprintf("Edge not found: %d", id)}
+		}
+		return edge, nil
+	}
+	switch e.Type {
+	case NodeCreatedEvent:
+		node, err := g.NewNodeWithID(e.NodeID, e.Labels.Slice(), e.Properties)
+		if err != nil {
+			return err
+		}
+		return node.SetExternalID(e.ExternalID)
+	case EdgeCreatedEvent:
+		from, err := getNode(e.FromID)
+		if err != nil {
+			return err
+		}
+		to, err := getNode(e.ToID)
+		if err != nil {
+			return err
+		}
+		edge, err := g.NewEdgeWithID(e.EdgeID, from, to, e.Label, e.Properties)
+		if err != nil {
+			return err
+		}
+		return edge.SetExternalID(e.ExternalID)
+	case NodeRemovedEvent, NodeLabelsChangedEvent, NodePropertySetEvent, NodePropertyRemovedEvent, NodeExternalIDChangedEvent:
+		node, err := getNode(e.NodeID)
+		if err != nil {
+			return err
+		}
+		switch e.Type {
+		case NodeRemovedEvent:
+			node.DetachAndRemove()
+		case NodeLabelsChangedEvent:
+			node.SetLabels(e.Labels)
+		case NodePropertySetEvent:
+			node.SetProperty(e.Key, e.Value)
+		case NodePropertyRemovedEvent:
+			node.RemoveProperty(e.Key)
+		case NodeExternalIDChangedEvent:
+			return node.SetExternalID(e.ExternalID)
+		}
+	case EdgeRemovedEvent, EdgeRelabeledEvent, EdgePropertySetEvent, EdgePropertyRemovedEvent, EdgeExternalIDChangedEvent:
+		edge, err := getEdge(e.EdgeID)
+		if err != nil {
+			return err
+		}
+		switch e.Type {
+		case EdgeRemovedEvent:
+			edge.Remove()
+		case EdgeRelabeledEvent:
+			edge.SetLabel(e.Label)
+		case EdgePropertySetEvent:
+			edge.SetProperty(e.Key, e.Value)
+		case EdgePropertyRemovedEvent:
+			edge.RemoveProperty(e.Key)
+		case EdgeExternalIDChangedEvent:
+			return edge.SetExternalID(e.ExternalID)
+		}
+	default:
+		return ErrInvalidEvent{Event: e, Msg: "Unknown event type"}
+	}
+	return nil
+}
+
+// Replay applies the events to the graph in order. It stops at the
+// first event that cannot be applied, and returns the error.
+func (g *Graph) Replay(events []GraphEvent) error {
+	for _, e := range events {
+		if err := g.ApplyEvent(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
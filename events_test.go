@@ -0,0 +1,132 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func describeProperties(p *properties) string {
+	keys := p.propertyKeys()
+	sort.Strings(keys)
+	ret := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, fmt.Sprintf("%s:%v", k, p.load()[k]))
+	}
+	return fmt.Sprint(ret)
+}
+
+// describeGraph returns the nodes and edges of the graph by ID, so
+// graphs with different iteration orders can be compared
+func describeGraph(g *Graph) []string {
+	ret := make([]string, 0)
+	for nodes := g.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		ret = append(ret, fmt.Sprintf("%d %s %s %s", node.GetID(), node.GetExternalID(), displayLabels(node.labels), describeProperties(&node.properties)))
+	}
+	for edges := g.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		ret = append(ret, fmt.Sprintf("%d %s %d %d %s %s", edge.GetID(), edge.GetExternalID(), edge.from.id, edge.to.id, edge.label, describeProperties(&edge.properties)))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestGraphEvents(t *testing.T) {
+	g := NewGraph()
+	events := make([]GraphEvent, 0)
+	cancel := g.Observe(func(e GraphEvent) { events = append(events, e) })
+
+	n1 := g.NewNode([]string{"a"}, map[string]interface{}{"key": "1"})
+	n2 := g.NewNode([]string{"b"}, nil)
+	n3 := g.NewNode([]string{"c"}, nil)
+	e1 := g.NewEdge(n1, n2, "e", map[string]interface{}{"w": 1})
+	g.NewEdge(n2, n3, "f", nil)
+	g.NewEdge(n3, n1, "g", nil)
+	n1.SetProperty("key", "x")
+	n2.SetLabels(NewStringSet("b", "d"))
+	n2.SetExternalID("n2")
+	e1.SetLabel("h")
+	e1.RemoveProperty("w")
+	n3.DetachAndRemove()
+
+	tx := g.Begin()
+	n4 := g.NewNode([]string{"a"}, nil)
+	g.NewEdge(n1, n4, "e", nil)
+	n1.RemoveProperty("key")
+	n2.DetachAndRemove()
+	tx.Rollback()
+
+	expected := []GraphEventType{
+		NodeCreatedEvent, NodeCreatedEvent, NodeCreatedEvent,
+		EdgeCreatedEvent, EdgeCreatedEvent, EdgeCreatedEvent,
+		NodePropertySetEvent, NodeLabelsChangedEvent, NodeExternalIDChangedEvent,
+		EdgeRelabeledEvent, EdgePropertyRemovedEvent,
+		EdgeRemovedEvent, EdgeRemovedEvent, NodeRemovedEvent,
+	}
+	for i, x := range expected {
+		if events[i].Type != x {
+			t.Errorf("Event %d: expecting %s got %s", i, x, events[i])
+		}
+	}
+	if e := events[6]; e.OldValue != "1" || e.Value != "x" || !e.HasOldValue {
+		t.Errorf("Wrong property event: %s", e)
+	}
+	cancel()
+	n1.SetProperty("key", "y")
+	n1.SetProperty("key", "x")
+
+	// Replaying the events, including the events undoing the
+	// transaction, rebuilds the graph
+	g2 := NewGraph()
+	if err := g2.Replay(events); err != nil {
+		t.Error(err)
+	}
+	if expected, got := describeGraph(g), describeGraph(g2); fmt.Sprint(expected) != fmt.Sprint(got) {
+		t.Errorf("Replay failed: %v %v", expected, got)
+	}
+	if err := g2.ApplyEvent(GraphEvent{Type: EdgeRemovedEvent, EdgeID: 100}); err == nil {
+		t.Errorf("Expecting error")
+	}
+}
+
+func TestGraphEventChan(t *testing.T) {
+	g := NewGraph()
+	ch, cancel := g.ObserveChan(10)
+	done := make(chan []GraphEvent)
+	go func() {
+		events := make([]GraphEvent, 0)
+		for e := range ch {
+			events = append(events, e)
+		}
+		done <- events
+	}()
+	for i := 0; i < 100; i++ {
+		g.NewNode(nil, map[string]interface{}{"i": i})
+	}
+	cancel()
+	events := <-done
+	if len(events) != 100 {
+		t.Errorf("Expecting 100 events, got %d", len(events))
+		return
+	}
+	for i, e := range events {
+		if e.Properties["i"] != i {
+			t.Errorf("Wrong event order: %d %s", i, e)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+// ErrDuplicateExternalID is returned when an external ID that is
+// already used by another node or edge is assigned
+type ErrDuplicateExternalID struct {
+	ID string
+}
+
+func (e ErrDuplicateExternalID) Error() string { return "Duplicate external ID: " + e.ID }
+
+// GetExternalID returns the external ID of the node, or empty string
+// if the node does not have one
+func (node *Node) GetExternalID() string { return node.externalID }
+
+// SetExternalID sets the external ID of the node. External IDs are
+// user-defined string keys, such as UUIDs, that are unique among the
+// nodes of the graph. Returns ErrDuplicateExternalID if another node
+// has the same external ID. Use an empty string to remove the
+// external ID.
+func (node *Node) SetExternalID(id string) (err error) {
+	defer node.graph.endMutation(node.graph.mutation(), &err)
+	return node.graph.setNodeExternalID(node, id)
+}
+
+// GetExternalID returns the external ID of the edge, or empty string
+// if the edge does not have one
+func (edge *Edge) GetExternalID() string { return edge.externalID }
+
+// SetExternalID sets the external ID of the edge. External IDs are
+// unique among the edges of the graph. Returns ErrDuplicateExternalID
+// if another edge has the same external ID. Use an empty string to
+// remove the external ID.
+func (edge *Edge) SetExternalID(id string) (err error) {
+	defer edge.from.graph.endMutation(edge.from.graph.mutation(), &err)
+	return edge.from.graph.setEdgeExternalID(edge, id)
+}
+
+// GetNodeByExternalID returns the node with the given external ID, or
+// nil if there is no such node
+func (g *Graph) GetNodeByExternalID(id string) *Node {
+	return g.index.nodesByExternalID[id]
+}
+
+// GetEdgeByExternalID returns the edge with the given external ID, or
+// nil if there is no such edge
+func (g *Graph) GetEdgeByExternalID(id string) *Edge {
+	return g.index.edgesByExternalID[id]
+}
+
+func (g *Graph) setNodeExternalID(node *Node, id string) error {
+	g.checkWritable()
+	if id == node.externalID {
+		return nil
+	}
+	if len(id) > 0 {
+		if _, exists := g.index.nodesByExternalID[id]; exists {
+			return ErrDuplicateExternalID{ID: id}
+		}
+	}
+	old := node.externalID
+	if len(old) > 0 {
+		delete(g.index.nodesByExternalID, old)
+	}
+	node.externalID = id
+	if len(id) > 0 {
+		g.index.nodesByExternalID[id] = node
+	}
+	g.record(func() { g.setNodeExternalID(node, old) })
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: NodeExternalIDChangedEvent, Node: node, NodeID: node.id, ExternalID: id, OldExternalID: old})
+	}
+	return nil
+}
+
+func (g *Graph) setEdgeExternalID(edge *Edge, id string) error {
+	g.checkWritable()
+	if id == edge.externalID {
+		return nil
+	}
+	if len(id) > 0 {
+		if _, exists := g.index.edgesByExternalID[id]; exists {
+			return ErrDuplicateExternalID{ID: id}
+		}
+	}
+	old := edge.externalID
+	if len(old) > 0 {
+		delete(g.index.edgesByExternalID, old)
+	}
+	edge.externalID = id
+	if len(id) > 0 {
+		g.index.edgesByExternalID[id] = edge
+	}
+	g.record(func() { g.setEdgeExternalID(edge, old) })
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: EdgeExternalIDChangedEvent, Edge: edge, EdgeID: edge.id, ExternalID: id, OldExternalID: old})
+	}
+	return nil
+}
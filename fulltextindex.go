@@ -0,0 +1,548 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/emirpasic/gods/trees/redblacktree"
+)
+
+// FullTextOptions configures the text analysis of a full-text
+// index. The same analysis is applied to the indexed values and to
+// the queries.
+type FullTextOptions struct {
+	// Tokenizer splits a text into tokens. If nil, the text is split
+	// at characters that are not letters or digits.
+	Tokenizer func(string) []string
+
+	// If CaseSensitive is false, tokens are lower-cased
+	CaseSensitive bool
+
+	// Stemmer, if non-nil, maps a token to its stem. EnglishStemmer
+	// is a simple stemmer for English.
+	Stemmer func(string) string
+
+	// StopWords are not indexed. Stop words are compared after
+	// lower-casing, before stemming.
+	StopWords []string
+
+	// BM25 parameters. If K1 is 0, 1.2 is used. If B is 0, 0.75 is used.
+	K1 float64
+	B  float64
+}
+
+// ErrInvalidFullTextQuery is returned for a full-text query that
+// cannot be parsed
+type ErrInvalidFullTextQuery struct {
+	Query string
+	Msg   string
+}
+
+func (e ErrInvalidFullTextQuery) Error() string {
+	return fmt.Sprintf("Invalid full-text query %q: %s", e.Query, e.Msg)
+}
+
+// ScoredNodeIterator iterates nodes in the order of decreasing score
+type ScoredNodeIterator interface {
+	NodeIterator
+	// Score returns the score of the current node
+	Score() float64
+}
+
+// ScoredEdgeIterator iterates edges in the order of decreasing score
+type ScoredEdgeIterator interface {
+	EdgeIterator
+	// Score returns the score of the current edge
+	Score() float64
+}
+
+type scoredItem struct {
+	id    int
+	item  interface{}
+	score float64
+}
+
+// scoredIterator iterates scored items. It implements
+// ScoredNodeIterator and ScoredEdgeIterator.
+type scoredIterator struct {
+	items []scoredItem
+	pos   int
+}
+
+func newScoredIterator(items []scoredItem) *scoredIterator {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].score == items[j].score {
+			return items[i].id < items[j].id
+		}
+		return items[i].score > items[j].score
+	})
+	return &scoredIterator{items: items, pos: -1}
+}
+
+func (s *scoredIterator) Next() bool {
+	if s.pos+1 >= len(s.items) {
+		s.pos = len(s.items)
+		return false
+	}
+	s.pos++
+	return true
+}
+
+func (s *scoredIterator) Value() interface{} { return s.items[s.pos].item }
+func (s *scoredIterator) Score() float64     { return s.items[s.pos].score }
+func (s *scoredIterator) MaxSize() int       { return len(s.items) }
+func (s *scoredIterator) Node() *Node        { return s.items[s.pos].item.(*Node) }
+func (s *scoredIterator) Edge() *Edge        { return s.items[s.pos].item.(*Edge) }
+
+type ftToken struct {
+	term string
+	pos  int
+}
+
+// ftDoc is an indexed node or edge
+type ftDoc struct {
+	item interface{}
+	// Positions of terms
+	terms  map[string][]int
+	length int
+}
+
+// fullTextIndex is an inverted index of the terms of a property
+type fullTextIndex struct {
+	options   FullTextOptions
+	stopWords map[string]struct{}
+	docs      map[int]*ftDoc
+	// Sorted term -> map[int]*ftDoc
+	postings    *redblacktree.Tree
+	totalLength int
+}
+
+func newFullTextIndex(options FullTextOptions) *fullTextIndex {
+	ret := &fullTextIndex{
+		options:   options,
+		stopWords: make(map[string]struct{}),
+		docs:      make(map[int]*ftDoc),
+		postings:  redblacktree.NewWithStringComparator(),
+	}
+	if ret.options.K1 == 0 {
+		ret.options.K1 = 1.2
+	}
+	if ret.options.B == 0 {
+		ret.options.B = 0.75
+	}
+	for _, w := range options.StopWords {
+		ret.stopWords[ret.normalize(w)] = struct{}{}
+	}
+	return ret
+}
+
+func (ix *fullTextIndex) normalize(token string) string {
+	if ix.options.CaseSensitive {
+		return token
+	}
+	return strings.ToLower(token)
+}
+
+func defaultTokenizer(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// analyze returns the terms of the text with their positions starting
+// at pos. Stop words are dropped, but they still take a position, so
+// phrases match the original text.
+func (ix *fullTextIndex) analyze(text string, pos int) []ftToken {
+	tokenizer := ix.options.Tokenizer
+	if tokenizer == nil {
+		tokenizer = defaultTokenizer
+	}
+	ret := make([]ftToken, 0)
+	for _, token := range tokenizer(text) {
+		token = ix.normalize(token)
+		if _, stop := ix.stopWords[token]; !stop && len(token) > 0 {
+			if ix.options.Stemmer != nil {
+				token = ix.options.Stemmer(token)
+			}
+			ret = append(ret, ftToken{term: token, pos: pos})
+		}
+		pos++
+	}
+	return ret
+}
+
+// ftTexts returns the strings in a property value. A value can be a
+// string, or a slice of strings.
+func ftTexts(value interface{}) []string {
+	switch v := nativeValue(value).(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		ret := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := nativeValue(x).(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func (ix *fullTextIndex) postingsOf(term string) map[int]*ftDoc {
+	v, ok := ix.postings.Get(term)
+	if !ok {
+		return nil
+	}
+	return v.(map[int]*ftDoc)
+}
+
+func (ix *fullTextIndex) add(value interface{}, id int, item interface{}) {
+	texts := ftTexts(value)
+	if len(texts) == 0 {
+		return
+	}
+	doc := &ftDoc{item: item, terms: make(map[string][]int)}
+	pos := 0
+	for _, text := range texts {
+		for _, t := range ix.analyze(text, pos) {
+			doc.terms[t.term] = append(doc.terms[t.term], t.pos)
+			doc.length++
+			pos = t.pos + 1
+		}
+		// Leave a gap between the elements of a list so phrases do not
+		// match across elements
+		pos++
+	}
+	ix.docs[id] = doc
+	ix.totalLength += doc.length
+	for term := range doc.terms {
+		p := ix.postingsOf(term)
+		if p == nil {
+			p = make(map[int]*ftDoc)
+			ix.postings.Put(term, p)
+		}
+		p[id] = doc
+	}
+}
+
+func (ix *fullTextIndex) remove(value interface{}, id int) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	delete(ix.docs, id)
+	ix.totalLength -= doc.length
+	for term := range doc.terms {
+		p := ix.postingsOf(term)
+		delete(p, id)
+		if len(p) == 0 {
+			ix.postings.Remove(term)
+		}
+	}
+}
+
+// ftClause is a term, a phrase, or a prefix in a query
+func (ix *fullTextIndex) stats() IndexStats {
+	terms := ix.postings.Size()
+	mem := len(ix.docs)*(mapEntryBytes+mapBytes) + terms*(treeNodeBytes+mapBytes)
+	for _, doc := range ix.docs {
+		// Entries in the term positions, and in the postings
+		mem += len(doc.terms)*(2*mapEntryBytes+sliceBytes) + doc.length*intBytes
+	}
+	return IndexStats{
+		Entries:        len(ix.docs),
+		DistinctValues: terms,
+		MemoryEstimate: mem,
+	}
+}
+
+type ftClause struct {
+	tokens []ftToken
+	prefix bool
+}
+
+// parseQuery parses a query. A query is a list of terms, "quoted
+// phrases", and prefixes ending with '*'.
+func (ix *fullTextIndex) parseQuery(query string) ([]ftClause, error) {
+	ret := make([]ftClause, 0)
+	rest := strings.TrimSpace(query)
+	if len(rest) == 0 {
+		return nil, ErrInvalidFullTextQuery{Query: query, Msg: "Empty query"}
+	}
+	for len(rest) > 0 {
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				return nil, ErrInvalidFullTextQuery{Query: query, Msg: "Unterminated phrase"}
+			}
+			if tokens := ix.analyze(rest[1:end+1], 0); len(tokens) > 0 {
+				ret = append(ret, ftClause{tokens: tokens})
+			}
+			rest = strings.TrimSpace(rest[end+2:])
+			continue
+		}
+		word := rest
+		if end := strings.IndexFunc(rest, unicode.IsSpace); end != -1 {
+			word = rest[:end]
+		}
+		rest = strings.TrimSpace(rest[len(word):])
+		if strings.HasSuffix(word, "*") {
+			// Prefixes are not stemmed
+			prefix := ix.normalize(strings.TrimRight(word, "*"))
+			if len(prefix) == 0 {
+				return nil, ErrInvalidFullTextQuery{Query: query, Msg: "Empty prefix"}
+			}
+			ret = append(ret, ftClause{tokens: []ftToken{{term: prefix}}, prefix: true})
+			continue
+		}
+		for _, t := range ix.analyze(word, 0) {
+			ret = append(ret, ftClause{tokens: []ftToken{{term: t.term}}})
+		}
+	}
+	return ret, nil
+}
+
+// bm25 returns the BM25 score of a term that occurs tf times in the
+// document, and in df documents
+func (ix *fullTextIndex) bm25(tf, df int, doc *ftDoc) float64 {
+	n := float64(len(ix.docs))
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+	avgLength := float64(ix.totalLength) / n
+	k1, b := ix.options.K1, ix.options.B
+	norm := k1 * (1 - b + b*float64(doc.length)/avgLength)
+	return idf * float64(tf) * (k1 + 1) / (float64(tf) + norm)
+}
+
+// phraseCount returns the number of occurrences of the phrase in the
+// document
+func phraseCount(doc *ftDoc, tokens []ftToken) int {
+	ret := 0
+	for _, start := range doc.terms[tokens[0].term] {
+		match := true
+		for _, t := range tokens[1:] {
+			found := false
+			for _, p := range doc.terms[t.term] {
+				if p == start+t.pos-tokens[0].pos {
+					found = true
+					break
+				}
+			}
+			if !found {
+				match = false
+				break
+			}
+		}
+		if match {
+			ret++
+		}
+	}
+	return ret
+}
+
+// match returns the scores of the documents matching the clause
+func (ix *fullTextIndex) match(clause ftClause) map[int]float64 {
+	ret := make(map[int]float64)
+	if clause.prefix {
+		node, _ := ix.postings.Ceiling(clause.tokens[0].term)
+		if node == nil {
+			return ret
+		}
+		for itr := ix.postings.IteratorAt(node); ; {
+			term := itr.Key().(string)
+			if !strings.HasPrefix(term, clause.tokens[0].term) {
+				break
+			}
+			p := itr.Value().(map[int]*ftDoc)
+			for id, doc := range p {
+				ret[id] += ix.bm25(len(doc.terms[term]), len(p), doc)
+			}
+			if !itr.Next() {
+				break
+			}
+		}
+		return ret
+	}
+	p := ix.postingsOf(clause.tokens[0].term)
+	if len(clause.tokens) == 1 {
+		for id, doc := range p {
+			ret[id] = ix.bm25(len(doc.terms[clause.tokens[0].term]), len(p), doc)
+		}
+		return ret
+	}
+	counts := make(map[int]int)
+	for id, doc := range p {
+		if n := phraseCount(doc, clause.tokens); n > 0 {
+			counts[id] = n
+		}
+	}
+	for id, n := range counts {
+		ret[id] = ix.bm25(n, len(counts), ix.docs[id])
+	}
+	return ret
+}
+
+// search returns the documents that match all the clauses of the
+// query, scored using BM25
+func (ix *fullTextIndex) search(query string) (*scoredIterator, error) {
+	clauses, err := ix.parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses) == 0 || len(ix.docs) == 0 {
+		return newScoredIterator(nil), nil
+	}
+	var scores map[int]float64
+	for _, clause := range clauses {
+		m := ix.match(clause)
+		if scores == nil {
+			scores = m
+			continue
+		}
+		for id, score := range scores {
+			s, ok := m[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] = score + s
+		}
+	}
+	items := make([]scoredItem, 0, len(scores))
+	for id, score := range scores {
+		items = append(items, scoredItem{id: id, item: ix.docs[id].item, score: score})
+	}
+	return newScoredIterator(items), nil
+}
+
+// EnglishStemmer is a simple suffix-stripping stemmer for English. It
+// maps plural and common verb forms to the same stem, for instance
+// "index", "indexes", "indexed" and "indexing" all map to "index".
+func EnglishStemmer(token string) string {
+	if len(token) <= 3 {
+		return token
+	}
+	switch {
+	case strings.HasSuffix(token, "ies") && len(token) > 4:
+		return token[:len(token)-3] + "y"
+	case strings.HasSuffix(token, "sses"), strings.HasSuffix(token, "xes"), strings.HasSuffix(token, "ches"), strings.HasSuffix(token, "shes"):
+		return token[:len(token)-2]
+	case strings.HasSuffix(token, "ss"), strings.HasSuffix(token, "us"), strings.HasSuffix(token, "is"):
+		return token
+	case strings.HasSuffix(token, "s"):
+		return token[:len(token)-1]
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		if !strings.HasSuffix(token, suffix) || len(token)-len(suffix) < 3 {
+			continue
+		}
+		stem := token[:len(token)-len(suffix)]
+		// Undouble the last consonant: running -> run
+		if n := len(stem); stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+			stem = stem[:n-1]
+		}
+		return stem
+	}
+	return token
+}
+
+// NodeFullTextIndex sets up a full-text index for the given node property
+func (g *graphIndex) NodeFullTextIndex(propertyName string, graph *Graph, options FullTextOptions) {
+	if _, exists := g.nodeFullText[propertyName]; exists {
+		return
+	}
+	ix := newFullTextIndex(options)
+	g.nodeFullText[propertyName] = ix
+	for nodes := graph.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		if value, ok := node.properties.getProperty(propertyName); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+}
+
+// EdgeFullTextIndex sets up a full-text index for the given edge property
+func (g *graphIndex) EdgeFullTextIndex(propertyName string, graph *Graph, options FullTextOptions) {
+	if _, exists := g.edgeFullText[propertyName]; exists {
+		return
+	}
+	ix := newFullTextIndex(options)
+	g.edgeFullText[propertyName] = ix
+	for edges := graph.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		if value, ok := edge.properties.getProperty(propertyName); ok {
+			ix.add(value, edge.id, edge)
+		}
+	}
+}
+
+// AddNodeFullTextIndex adds a full-text index for the node property.
+// String values, and the string elements of list values are
+// indexed. Use SearchNodes to query the index.
+func (g *Graph) AddNodeFullTextIndex(propertyName string, options FullTextOptions) {
+	g.indexesChanged()
+	g.index.NodeFullTextIndex(propertyName, g, options)
+}
+
+// AddEdgeFullTextIndex adds a full-text index for the edge property.
+func (g *Graph) AddEdgeFullTextIndex(propertyName string, options FullTextOptions) {
+	g.indexesChanged()
+	g.index.EdgeFullTextIndex(propertyName, g, options)
+}
+
+// SearchNodes searches the full-text index of the node property, and
+// returns the matching nodes ordered by decreasing BM25 score.
+//
+// The query is a list of terms, "quoted phrases", and prefixes
+// ending with '*', and a node matches if it matches all of them. The
+// terms and phrases are analyzed the same way as the indexed values.
+// Prefixes are only lower-cased, and they match the indexed terms
+// after stemming.
+//
+// Returns ErrIndexScan if there is no full-text index for the
+// property, or ErrInvalidFullTextQuery if the query cannot be parsed.
+func (g *Graph) SearchNodes(propertyName, query string) (ScoredNodeIterator, error) {
+	ix, ok := g.index.nodeFullText[propertyName]
+	if !ok {
+		return nil, ErrIndexScan{Keys: []string{propertyName}, Msg: "No full-text index"}
+	}
+	itr, err := ix.search(query)
+	if err != nil {
+		return nil, err
+	}
+	return itr, nil
+}
+
+// SearchEdges searches the full-text index of the edge property, and
+// returns the matching edges ordered by decreasing BM25 score. See
+// SearchNodes for the query syntax.
+func (g *Graph) SearchEdges(propertyName, query string) (ScoredEdgeIterator, error) {
+	ix, ok := g.index.edgeFullText[propertyName]
+	if !ok {
+		return nil, ErrIndexScan{Keys: []string{propertyName}, Msg: "No full-text index"}
+	}
+	itr, err := ix.search(query)
+	if err != nil {
+		return nil, err
+	}
+	return itr, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"testing"
+)
+
+func searchNames(t *testing.T, g *Graph, query string) []string {
+	itr, err := g.SearchNodes("text", query)
+	if err != nil {
+		t.Errorf("%s: %v", query, err)
+		return nil
+	}
+	ret := make([]string, 0)
+	last := 0.0
+	for itr.Next() {
+		if len(ret) > 0 && itr.Score() > last {
+			t.Errorf("%s: Results not sorted by score", query)
+		}
+		last = itr.Score()
+		name, _ := itr.Node().GetProperty("name")
+		ret = append(ret, name.(string))
+	}
+	return ret
+}
+
+func TestFullTextIndex(t *testing.T) {
+	g := NewGraph()
+	docs := map[string]string{
+		"a": "The quick brown fox jumps over the lazy dog",
+		"b": "Quick indexing of graphs",
+		"c": "A graph database indexes nodes and edges",
+		"d": "Brown bears, brown foxes, and brown dogs",
+	}
+	for name, text := range docs {
+		g.NewNode([]string{"doc"}, map[string]interface{}{"name": name, "text": text})
+	}
+	g.NewNode([]string{"doc"}, map[string]interface{}{"name": "e", "text": 1})
+	g.AddNodeFullTextIndex("text", FullTextOptions{Stemmer: EnglishStemmer, StopWords: []string{"the", "a", "and"}})
+	f := g.NewNode([]string{"doc"}, map[string]interface{}{"name": "f", "text": []interface{}{"lazy", "dog days"}})
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"quick", []string{"b", "a"}},
+		{"QUICK fox", []string{"a"}},
+		{"brown", []string{"d", "a"}},
+		{"index", []string{"b", "c"}},
+		{"graph index", []string{"b", "c"}},
+		{`"brown fox"`, []string{"d", "a"}},
+		{`"fox brown"`, []string{}},
+		{`"lazy dog"`, []string{"a"}},
+		{"dog day*", []string{"f"}},
+		{"gra*", []string{"b", "c"}},
+		{"the", []string{}},
+		{"missing", []string{}},
+	} {
+		result := searchNames(t, g, tc.query)
+		if len(result) != len(tc.expected) {
+			t.Errorf("%s: Expected %v, got %v", tc.query, tc.expected, result)
+			continue
+		}
+		if len(tc.expected) > 0 && result[0] != tc.expected[0] {
+			t.Errorf("%s: Expected %v, got %v", tc.query, tc.expected, result)
+		}
+	}
+
+	// Incremental maintenance and rollback
+	f.SetProperty("text", "graph queries")
+	if result := searchNames(t, g, "lazy"); len(result) != 1 {
+		t.Errorf("Index not updated: %v", result)
+	}
+	tx := g.Begin()
+	f.RemoveProperty("text")
+	if result := searchNames(t, g, "queries"); len(result) != 0 {
+		t.Errorf("Index not updated: %v", result)
+	}
+	tx.Rollback()
+	if result := searchNames(t, g, "query"); len(result) != 1 || result[0] != "f" {
+		t.Errorf("Index not rolled back: %v", result)
+	}
+	f.DetachAndRemove()
+	if result := searchNames(t, g, "graph"); len(result) != 2 {
+		t.Errorf("Index not updated on remove: %v", result)
+	}
+
+	if result := searchNames(t, g.Snapshot(), "graph"); len(result) != 2 {
+		t.Errorf("Snapshot lost full-text index: %v", result)
+	}
+
+	if _, err := g.SearchNodes("text", `"unterminated`); err == nil {
+		t.Errorf("Expecting error")
+	}
+	if _, err := g.SearchNodes("name", "a"); err == nil {
+		t.Errorf("Expecting error")
+	}
+}
+
+func TestFullTextIndexType(t *testing.T) {
+	g := NewGraph()
+	a := g.NewNode(nil, nil)
+	b := g.NewNode(nil, nil)
+	g.NewEdge(a, b, "e", map[string]interface{}{"text": "Hello, World"})
+	g.AddEdgePropertyIndex("text", FullTextIndex)
+	itr, err := g.SearchEdges("text", "world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if edges := EdgeSlice(itr); len(edges) != 1 {
+		t.Errorf("Wrong result: %v", edges)
+	}
+	if _, ok := g.index.edgeProperties["text"]; ok {
+		t.Errorf("Unexpected property index")
+	}
+}
+
+func TestEnglishStemmer(t *testing.T) {
+	for _, tc := range [][2]string{
+		{"indexes", "index"},
+		{"indexed", "index"},
+		{"indexing", "index"},
+		{"running", "run"},
+		{"parties", "party"},
+		{"classes", "class"},
+		{"passed", "pass"},
+		{"status", "status"},
+		{"dogs", "dog"},
+		{"red", "red"},
+	} {
+		if s := EnglishStemmer(tc[0]); s != tc[1] {
+			t.Errorf("%s: Expected %s, got %s", tc[0], tc[1], s)
+		}
+	}
+}
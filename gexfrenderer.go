@@ -0,0 +1,167 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GEXFRenderer renders a graph in GEXF format that can be opened
+// with Gephi.
+//
+// The node labels are written as the GEXF node label. The node and
+// edge properties listed in Properties are declared as string
+// attributes, with attribute IDs p0, p1, ...
+type GEXFRenderer struct {
+	// NodeRenderer renders a node. If the node is to be excluded, returns false.
+	NodeRenderer func(string, *Node, io.Writer) (bool, error)
+	// EdgeRenderer renders an edge. The from and to nodes are rendered
+	// if this is called. If the edge is to be excluded, returns false
+	EdgeRenderer func(fromID string, toID string, edge *Edge, w io.Writer) (bool, error)
+
+	// Properties are the property keys rendered by the default node
+	// and edge renderers
+	Properties []string
+
+	// If positive, at most MaxNodes nodes and MaxEdges edges are rendered
+	MaxNodes int
+	MaxEdges int
+}
+
+// RenderNode renders a node. If node renderer is not set, calls the default renderer
+func (x GEXFRenderer) RenderNode(ID string, node *Node, w io.Writer) (bool, error) {
+	if x.NodeRenderer == nil {
+		return true, DefaultGEXFNodeRender(ID, node, x.Properties, w)
+	}
+	return x.NodeRenderer(ID, node, w)
+}
+
+// RenderEdge renders an edge. If edge renderer is not set, call the default renderer
+func (x GEXFRenderer) RenderEdge(fromID, toID string, edge *Edge, w io.Writer) (bool, error) {
+	if x.EdgeRenderer == nil {
+		return true, DefaultGEXFEdgeRender(fromID, toID, edge, x.Properties, w)
+	}
+	return x.EdgeRenderer(fromID, toID, edge, w)
+}
+
+// EscapeXMLString escapes s so it can be used as XML text or attribute value
+func EscapeXMLString(s string) string {
+	sb := strings.Builder{}
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func writeGEXFAttValues(w io.Writer, p WithProperties, properties []string) error {
+	first := true
+	for i, k := range properties {
+		v, ok := p.GetProperty(k)
+		if !ok {
+			continue
+		}
+		if first {
+			if _, err := io.WriteString(w, "\n        <attvalues>\n"); err != nil {
+				return err
+			}
+			first = false
+		}
+		if _, err := fmt.Fprintf(w, "          <attvalue for=\"p%d\" value=\"%s\"/>\n", i, EscapeXMLString(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	if !first {
+		if _, err := io.WriteString(w, "        </attvalues>\n      "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultGEXFNodeRender renders the node with its labels, and the
+// given properties as attribute values. The attribute for
+// properties[i] has ID p<i>.
+func DefaultGEXFNodeRender(ID string, node *Node, properties []string, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "      <node id=\"%s\" label=\"%s\">", ID, EscapeXMLString(displayLabels(node.labels))); err != nil {
+		return err
+	}
+	if err := writeGEXFAttValues(w, node, properties); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</node>\n")
+	return err
+}
+
+// DefaultGEXFEdgeRender renders the edge with its label, and the
+// given properties as attribute values. The attribute for
+// properties[i] has ID p<i>.
+func DefaultGEXFEdgeRender(fromNode, toNode string, edge *Edge, properties []string, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "      <edge id=\"e%d\" source=\"%s\" target=\"%s\" label=\"%s\">", edge.GetID(), fromNode, toNode, EscapeXMLString(edge.label)); err != nil {
+		return err
+	}
+	if err := writeGEXFAttValues(w, edge, properties); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</edge>\n")
+	return err
+}
+
+// Render writes the graph as a GEXF document
+func (x GEXFRenderer) Render(g *Graph, out io.Writer) error {
+	if _, err := io.WriteString(out, xml.Header+"<gexf xmlns=\"http://gexf.net/1.3\" version=\"1.3\">\n  <graph defaultedgetype=\"directed\" mode=\"static\">\n"); err != nil {
+		return err
+	}
+	if len(x.Properties) > 0 {
+		for _, class := range []string{"node", "edge"} {
+			if _, err := fmt.Fprintf(out, "    <attributes class=\"%s\">\n", class); err != nil {
+				return err
+			}
+			for i, p := range x.Properties {
+				if _, err := fmt.Fprintf(out, "      <attribute id=\"p%d\" title=\"%s\" type=\"string\"/>\n", i, EscapeXMLString(p)); err != nil {
+					return err
+				}
+			}
+			if _, err := io.WriteString(out, "    </attributes>\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Nodes and edges are written in separate sections, so edges are
+	// buffered until all nodes are written
+	edges := strings.Builder{}
+	if _, err := io.WriteString(out, "    <nodes>\n"); err != nil {
+		return err
+	}
+	omittedNodes, omittedEdges, err := renderGraphNodesEdges(g, "n", x.MaxNodes, x.MaxEdges, func(ID string, node *Node) (bool, error) {
+		return x.RenderNode(ID, node, out)
+	}, func(fromID, toID string, edge *Edge) (bool, error) {
+		return x.RenderEdge(fromID, toID, edge, &edges)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, "    </nodes>\n    <edges>\n"+edges.String()+"    </edges>\n"); err != nil {
+		return err
+	}
+	if omittedNodes > 0 || omittedEdges > 0 {
+		if _, err := fmt.Fprintf(out, "    <!-- %d nodes and %d edges omitted -->\n", omittedNodes, omittedEdges); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(out, "  </graph>\n</gexf>\n")
+	return err
+}
@@ -27,6 +27,9 @@ package lpg
 // `edge.GetGraph()` method. You cannot use an edge to connect nodes
 // of different graphs.
 //
+// The graph is kept in memory. See NewDiskGraph for a graph that pages
+// properties to disk, and PersistentGraph to persist a graph to disk.
+//
 // Zero value for a Graph is not usable. Use `NewGraph` to construct a
 // new graph.
 type Graph struct {
@@ -34,6 +37,33 @@ type Graph struct {
 	allNodes nodeList
 	allEdges edgeMap
 	idBase   int
+	// Incremented when the indexes are created, dropped, or rebuilt
+	indexVersion int
+
+	// The active transaction, and the undo journal
+	tx      *Tx
+	journal []func()
+
+	readOnly bool
+	// The last snapshot of the graph. It is shared by the calls to
+	// Snapshot until the graph is modified.
+	snap *Graph
+
+	constraints []Constraint
+	// Nodes and edges modified in the active transaction, to be
+	// validated on commit
+	dirtyNodes map[*Node]struct{}
+	dirtyEdges map[*Edge]struct{}
+
+	// Mutation event observers
+	observers   []*graphObserver
+	txObservers []txObserver
+
+	// Recorded changes, if versioning is enabled
+	history *history
+
+	// Non-nil if properties are paged to disk
+	pager *propertyPager
 }
 
 // NewGraph constructs and returns a new graph. The new graph has no
@@ -47,9 +77,9 @@ func NewGraph() *Graph {
 
 // NewNode creates a new node with the given labels and properties
 func (g *Graph) NewNode(labels []string, props map[string]interface{}) *Node {
-	var p properties
+	var p map[string]any
 	if len(props) > 0 {
-		p = make(properties, len(props))
+		p = make(map[string]any, len(props))
 		for k, v := range props {
 			p[k] = v
 		}
@@ -61,13 +91,14 @@ func (g *Graph) NewNode(labels []string, props map[string]interface{}) *Node {
 // properties. This version does not copy the labels and properties,
 // but uses the given label set and map directly
 func (g *Graph) FastNewNode(labels StringSet, props map[string]interface{}) *Node {
+	g.checkWritable()
+	defer g.endMutation(g.mutation(), nil)
 	node := &Node{
 		labels:     labels,
 		graph:      g,
-		properties: properties(props),
+		properties: properties{m: props},
 	}
-	node.id = g.idBase
-	g.idBase++
+	node.id = g.newID()
 	g.addNode(node)
 	return node
 }
@@ -75,9 +106,9 @@ func (g *Graph) FastNewNode(labels StringSet, props map[string]interface{}) *Nod
 // NewEdge creates a new edge between the two nodes of the graph. Both
 // nodes must be nodes of this graph, otherwise this call panics
 func (g *Graph) NewEdge(from, to *Node, label string, props map[string]any) *Edge {
-	var p properties
+	var p map[string]any
 	if len(props) > 0 {
-		p = make(properties, len(props))
+		p = make(map[string]any, len(props))
 		for k, v := range props {
 			p[k] = v
 		}
@@ -90,6 +121,8 @@ func (g *Graph) NewEdge(from, to *Node, label string, props map[string]any) *Edg
 // panics. This version uses the given properties map directly without
 // copying it.
 func (g *Graph) FastNewEdge(from, to *Node, label string, props map[string]any) *Edge {
+	g.checkWritable()
+	defer g.endMutation(g.mutation(), nil)
 	if from.graph != g {
 		panic("from node is not in graph")
 	}
@@ -100,13 +133,10 @@ func (g *Graph) FastNewEdge(from, to *Node, label string, props map[string]any)
 		from:       from,
 		to:         to,
 		label:      label,
-		id:         g.idBase,
-		properties: properties(props),
+		properties: properties{m: props},
 	}
-	g.idBase++
-	g.allEdges.add(newEdge, 0)
-	g.connect(newEdge)
-	g.index.addEdgeToIndex(newEdge, g)
+	newEdge.id = g.newID()
+	g.addEdge(newEdge)
 	return newEdge
 }
 
@@ -120,6 +150,26 @@ func (g *Graph) NumEdges() int {
 	return g.allEdges.size()
 }
 
+// NumNodesWithLabel returns the number of nodes that have the label
+func (g *Graph) NumNodesWithLabel(label string) int {
+	return g.index.nodesByLabel.sizeLabel(label)
+}
+
+// NumEdgesWithLabel returns the number of edges with the label
+func (g *Graph) NumEdgesWithLabel(label string) int {
+	return g.allEdges.sizeLabel(label)
+}
+
+// GetNodeLabels returns the labels used by the nodes of the graph
+func (g *Graph) GetNodeLabels() StringSet {
+	return g.index.nodesByLabel.labels()
+}
+
+// GetEdgeLabels returns the labels used by the edges of the graph
+func (g *Graph) GetEdgeLabels() StringSet {
+	return g.allEdges.labels()
+}
+
 // GetNodes returns a node iterator that goes through all the nodes of
 // the graph. The behavior of the returned iterator is undefined if
 // during iteration nodes are updated, new nodes are added, or
@@ -154,13 +204,36 @@ func (g *Graph) GetEdgesWithAnyLabel(set StringSet) EdgeIterator {
 	return g.allEdges.iteratorAnyLabel(set, 0)
 }
 
-// AddEdgePropertyIndex adds an index for the given edge property
+// AddEdgePropertyIndex adds an index for the given edge property. It
+// panics with ErrUnsupportedIndexType for VectorIndex and SpatialIndex.
 func (g *Graph) AddEdgePropertyIndex(propertyName string, ix IndexType) {
+	switch ix {
+	case FullTextIndex:
+		g.AddEdgeFullTextIndex(propertyName, FullTextOptions{})
+		return
+	case VectorIndex, SpatialIndex:
+		panic(ErrUnsupportedIndexType{Type: ix, Msg: "Not supported for edges"})
+	}
+	checkIndexType(ix)
+	g.indexesChanged()
 	g.index.EdgePropertyIndex(propertyName, g, ix)
 }
 
 // AddNodePropertyIndex adds an index for the given node property
 func (g *Graph) AddNodePropertyIndex(propertyName string, ix IndexType) {
+	switch ix {
+	case FullTextIndex:
+		g.AddNodeFullTextIndex(propertyName, FullTextOptions{})
+		return
+	case VectorIndex:
+		g.AddNodeVectorIndex(propertyName, VectorIndexOptions{})
+		return
+	case SpatialIndex:
+		g.AddNodeSpatialIndex(propertyName, SpatialIndexOptions{})
+		return
+	}
+	checkIndexType(ix)
+	g.indexesChanged()
 	g.index.NodePropertyIndex(propertyName, g, ix)
 }
 
@@ -228,7 +301,10 @@ func (g *Graph) FindNodes(allLabels StringSet, properties map[string]interface{}
 		nodesByLabelItr = g.index.nodesByLabel.IteratorAllLabels(allLabels)
 	}
 	// Select the iterator with minimum max size
-	nodesByLabelSize := nodesByLabelItr.MaxSize()
+	nodesByLabelSize := -1
+	if nodesByLabelItr != nil {
+		nodesByLabelSize = nodesByLabelItr.MaxSize()
+	}
 	propertyIterators := make(map[string]NodeIterator)
 	if len(properties) > 0 {
 		for k, v := range properties {
@@ -239,16 +315,34 @@ func (g *Graph) FindNodes(allLabels StringSet, properties map[string]interface{}
 			propertyIterators[k] = itr
 		}
 	}
-	var minimumPropertyItrKey string
+	var minimumPropertyItr NodeIterator
 	minPropertySize := -1
-	for k, itr := range propertyIterators {
+	for _, itr := range propertyIterators {
 		maxSize := itr.MaxSize()
 		if maxSize == -1 {
 			continue
 		}
 		if minPropertySize == -1 || minPropertySize > maxSize {
 			minPropertySize = maxSize
-			minimumPropertyItrKey = k
+			minimumPropertyItr = itr
+		}
+	}
+	if itr := g.index.GetIteratorForNodeComposite(properties); itr != nil {
+		if maxSize := itr.MaxSize(); maxSize != -1 && (minPropertySize == -1 || minPropertySize > maxSize) {
+			minPropertySize = maxSize
+			minimumPropertyItr = itr
+		}
+	}
+	// Label-scoped indexes are preferred over global indexes of the
+	// same size
+	for k, v := range properties {
+		itr := g.index.GetIteratorForNodeLabelProperty(allLabels, k, v)
+		if itr == nil {
+			continue
+		}
+		if maxSize := itr.MaxSize(); maxSize != -1 && (minPropertySize == -1 || minPropertySize >= maxSize) {
+			minPropertySize = maxSize
+			minimumPropertyItr = itr
 		}
 	}
 
@@ -270,7 +364,7 @@ func (g *Graph) FindNodes(allLabels StringSet, properties map[string]interface{}
 		// Iterate by property
 		return nodeIterator{
 			&filterIterator{
-				itr: propertyIterators[minimumPropertyItrKey],
+				itr: minimumPropertyItr,
 				filter: func(item interface{}) bool {
 					return nodeFilterFunc(item.(*Node))
 				},
@@ -278,7 +372,14 @@ func (g *Graph) FindNodes(allLabels StringSet, properties map[string]interface{}
 		}
 	}
 	// Iterate all
-	return g.GetNodes()
+	return nodeIterator{
+		&filterIterator{
+			itr: g.GetNodes(),
+			filter: func(item interface{}) bool {
+				return nodeFilterFunc(item.(*Node))
+			},
+		},
+	}
 }
 
 // FindEdges returns an iterator that will iterate through all the
@@ -297,7 +398,10 @@ func (g *Graph) FindEdges(labels StringSet, properties map[string]interface{}) E
 		edgesByLabelItr = g.GetEdgesWithAnyLabel(labels)
 	}
 	// Select the iterator with minimum max size
-	edgesByLabelSize := edgesByLabelItr.MaxSize()
+	edgesByLabelSize := -1
+	if edgesByLabelItr != nil {
+		edgesByLabelSize = edgesByLabelItr.MaxSize()
+	}
 	propertyIterators := make(map[string]EdgeIterator)
 	if len(properties) > 0 {
 		for k, v := range properties {
@@ -308,16 +412,32 @@ func (g *Graph) FindEdges(labels StringSet, properties map[string]interface{}) E
 			propertyIterators[k] = itr
 		}
 	}
-	var minimumPropertyItrKey string
+	var minimumPropertyItr EdgeIterator
 	minPropertySize := -1
-	for k, itr := range propertyIterators {
+	for _, itr := range propertyIterators {
 		maxSize := itr.MaxSize()
 		if maxSize == -1 {
 			continue
 		}
 		if minPropertySize == -1 || minPropertySize > maxSize {
 			minPropertySize = maxSize
-			minimumPropertyItrKey = k
+			minimumPropertyItr = itr
+		}
+	}
+	if itr := g.index.GetIteratorForEdgeComposite(properties); itr != nil {
+		if maxSize := itr.MaxSize(); maxSize != -1 && (minPropertySize == -1 || minPropertySize > maxSize) {
+			minPropertySize = maxSize
+			minimumPropertyItr = itr
+		}
+	}
+	for k, v := range properties {
+		itr := g.index.GetIteratorForEdgeLabelProperty(labels, k, v)
+		if itr == nil {
+			continue
+		}
+		if maxSize := itr.MaxSize(); maxSize != -1 && (minPropertySize == -1 || minPropertySize >= maxSize) {
+			minPropertySize = maxSize
+			minimumPropertyItr = itr
 		}
 	}
 
@@ -339,7 +459,7 @@ func (g *Graph) FindEdges(labels StringSet, properties map[string]interface{}) E
 		// Iterate by property
 		return &edgeIterator{
 			&filterIterator{
-				itr: propertyIterators[minimumPropertyItrKey],
+				itr: minimumPropertyItr,
 				filter: func(item interface{}) bool {
 					return edgeFilterFunc(item.(*Edge))
 				},
@@ -347,7 +467,14 @@ func (g *Graph) FindEdges(labels StringSet, properties map[string]interface{}) E
 		}
 	}
 	// Iterate all
-	return g.GetEdges()
+	return &edgeIterator{
+		&filterIterator{
+			itr: g.GetEdges(),
+			filter: func(item interface{}) bool {
+				return edgeFilterFunc(item.(*Edge))
+			},
+		},
+	}
 }
 
 // GetNodeFilterFunc returns a filter function that can be used to select
@@ -372,7 +499,7 @@ func GetNodeFilterFunc(labels StringSet, properties map[string]interface{}) func
 					return false
 				}
 			}
-			if ComparePropertyValue(v, nodeValue) != 0 {
+			if c, err := ComparePropertyValueE(v, nodeValue); err != nil || c != 0 {
 				return false
 			}
 		}
@@ -402,7 +529,7 @@ func GetEdgeFilterFunc(labels StringSet, properties map[string]interface{}) func
 					return false
 				}
 			}
-			if ComparePropertyValue(v, edgeValue) != 0 {
+			if c, err := ComparePropertyValueE(v, edgeValue); err != nil || c != 0 {
 				return false
 			}
 		}
@@ -411,52 +538,86 @@ func GetEdgeFilterFunc(labels StringSet, properties map[string]interface{}) func
 }
 
 func (g *Graph) setNodeLabels(node *Node, labels StringSet) {
+	g.checkWritable()
+	oldLabels := node.labels
 	g.index.nodesByLabel.Replace(node, node.GetLabels(), labels)
+	g.index.removeNodeFromLabelIndexes(node, "")
 	node.labels = labels.Clone()
+	g.index.addNodeToLabelIndexes(node, "")
+	g.record(func() { g.setNodeLabels(node, oldLabels) })
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: NodeLabelsChangedEvent, Node: node, NodeID: node.id, Labels: node.labels.Clone(), OldLabels: oldLabels.Clone()})
+	}
+	g.markNodeDirty(node)
+	// Edge endpoint constraints depend on node labels
+	for edges := node.GetEdges(AnyEdge); edges.Next(); {
+		g.markEdgeDirty(edges.Edge())
+	}
 }
 
 func (g *Graph) setNodeProperty(node *Node, key string, value interface{}) {
+	g.checkWritable()
 	nix := g.index.isNodePropertyIndexed(key)
-	if node.properties == nil {
-		node.properties = make(properties)
-	} else {
-		oldValue, exists := node.properties[key]
-		if exists {
-			if nix != nil {
-				nix.remove(oldValue, node.id)
-			}
+	g.index.unindexNodeProperty(node, key)
+	oldValue, exists := node.properties.getProperty(key)
+	if exists {
+		if nix != nil {
+			nix.remove(oldValue, node.id)
 		}
+		g.record(func() { g.setNodeProperty(node, key, oldValue) })
+	} else {
+		g.record(func() { g.removeNodeProperty(node, key) })
 	}
-	node.properties[key] = value
+	node.properties.set(key, value)
 	if nix != nil {
 		nix.add(value, node.id, node)
 	}
+	g.index.indexNodeProperty(node, key)
+	g.markNodeDirty(node)
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: NodePropertySetEvent, Node: node, NodeID: node.id, Key: key, Value: value, OldValue: oldValue, HasOldValue: exists})
+	}
 }
 
+// cloneNode copies the node into g. It panics with
+// ErrDuplicateExternalID if the external ID of the node is already
+// used in g.
 func (g *Graph) cloneNode(sourceGraph *Graph, sourceNode *Node, cloneProperty func(string, interface{}) interface{}) *Node {
+	g.checkWritable()
+	defer g.endMutation(g.mutation(), nil)
+	if id := sourceNode.externalID; len(id) > 0 && g.index.nodesByExternalID[id] != nil {
+		panic(ErrDuplicateExternalID{ID: id})
+	}
 	newNode := &Node{
 		labels: sourceNode.labels.Clone(),
 		graph:  g,
 	}
-	if sourceNode.properties != nil {
-		newNode.properties = sourceNode.properties.clone(sourceGraph, g, cloneProperty)
-	}
-	newNode.id = g.idBase
-	g.idBase++
+	newNode.properties.m = sourceNode.properties.clone(sourceGraph, g, cloneProperty)
+	newNode.id = g.newID()
 	g.addNode(newNode)
+	if err := g.setNodeExternalID(newNode, sourceNode.externalID); err != nil {
+		panic(err)
+	}
 	return newNode
 }
 
 func (g *Graph) addNode(node *Node) {
+	g.attachProperties(&node.properties)
 	g.allNodes.add(node)
 	g.index.addNodeToIndex(node, g)
+	g.markNodeDirty(node)
+	g.record(func() {
+		g.detachProperties(&node.properties)
+		g.allNodes.remove(node)
+		g.index.removeNodeFromIndex(node, g)
+		g.emitNode(NodeRemovedEvent, node)
+	})
+	g.emitNode(NodeCreatedEvent, node)
 }
 
 func (g *Graph) removeNodeProperty(node *Node, key string) {
-	if node.properties == nil {
-		return
-	}
-	value, exists := node.properties[key]
+	g.checkWritable()
+	value, exists := node.properties.getProperty(key)
 	if !exists {
 		return
 	}
@@ -464,53 +625,100 @@ func (g *Graph) removeNodeProperty(node *Node, key string) {
 	if nix != nil {
 		nix.remove(value, node.id)
 	}
-	delete(node.properties, key)
+	g.index.unindexNodeProperty(node, key)
+	node.properties.remove(key)
+	g.record(func() { g.setNodeProperty(node, key, value) })
+	g.markNodeDirty(node)
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: NodePropertyRemovedEvent, Node: node, NodeID: node.id, Key: key, OldValue: value, HasOldValue: true})
+	}
 }
 
 func (g *Graph) detachRemoveNode(node *Node) {
+	g.checkWritable()
 	g.detachNode(node)
+	prev := node.prev
+	g.detachProperties(&node.properties)
 	g.allNodes.remove(node)
 	g.index.removeNodeFromIndex(node, g)
+	g.record(func() {
+		g.attachProperties(&node.properties)
+		g.allNodes.insertAfter(node, prev)
+		g.index.addNodeToIndex(node, g)
+		g.emitNode(NodeCreatedEvent, node)
+	})
+	g.emitNode(NodeRemovedEvent, node)
 }
 
 func (g *Graph) detachNode(node *Node) {
+	g.checkWritable()
 	for _, edge := range EdgeSlice(node.incoming.iterator(2)) {
-		g.disconnect(edge)
-		g.allEdges.remove(edge, 0)
-		g.index.removeEdgeFromIndex(edge, g)
+		g.removeEdge(edge)
 	}
 	node.incoming = edgeMap{}
 	for _, edge := range EdgeSlice(node.outgoing.iterator(1)) {
-		g.disconnect(edge)
-		g.allEdges.remove(edge, 0)
-		g.index.removeEdgeFromIndex(edge, g)
+		g.removeEdge(edge)
 	}
 	node.outgoing = edgeMap{}
 }
 
+// cloneEdge copies the edge into g. It panics with
+// ErrDuplicateExternalID if the external ID of the edge is already
+// used in g.
 func (g *Graph) cloneEdge(from, to *Node, sourceEdge *Edge, cloneProperty func(string, interface{}) interface{}) *Edge {
+	g.checkWritable()
+	defer g.endMutation(g.mutation(), nil)
 	if from.graph != g {
 		panic("from node is not in graph")
 	}
 	if to.graph != g {
 		panic("to node is not in graph")
 	}
+	if id := sourceEdge.externalID; len(id) > 0 && g.index.edgesByExternalID[id] != nil {
+		panic(ErrDuplicateExternalID{ID: id})
+	}
 	newEdge := &Edge{
 		from:  from,
 		to:    to,
 		label: sourceEdge.label,
-		id:    g.idBase,
+		id:    g.newID(),
 	}
-	if sourceEdge.properties != nil {
-		newEdge.properties = sourceEdge.properties.clone(to.graph, g, cloneProperty)
+	newEdge.properties.m = sourceEdge.properties.clone(to.graph, g, cloneProperty)
+	g.addEdge(newEdge)
+	if err := g.setEdgeExternalID(newEdge, sourceEdge.externalID); err != nil {
+		panic(err)
 	}
-	g.idBase++
-	g.allEdges.add(newEdge, 0)
-	g.connect(newEdge)
-	g.index.addEdgeToIndex(newEdge, g)
 	return newEdge
 }
 
+func (g *Graph) addEdge(edge *Edge) {
+	g.attachProperties(&edge.properties)
+	g.allEdges.add(edge, 0)
+	g.connect(edge)
+	g.index.addEdgeToIndex(edge, g)
+	g.record(func() {
+		g.removeEdge(edge)
+	})
+	g.markEdgeDirty(edge)
+	g.emitEdge(EdgeCreatedEvent, edge)
+}
+
+// attachProperties starts paging the properties of a node or edge
+// added to a disk graph
+func (g *Graph) attachProperties(p *properties) {
+	if g.pager != nil {
+		g.pager.attach(p)
+	}
+}
+
+// detachProperties loads the properties of a node or edge removed
+// from a disk graph, so they remain accessible
+func (g *Graph) detachProperties(p *properties) {
+	if g.pager != nil {
+		g.pager.detach(p)
+	}
+}
+
 func (g *Graph) connect(edge *Edge) {
 	edge.to.incoming.add(edge, 2)
 	edge.from.outgoing.add(edge, 1)
@@ -522,39 +730,65 @@ func (g *Graph) disconnect(edge *Edge) {
 }
 
 func (g *Graph) setEdgeLabel(edge *Edge, label string) {
+	g.checkWritable()
+	oldLabel := edge.label
 	g.disconnect(edge)
+	g.allEdges.remove(edge, 0)
+	g.index.removeEdgeFromLabelIndexes(edge, "")
 	edge.label = label
+	g.index.addEdgeToLabelIndexes(edge, "")
+	g.allEdges.add(edge, 0)
 	g.connect(edge)
+	g.record(func() { g.setEdgeLabel(edge, oldLabel) })
+	g.markEdgeDirty(edge)
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: EdgeRelabeledEvent, Edge: edge, EdgeID: edge.id, Label: label, OldLabel: oldLabel})
+	}
 }
 
 func (g *Graph) removeEdge(edge *Edge) {
+	g.checkWritable()
+	g.detachProperties(&edge.properties)
 	g.disconnect(edge)
 	g.allEdges.remove(edge, 0)
+	g.index.removeEdgeFromIndex(edge, g)
+	g.record(func() {
+		g.attachProperties(&edge.properties)
+		g.allEdges.add(edge, 0)
+		g.connect(edge)
+		g.index.addEdgeToIndex(edge, g)
+		g.emitEdge(EdgeCreatedEvent, edge)
+	})
+	g.emitEdge(EdgeRemovedEvent, edge)
 }
 
 func (g *Graph) setEdgeProperty(edge *Edge, key string, value interface{}) {
+	g.checkWritable()
 	nix := g.index.isEdgePropertyIndexed(key)
-	if edge.properties == nil {
-		edge.properties = make(properties)
-	} else {
-		oldValue, exists := edge.properties[key]
-		if exists {
-			if nix != nil {
-				nix.remove(oldValue, edge.id)
-			}
+	g.index.unindexEdgeProperty(edge, key)
+	oldValue, exists := edge.properties.getProperty(key)
+	if exists {
+		if nix != nil {
+			nix.remove(oldValue, edge.id)
 		}
+		g.record(func() { g.setEdgeProperty(edge, key, oldValue) })
+	} else {
+		g.record(func() { g.removeEdgeProperty(edge, key) })
 	}
-	edge.properties[key] = value
+	edge.properties.set(key, value)
 	if nix != nil {
 		nix.add(value, edge.id, edge)
 	}
+	g.index.indexEdgeProperty(edge, key)
+	g.markEdgeDirty(edge)
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: EdgePropertySetEvent, Edge: edge, EdgeID: edge.id, Key: key, Value: value, OldValue: oldValue, HasOldValue: exists})
+	}
 }
 
 func (g *Graph) removeEdgeProperty(edge *Edge, key string) {
-	if edge.properties == nil {
-		return
-	}
-	oldValue, exists := edge.properties[key]
+	g.checkWritable()
+	oldValue, exists := edge.properties.getProperty(key)
 	if !exists {
 		return
 	}
@@ -562,7 +796,13 @@ func (g *Graph) removeEdgeProperty(edge *Edge, key string) {
 	if nix != nil {
 		nix.remove(oldValue, edge.id)
 	}
-	delete(edge.properties, key)
+	g.index.unindexEdgeProperty(edge, key)
+	edge.properties.remove(key)
+	g.record(func() { g.setEdgeProperty(edge, key, oldValue) })
+	g.markEdgeDirty(edge)
+	if len(g.observers) > 0 {
+		g.emit(GraphEvent{Type: EdgePropertyRemovedEvent, Edge: edge, EdgeID: edge.id, Key: key, OldValue: oldValue, HasOldValue: true})
+	}
 }
 
 type WithProperties interface {
@@ -581,6 +821,7 @@ func buildPropertyFilterFunc(key string, value interface{}) func(WithProperties)
 				cmp = false
 			}
 		}()
-		return ComparePropertyValue(value, pvalue) == 0
+		c, err := ComparePropertyValueE(value, pvalue)
+		return err == nil && c == 0
 	}
 }
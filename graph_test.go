@@ -15,6 +15,8 @@
 package lpg
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -144,3 +146,284 @@ func BenchmarkItrNodeEdges(b *testing.B) {
 	}
 	_ = edge
 }
+
+func TestFindWithoutIndex(t *testing.T) {
+	g := NewGraph()
+	a := g.NewNode([]string{"A"}, map[string]interface{}{"key": 1})
+	b := g.NewNode(nil, map[string]interface{}{"key": 2})
+	g.NewEdge(a, b, "x", map[string]interface{}{"key": 1})
+	g.NewEdge(b, a, "", map[string]interface{}{"key": 2})
+	// Properties without labels and without an index scan all nodes
+	// and edges, and return only the matching ones
+	nodes := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 2}))
+	if len(nodes) != 1 || nodes[0] != b {
+		t.Errorf("Wrong nodes: %v", nodes)
+	}
+	edges := EdgeSlice(g.FindEdges(StringSet{}, map[string]interface{}{"key": 1}))
+	if len(edges) != 1 || edges[0].GetLabel() != "x" {
+		t.Errorf("Wrong edges: %v", edges)
+	}
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 3}))); n != 0 {
+		t.Errorf("Expecting no nodes, got %d", n)
+	}
+}
+
+func TestRemoveUpdatesIndexes(t *testing.T) {
+	g := NewGraph()
+	g.AddEdgePropertyIndex("w", HashIndex)
+	a := g.NewNode(nil, nil)
+	b := g.NewNode(nil, nil)
+	e1 := g.NewEdge(a, b, "x", map[string]interface{}{"w": 1})
+	g.NewEdge(b, a, "x", map[string]interface{}{"w": 2})
+
+	// Removing the last node updates the tail of the node list, so
+	// new nodes are reachable
+	b.DetachAndRemove()
+	c := g.NewNode(nil, nil)
+	if nodes := NodeSlice(g.GetNodes()); len(nodes) != 2 || nodes[0] != a || nodes[1] != c {
+		t.Errorf("Wrong nodes: %v", nodes)
+	}
+	// Removing edges removes them from the property index
+	if n := len(EdgeSlice(g.FindEdges(StringSet{}, map[string]interface{}{"w": 1}))); n != 0 {
+		t.Errorf("Removed edge is still indexed")
+	}
+
+	// Relabeling an edge updates the edges by label
+	e1 = g.NewEdge(a, c, "x", nil)
+	e1.SetLabel("y")
+	if g.NumEdgesWithLabel("x") != 0 || g.NumEdgesWithLabel("y") != 1 {
+		t.Errorf("Wrong label counts")
+	}
+	if edges := EdgeSlice(g.GetEdgesWithAnyLabel(NewStringSet("y"))); len(edges) != 1 || edges[0] != e1 {
+		t.Errorf("Wrong edges: %v", edges)
+	}
+	if n := len(EdgeSlice(g.GetEdgesWithAnyLabel(NewStringSet("x")))); n != 0 {
+		t.Errorf("Relabeled edge still has the old label")
+	}
+}
+
+func TestGetByID(t *testing.T) {
+	g := NewGraph()
+	n1 := g.NewNode([]string{"a"}, nil)
+	n2 := g.NewNode([]string{"b"}, nil)
+	e := g.NewEdge(n1, n2, "e", nil)
+	if g.GetNode(n1.GetID()) != n1 || g.GetNode(n2.GetID()) != n2 || g.GetEdge(e.GetID()) != e {
+		t.Errorf("Lookup failed")
+	}
+	if g.HasNode(e.GetID()) || g.HasEdge(n1.GetID()) {
+		t.Errorf("Wrong lookup")
+	}
+	if _, err := g.NewNodeWithID(e.GetID(), nil, nil); err == nil {
+		t.Errorf("Expecting duplicate ID error")
+	}
+	n3, err := g.NewNodeWithID(100, []string{"c"}, nil)
+	if err != nil || g.GetNode(100) != n3 {
+		t.Errorf("Cannot create node with ID: %v", err)
+	}
+	if n4 := g.NewNode(nil, nil); n4.GetID() != 101 {
+		t.Errorf("Wrong ID: %d", n4.GetID())
+	}
+	tx := g.Begin()
+	g.NewNodeWithID(200, nil, nil)
+	tx.Rollback()
+	if g.HasNode(200) || g.NewNode(nil, nil).GetID() != 102 {
+		t.Errorf("Rollback failed")
+	}
+	e.Remove()
+	if g.HasEdge(e.GetID()) {
+		t.Errorf("Edge not removed")
+	}
+	n1.DetachAndRemove()
+	if g.HasNode(n1.GetID()) {
+		t.Errorf("Node not removed")
+	}
+
+	// Reload with the same IDs
+	buf := bytes.Buffer{}
+	j := JSON{UseNodeIDs: true}
+	if err := j.Encode(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	newg := NewGraph()
+	if err := j.Decode(newg, json.NewDecoder(&buf)); err != nil {
+		t.Error(err)
+		return
+	}
+	if !newg.GetNode(100).HasLabel("c") || !newg.GetNode(n2.GetID()).HasLabel("b") {
+		t.Errorf("IDs not preserved")
+	}
+
+	// An edge from a node to an earlier node, before a later node
+	g = NewGraph()
+	a := g.NewNode([]string{"a"}, nil)
+	b := g.NewNode([]string{"b"}, nil)
+	g.NewNode([]string{"c"}, nil)
+	g.NewEdge(b, a, "e", nil)
+	for _, j := range []JSON{{UseNodeIDs: true}, {UseNodeIDs: true, MarshalEdgesSeparately: true}} {
+		buf.Reset()
+		if err := j.Encode(g, &buf); err != nil {
+			t.Error(err)
+			return
+		}
+		newg = NewGraph()
+		if err := j.Decode(newg, json.NewDecoder(&buf)); err != nil {
+			t.Error(err)
+			continue
+		}
+		if newg.NumNodes() != 3 || newg.NumEdges() != 1 || !newg.GetNode(2).HasLabel("c") {
+			t.Errorf("Wrong graph")
+		}
+	}
+}
+
+func TestExternalID(t *testing.T) {
+	g := NewGraph()
+	n1 := g.NewNode([]string{"a"}, nil)
+	n2 := g.NewNode([]string{"b"}, nil)
+	e := g.NewEdge(n1, n2, "e", nil)
+	if err := n1.SetExternalID("n1"); err != nil {
+		t.Error(err)
+	}
+	if err := n2.SetExternalID("n1"); err == nil {
+		t.Errorf("Expecting duplicate error")
+	}
+	n2.SetExternalID("n2")
+	e.SetExternalID("e1")
+	if g.GetNodeByExternalID("n1") != n1 || g.GetEdgeByExternalID("e1") != e {
+		t.Errorf("Lookup failed")
+	}
+
+	target := NewGraph()
+	CopyGraph(g, target, nil)
+	if target.GetNodeByExternalID("n2") == nil || target.GetEdgeByExternalID("e1") == nil {
+		t.Errorf("External IDs not copied")
+	}
+	// Copying again reports the duplicate external ID
+	func() {
+		defer func() {
+			if _, ok := recover().(ErrDuplicateExternalID); !ok {
+				t.Errorf("Expecting duplicate error")
+			}
+		}()
+		CopyGraph(g, target, nil)
+	}()
+	if target.NumNodes() != 2 {
+		t.Errorf("Node with duplicate external ID copied")
+	}
+
+	buf := bytes.Buffer{}
+	if err := (JSON{}).Encode(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	data := buf.Bytes()
+	newg := NewGraph()
+	if err := (JSON{}).Decode(newg, json.NewDecoder(bytes.NewReader(data))); err != nil {
+		t.Error(err)
+		return
+	}
+	if !newg.GetNodeByExternalID("n1").HasLabel("a") || newg.GetEdgeByExternalID("e1").GetFrom() != newg.GetNodeByExternalID("n1") {
+		t.Errorf("External IDs not decoded: %s", string(data))
+	}
+	// Decoding again fails, merging succeeds
+	if err := (JSON{}).Decode(newg, json.NewDecoder(bytes.NewReader(data))); err == nil {
+		t.Errorf("Expecting duplicate error")
+	}
+	if _, err := (JSON{}).DecodePaths(newg, json.NewDecoder(bytes.NewReader(data))); err == nil {
+		t.Errorf("Expecting duplicate error")
+	}
+	newg = NewGraph()
+	for i := 0; i < 2; i++ {
+		if _, err := (JSON{}).Merge(newg, json.NewDecoder(bytes.NewReader(data)), ""); err != nil {
+			t.Error(err)
+		}
+	}
+	if newg.NumNodes() != 2 || newg.NumEdges() != 1 {
+		t.Errorf("Wrong merge: %d %d", newg.NumNodes(), newg.NumEdges())
+	}
+
+	n1.DetachAndRemove()
+	if g.GetNodeByExternalID("n1") != nil || g.GetEdgeByExternalID("e1") != nil {
+		t.Errorf("External IDs not removed")
+	}
+}
+
+func TestLabelCounts(t *testing.T) {
+	g := NewGraph()
+	a := g.NewNode([]string{"Person"}, nil)
+	b := g.NewNode([]string{"Person", "Employee"}, nil)
+	c := g.NewNode([]string{"Company"}, nil)
+	g.NewEdge(a, b, "knows", nil)
+	g.NewEdge(b, a, "knows", nil)
+	e := g.NewEdge(a, c, "worksAt", nil)
+	g.NewEdge(a, a, "self", nil)
+
+	if n := g.NumNodesWithLabel("Person"); n != 2 {
+		t.Errorf("Person: %d", n)
+	}
+	if n := g.NumEdgesWithLabel("knows"); n != 2 {
+		t.Errorf("knows: %d", n)
+	}
+	if labels := g.GetNodeLabels(); !labels.IsEqual(NewStringSet("Person", "Employee", "Company")) {
+		t.Errorf("Node labels: %v", labels)
+	}
+	if labels := g.GetEdgeLabels(); !labels.IsEqual(NewStringSet("knows", "worksAt", "self")) {
+		t.Errorf("Edge labels: %v", labels)
+	}
+	if a.Degree(OutgoingEdge) != 3 || a.Degree(IncomingEdge) != 2 || a.Degree(AnyEdge) != 5 {
+		t.Errorf("Wrong degree: %d %d", a.Degree(OutgoingEdge), a.Degree(IncomingEdge))
+	}
+	if a.DegreeWithLabel(OutgoingEdge, "knows") != 1 || a.DegreeWithLabel(AnyEdge, "knows") != 2 || c.DegreeWithLabel(IncomingEdge, "knows") != 0 {
+		t.Errorf("Wrong degree with label")
+	}
+	if labels := a.GetEdgeLabels(OutgoingEdge); !labels.IsEqual(NewStringSet("knows", "worksAt", "self")) {
+		t.Errorf("Outgoing labels: %v", labels)
+	}
+	if sz := g.GetEdgesWithAnyLabel(NewStringSet("knows", "self", "missing")).MaxSize(); sz != 3 {
+		t.Errorf("Wrong MaxSize: %d", sz)
+	}
+
+	// Counts follow mutations
+	e.SetLabel("employedBy")
+	c.SetLabels(NewStringSet("Organization"))
+	b.DetachAndRemove()
+	if g.NumEdgesWithLabel("knows") != 0 || g.NumEdgesWithLabel("worksAt") != 0 || g.NumEdgesWithLabel("employedBy") != 1 {
+		t.Errorf("Edge counts not updated")
+	}
+	if labels := g.GetNodeLabels(); !labels.IsEqual(NewStringSet("Person", "Organization")) {
+		t.Errorf("Node labels: %v", labels)
+	}
+	if labels := g.GetEdgeLabels(); !labels.IsEqual(NewStringSet("employedBy", "self")) {
+		t.Errorf("Edge labels: %v", labels)
+	}
+}
+
+func TestClearLabelCounts(t *testing.T) {
+	g := NewGraph()
+	n := g.NewNode([]string{"A", "B"}, nil)
+	g.NewNode([]string{"B"}, nil)
+	check := func(name string, a, b int, labels StringSet) {
+		if g.NumNodesWithLabel("A") != a || g.NumNodesWithLabel("B") != b {
+			t.Errorf("%s: Wrong counts: %d %d", name, g.NumNodesWithLabel("A"), g.NumNodesWithLabel("B"))
+		}
+		if l := g.GetNodeLabels(); !l.IsEqual(labels) {
+			t.Errorf("%s: Wrong labels: %v", name, l)
+		}
+		if found := len(NodeSlice(g.FindNodes(NewStringSet("A"), nil))); found != a {
+			t.Errorf("%s: Found %d", name, found)
+		}
+	}
+	n.SetLabels(NewStringSet())
+	check("clear", 0, 1, NewStringSet("B"))
+	n.SetLabels(NewStringSet("A"))
+	check("set", 1, 1, NewStringSet("A", "B"))
+
+	tx := g.Begin()
+	n.SetLabels(NewStringSet())
+	check("clear in tx", 0, 1, NewStringSet("B"))
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+	check("rollback", 1, 1, NewStringSet("A", "B"))
+}
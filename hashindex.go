@@ -15,9 +15,93 @@
 package lpg
 
 import (
+	"bytes"
 	"container/list"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
 )
 
+// hashKey returns the key for the value, so that values that are equal
+// by ComparePropertyValue have the same key. Numbers are normalized to
+// int64 if they are integers, larger unsigned integers to the equal
+// float64 if there is one, and all NaNs to the same key. Times are
+// normalized to UTC. Slices and maps are encoded.
+func hashKey(value interface{}) interface{} {
+	value = normalizeHashValue(value)
+	switch value.(type) {
+	case nil, string, bool, int64, float64, time.Time, nanKey:
+		return value
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Map:
+		return encodeKey(value)
+	}
+	return value
+}
+
+func normalizeHashValue(value interface{}) interface{} {
+	if native, ok := value.(WithNativeValue); ok {
+		value = native.GetNativeValue()
+	}
+	switch t := value.(type) {
+	case int:
+		return int64(t)
+	case int8, int16, int32, uint, uint8, uint16, uint32, uint64, float32, float64:
+		n := toNumeric(t)
+		switch n.kind {
+		case numInt:
+			return n.i
+		case numUint:
+			if n.u <= math.MaxInt64 {
+				return int64(n.u)
+			}
+			// Use the equal float, if there is one
+			if f := float64(n.u); f < two64 && uint64(f) == n.u {
+				return f
+			}
+			return n.u
+		}
+		if math.IsNaN(n.f) {
+			// NaN is not equal to itself, so it cannot be a map key
+			return nanKey{}
+		}
+		if n.f >= -two63 && n.f < two63 && n.f == math.Trunc(n.f) {
+			return int64(n.f)
+		}
+		return n.f
+	case time.Time:
+		return t.UTC()
+	}
+	return value
+}
+
+// nanKey is the hash key for NaN values, which are equal by
+// ComparePropertyValue
+type nanKey struct{}
+
+// encodedKey is the hash key for values that are not hashable, such
+// as slices and maps, and for composite keys
+type encodedKey string
+
+// encodeKey returns a key encoding the values
+func encodeKey(values ...interface{}) encodedKey {
+	buf := bytes.Buffer{}
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := EncodeTypedJSONValue(normalizeHashValue(v))
+		if err != nil {
+			fmt.Fprintf(&buf, "%T:%v", v, v)
+			continue
+		}
+		buf.Write(data)
+	}
+	return encodedKey(buf.String())
+}
+
 // A hashIndex is a hash table index
 type hashIndex struct {
 	values   map[interface{}]*fastSet
@@ -29,26 +113,24 @@ func (ix *hashIndex) add(value interface{}, id int, item interface{}) {
 		ix.values = make(map[interface{}]*fastSet)
 	}
 
-	if native, ok := value.(WithNativeValue); ok {
-		value = native.GetNativeValue()
-	}
+	value = hashKey(value)
 
-	el := ix.elements.PushBack(item)
 	fs, ok := ix.values[value]
 	if !ok {
 		fs = newFastSet()
 		ix.values[value] = fs
 	}
-	fs.add(id, el)
+	if fs.has(id) {
+		return
+	}
+	fs.add(id, ix.elements.PushBack(item))
 }
 
 func (ix *hashIndex) remove(value interface{}, id int) {
 	if ix.values == nil {
 		return
 	}
-	if native, ok := value.(WithNativeValue); ok {
-		value = native.GetNativeValue()
-	}
+	value = hashKey(value)
 	fs, ok := ix.values[value]
 	if !ok {
 		return
@@ -59,6 +141,9 @@ func (ix *hashIndex) remove(value interface{}, id int) {
 	}
 	fs.remove(id)
 	ix.elements.Remove(el.(*list.Element))
+	if fs.size() == 0 {
+		delete(ix.values, value)
+	}
 }
 
 // find returns the iterator and expected size.
@@ -66,9 +151,7 @@ func (ix *hashIndex) find(value interface{}) Iterator {
 	if ix.values == nil {
 		return emptyIterator{}
 	}
-	if native, ok := value.(WithNativeValue); ok {
-		value = native.GetNativeValue()
-	}
+	value = hashKey(value)
 	v, found := ix.values[value]
 	if !found {
 		return emptyIterator{}
@@ -77,6 +160,16 @@ func (ix *hashIndex) find(value interface{}) Iterator {
 	return withSize(itr, v.size())
 }
 
+func (ix *hashIndex) stats() IndexStats {
+	entries := ix.elements.Len()
+	distinct := len(ix.values)
+	return IndexStats{
+		Entries:        entries,
+		DistinctValues: distinct,
+		MemoryEstimate: distinct*(mapEntryBytes+setBytes) + entries*(mapEntryBytes+2*listElementBytes),
+	}
+}
+
 func (ix *hashIndex) valueItr() Iterator {
 	if ix.values == nil {
 		return emptyIterator{}
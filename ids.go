@@ -0,0 +1,136 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+)
+
+// ErrDuplicateID is returned when a node or edge is created with an
+// ID that is already used in the graph
+type ErrDuplicateID struct {
+	ID int
+}
+
+func (e ErrDuplicateID) Error() string { return fmt.Sprintf("Duplicate ID: %d", e.ID) }
+
+// newID allocates a new node or edge ID
+func (g *Graph) newID() int {
+	id := g.idBase
+	g.setIDBase(id + 1)
+	return id
+}
+
+func (g *Graph) setIDBase(n int) {
+	old := g.idBase
+	g.idBase = n
+	g.record(func() { g.idBase = old })
+}
+
+// useID checks if id is available, and makes sure future IDs are
+// allocated after it
+func (g *Graph) useID(id int) error {
+	if g.HasNode(id) || g.HasEdge(id) {
+		return ErrDuplicateID{ID: id}
+	}
+	if id >= g.idBase {
+		g.setIDBase(id + 1)
+	}
+	return nil
+}
+
+// GetNode returns the node with the given ID, or nil if there is no
+// such node
+func (g *Graph) GetNode(id int) *Node {
+	return g.index.nodesByID[id]
+}
+
+// HasNode returns true if there is a node with the given ID
+func (g *Graph) HasNode(id int) bool {
+	_, ok := g.index.nodesByID[id]
+	return ok
+}
+
+// GetEdge returns the edge with the given ID, or nil if there is no
+// such edge
+func (g *Graph) GetEdge(id int) *Edge {
+	return g.index.edgesByID[id]
+}
+
+// HasEdge returns true if there is an edge with the given ID
+func (g *Graph) HasEdge(id int) bool {
+	_, ok := g.index.edgesByID[id]
+	return ok
+}
+
+// NewNodeWithID creates a new node with the given ID, labels, and
+// properties. Returns ErrDuplicateID if there is already a node or
+// edge with the ID. This can be used to reload a graph with the same
+// IDs. Nodes and edges created later get IDs greater than id.
+func (g *Graph) NewNodeWithID(id int, labels []string, props map[string]interface{}) (ret *Node, err error) {
+	g.checkWritable()
+	defer g.endMutation(g.mutation(), &err)
+	if err := g.useID(id); err != nil {
+		return nil, err
+	}
+	var p map[string]any
+	if len(props) > 0 {
+		p = make(map[string]any, len(props))
+		for k, v := range props {
+			p[k] = v
+		}
+	}
+	node := &Node{
+		labels:     NewStringSet(labels...),
+		graph:      g,
+		properties: properties{m: p},
+		id:         id,
+	}
+	g.addNode(node)
+	return node, nil
+}
+
+// NewEdgeWithID creates a new edge with the given ID. Returns
+// ErrDuplicateID if there is already a node or edge with the ID. Both
+// nodes must be nodes of this graph, otherwise this call panics.
+func (g *Graph) NewEdgeWithID(id int, from, to *Node, label string, props map[string]interface{}) (ret *Edge, err error) {
+	g.checkWritable()
+	defer g.endMutation(g.mutation(), &err)
+	if from.graph != g {
+		panic("from node is not in graph")
+	}
+	if to.graph != g {
+		panic("to node is not in graph")
+	}
+	if err := g.useID(id); err != nil {
+		return nil, err
+	}
+	var p map[string]any
+	if len(props) > 0 {
+		p = make(map[string]any, len(props))
+		for k, v := range props {
+			p[k] = v
+		}
+	}
+	edge := &Edge{
+		from:       from,
+		to:         to,
+		label:      label,
+		id:         id,
+		properties: properties{m: p},
+	}
+	g.addEdge(edge)
+	return edge, nil
+}
@@ -0,0 +1,346 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rough memory costs in bytes on 64-bit platforms, used to estimate
+// the memory used by the indexes
+const (
+	mapBytes          = 48
+	mapEntryBytes     = 48
+	listElementBytes  = 48
+	treeNodeBytes     = 64
+	sliceBytes        = 24
+	intBytes          = 8
+	setBytes          = mapBytes + listElementBytes
+	vectorEntryBytes  = 96
+	spatialEntryBytes = 64
+)
+
+// IndexStats are the statistics of an index
+type IndexStats struct {
+	// Entries is the number of indexed nodes or edges
+	Entries int
+	// DistinctValues is the number of distinct keys of the index. This
+	// is the number of distinct values for btree and hash indexes, the
+	// number of distinct terms for full-text indexes, the number of
+	// vectors for vector indexes, and the number of non-empty grid
+	// cells for spatial indexes.
+	DistinctValues int
+	// MemoryEstimate is a rough estimate of the memory used by the
+	// index in bytes, excluding the nodes, edges, and property values
+	MemoryEstimate int
+}
+
+// IndexInfo describes an index of the graph
+type IndexInfo struct {
+	// Edge is true for an edge index, and false for a node index
+	Edge bool
+	Type IndexType
+	// Keys are the indexed property keys. Only composite indexes have
+	// more than one key.
+	Keys      []string
+	Composite bool
+	// Label is the label of a label-scoped index
+	Label string
+	// Stats are the statistics of the index when the index
+	// information is returned
+	Stats IndexStats
+}
+
+func (info IndexInfo) String() string {
+	kind := "node"
+	if info.Edge {
+		kind = "edge"
+	}
+	typ := info.Type.String()
+	if info.Composite {
+		typ += " composite"
+	}
+	return fmt.Sprintf("%s %s index on %s(%s)", kind, typ, info.Label, strings.Join(info.Keys, ","))
+}
+
+func (info IndexInfo) sameIndex(other IndexInfo) bool {
+	if info.Edge != other.Edge || info.Type != other.Type || info.Composite != other.Composite || info.Label != other.Label || len(info.Keys) != len(other.Keys) {
+		return false
+	}
+	for i := range info.Keys {
+		if info.Keys[i] != other.Keys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// catalogEntry is an index in the catalog, with functions to get
+// its statistics, to drop it, and to create it again
+type catalogEntry struct {
+	info   IndexInfo
+	stats  func() IndexStats
+	drop   func()
+	create func(*Graph)
+}
+
+func (g *graphIndex) catalog() []catalogEntry {
+	ret := make([]catalogEntry, 0)
+	for k, ix := range g.nodeProperties {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Type: indexTypeOf(ix), Keys: []string{k}},
+			stats:  ix.stats,
+			drop:   func() { delete(g.nodeProperties, k) },
+			create: func(graph *Graph) { g.NodePropertyIndex(k, graph, indexTypeOf(ix)) },
+		})
+	}
+	for k, ix := range g.edgeProperties {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Edge: true, Type: indexTypeOf(ix), Keys: []string{k}},
+			stats:  ix.stats,
+			drop:   func() { delete(g.edgeProperties, k) },
+			create: func(graph *Graph) { g.EdgePropertyIndex(k, graph, indexTypeOf(ix)) },
+		})
+	}
+	for _, c := range g.nodeComposites {
+		c := c
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Type: c.typ, Keys: append([]string{}, c.keys...), Composite: true},
+			stats:  c.ix.stats,
+			drop:   func() { g.nodeComposites = removeComposite(g.nodeComposites, c) },
+			create: func(graph *Graph) { g.NodeCompositeIndex(c.keys, graph, c.typ) },
+		})
+	}
+	for _, c := range g.edgeComposites {
+		c := c
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Edge: true, Type: c.typ, Keys: append([]string{}, c.keys...), Composite: true},
+			stats:  c.ix.stats,
+			drop:   func() { g.edgeComposites = removeComposite(g.edgeComposites, c) },
+			create: func(graph *Graph) { g.EdgeCompositeIndex(c.keys, graph, c.typ) },
+		})
+	}
+	for k, ix := range g.nodeLabelProperties {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Type: indexTypeOf(ix), Keys: []string{k.property}, Label: k.label},
+			stats:  ix.stats,
+			drop:   func() { delete(g.nodeLabelProperties, k) },
+			create: func(graph *Graph) { g.NodeLabelPropertyIndex(k.label, k.property, graph, indexTypeOf(ix)) },
+		})
+	}
+	for k, ix := range g.edgeLabelProperties {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Edge: true, Type: indexTypeOf(ix), Keys: []string{k.property}, Label: k.label},
+			stats:  ix.stats,
+			drop:   func() { delete(g.edgeLabelProperties, k) },
+			create: func(graph *Graph) { g.EdgeLabelPropertyIndex(k.label, k.property, graph, indexTypeOf(ix)) },
+		})
+	}
+	for k, ix := range g.nodeFullText {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Type: FullTextIndex, Keys: []string{k}},
+			stats:  ix.stats,
+			drop:   func() { delete(g.nodeFullText, k) },
+			create: func(graph *Graph) { g.NodeFullTextIndex(k, graph, ix.options) },
+		})
+	}
+	for k, ix := range g.edgeFullText {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Edge: true, Type: FullTextIndex, Keys: []string{k}},
+			stats:  ix.stats,
+			drop:   func() { delete(g.edgeFullText, k) },
+			create: func(graph *Graph) { g.EdgeFullTextIndex(k, graph, ix.options) },
+		})
+	}
+	for k, ix := range g.nodeVectors {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Type: VectorIndex, Keys: []string{k}},
+			stats:  ix.stats,
+			drop:   func() { delete(g.nodeVectors, k) },
+			create: func(graph *Graph) { g.NodeVectorIndex(k, graph, ix.options) },
+		})
+	}
+	for k, ix := range g.nodeSpatial {
+		k, ix := k, ix
+		ret = append(ret, catalogEntry{
+			info:   IndexInfo{Type: SpatialIndex, Keys: []string{k}},
+			stats:  ix.stats,
+			drop:   func() { delete(g.nodeSpatial, k) },
+			create: func(graph *Graph) { g.NodeSpatialIndex(k, graph, ix.options) },
+		})
+	}
+	return ret
+}
+
+func hasCatalogEntry(entries []catalogEntry, info IndexInfo) bool {
+	for _, entry := range entries {
+		if entry.info.sameIndex(info) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexesChanged is called before the indexes of the graph are
+// created, dropped, or rebuilt. It counts the changes, and records an
+// undo operation that restores the current indexes, so creating and
+// dropping indexes in a transaction can be rolled back. Panics if the
+// graph is read-only.
+func (g *Graph) indexesChanged() {
+	g.checkWritable()
+	g.indexVersion++
+	if g.tx == nil {
+		return
+	}
+	saved := g.index.catalog()
+	g.record(func() {
+		g.indexVersion++
+		current := g.index.catalog()
+		for _, entry := range current {
+			if !hasCatalogEntry(saved, entry.info) {
+				entry.drop()
+			}
+		}
+		for _, entry := range saved {
+			if !hasCatalogEntry(current, entry.info) {
+				entry.create(g)
+			}
+		}
+	})
+}
+
+func removeComposite(composites []*compositeIndex, c *compositeIndex) []*compositeIndex {
+	for i := range composites {
+		if composites[i] == c {
+			return append(composites[:i:i], composites[i+1:]...)
+		}
+	}
+	return composites
+}
+
+func (g *graphIndex) findCatalogEntry(info IndexInfo) (catalogEntry, bool) {
+	for _, entry := range g.catalog() {
+		if entry.info.sameIndex(info) {
+			return entry, true
+		}
+	}
+	return catalogEntry{}, false
+}
+
+// propertyStats returns the statistics of the node or edge property
+// index for the key
+func (g *graphIndex) propertyStats(edge bool, key string) (IndexStats, bool) {
+	var ix index
+	if edge {
+		ix = g.edgeProperties[key]
+	} else {
+		ix = g.nodeProperties[key]
+	}
+	if ix == nil {
+		return IndexStats{}, false
+	}
+	return ix.stats(), true
+}
+
+// GetIndexes returns the indexes of the graph with their current
+// statistics. Node indexes come before edge indexes, and the indexes
+// are sorted by label and keys.
+func (g *Graph) GetIndexes() []IndexInfo {
+	entries := g.index.catalog()
+	ret := make([]IndexInfo, 0, len(entries))
+	for _, entry := range entries {
+		info := entry.info
+		info.Stats = entry.stats()
+		ret = append(ret, info)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.Edge != b.Edge {
+			return !a.Edge
+		}
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		if ak, bk := strings.Join(a.Keys, ","), strings.Join(b.Keys, ","); ak != bk {
+			return ak < bk
+		}
+		if a.Composite != b.Composite {
+			return !a.Composite
+		}
+		return a.Type < b.Type
+	})
+	return ret
+}
+
+// GetIndexStats returns the current statistics of the index described
+// by info. The Stats field of info is ignored. Returns false if there
+// is no such index.
+func (g *Graph) GetIndexStats(info IndexInfo) (IndexStats, bool) {
+	entry, ok := g.index.findCatalogEntry(info)
+	if !ok {
+		return IndexStats{}, false
+	}
+	return entry.stats(), true
+}
+
+// DropIndex removes the index described by info. The Stats field of
+// info is ignored. Returns false if there is no such index. If a
+// unique constraint uses the dropped index, the constraint is checked
+// by scanning the nodes.
+func (g *Graph) DropIndex(info IndexInfo) bool {
+	g.checkWritable()
+	entry, ok := g.index.findCatalogEntry(info)
+	if !ok {
+		return false
+	}
+	g.indexesChanged()
+	entry.drop()
+	return true
+}
+
+// RebuildIndex builds the index described by info again from the
+// nodes or edges of the graph, with the same options. This compacts
+// the index, for example by removing the deleted entries of an
+// approximate vector index. Returns false if there is no such index.
+func (g *Graph) RebuildIndex(info IndexInfo) bool {
+	g.checkWritable()
+	entry, ok := g.index.findCatalogEntry(info)
+	if !ok {
+		return false
+	}
+	g.indexesChanged()
+	entry.drop()
+	entry.create(g)
+	return true
+}
+
+// RebuildIndexes rebuilds all indexes of the graph
+func (g *Graph) RebuildIndexes() {
+	g.checkWritable()
+	g.indexesChanged()
+	for _, entry := range g.index.catalog() {
+		entry.drop()
+		entry.create(g)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"testing"
+)
+
+func TestIndexCatalog(t *testing.T) {
+	g := NewGraph()
+	nodes := make([]*Node, 0)
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, g.NewNode([]string{"Person"}, map[string]interface{}{
+			"key":  i % 3,
+			"name": "a b",
+		}))
+	}
+	g.NewEdge(nodes[0], nodes[1], "knows", map[string]interface{}{"since": 2020})
+	g.AddNodePropertyIndex("key", HashIndex)
+	g.AddNodePropertyIndex("name", BtreeIndex)
+	g.AddNodeCompositeIndex([]string{"key", "name"}, BtreeIndex)
+	g.AddNodeLabelPropertyIndex("Person", "key", HashIndex)
+	g.AddNodePropertyIndex("name", FullTextIndex)
+	g.AddNodePropertyIndex("loc", SpatialIndex)
+	g.AddEdgePropertyIndex("since", BtreeIndex)
+
+	indexes := g.GetIndexes()
+	got := make([]string, 0, len(indexes))
+	for _, ix := range indexes {
+		got = append(got, ix.String())
+	}
+	expected := []string{
+		"node hash index on (key)",
+		"node btree composite index on (key,name)",
+		"node spatial index on (loc)",
+		"node btree index on (name)",
+		"node fulltext index on (name)",
+		"node hash index on Person(key)",
+		"edge btree index on (since)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Wrong indexes: %v", got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expecting %s, got %s", expected[i], got[i])
+		}
+	}
+	if s := indexes[0].Stats; s.Entries != 10 || s.DistinctValues != 3 || s.MemoryEstimate == 0 {
+		t.Errorf("Wrong stats: %+v", s)
+	}
+	if s := indexes[1].Stats; s.Entries != 10 || s.DistinctValues != 3 {
+		t.Errorf("Wrong composite stats: %+v", s)
+	}
+	if s := indexes[4].Stats; s.Entries != 10 || s.DistinctValues != 2 {
+		t.Errorf("Wrong full-text stats: %+v", s)
+	}
+
+	// Removing all nodes with a value removes the value
+	for i := 0; i < 10; i += 3 {
+		nodes[i].SetProperty("key", 1)
+	}
+	if s, _ := g.GetIndexStats(IndexInfo{Type: HashIndex, Keys: []string{"key"}}); s.Entries != 10 || s.DistinctValues != 2 {
+		t.Errorf("Wrong stats after update: %+v", s)
+	}
+	if s, _ := g.GetIndexStats(IndexInfo{Type: BtreeIndex, Keys: []string{"key", "name"}, Composite: true}); s.Entries != 10 || s.DistinctValues != 2 {
+		t.Errorf("Wrong composite stats after update: %+v", s)
+	}
+
+	if g.DropIndex(IndexInfo{Type: BtreeIndex, Keys: []string{"key"}}) {
+		t.Errorf("Dropped a missing index")
+	}
+	if !g.DropIndex(IndexInfo{Type: HashIndex, Keys: []string{"key"}}) {
+		t.Errorf("Cannot drop index")
+	}
+	if !g.DropIndex(IndexInfo{Type: BtreeIndex, Keys: []string{"key", "name"}, Composite: true}) {
+		t.Errorf("Cannot drop composite index")
+	}
+	if len(g.GetIndexes()) != len(expected)-2 {
+		t.Errorf("Wrong indexes after drop: %v", g.GetIndexes())
+	}
+	if g.index.GetIteratorForNodeProperty("key", 1) != nil || len(g.index.nodeComposites) != 0 {
+		t.Errorf("Index not dropped")
+	}
+	// Lookups still work using the remaining indexes
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 1}))); n != 7 {
+		t.Errorf("Expecting 7, got %d", n)
+	}
+	nodes[1].SetProperty("key", 2)
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": 1}))); n != 6 {
+		t.Errorf("Expecting 6, got %d", n)
+	}
+
+	// Rebuild keeps the type and options
+	g.index.nodeFullText["name"].options.StopWords = []string{"b"}
+	if !g.RebuildIndex(IndexInfo{Type: FullTextIndex, Keys: []string{"name"}}) {
+		t.Errorf("Cannot rebuild index")
+	}
+	if s, _ := g.GetIndexStats(IndexInfo{Type: FullTextIndex, Keys: []string{"name"}}); s.DistinctValues != 1 {
+		t.Errorf("Wrong full-text stats after rebuild: %+v", s)
+	}
+	g.RebuildIndexes()
+	if len(g.GetIndexes()) != len(expected)-2 {
+		t.Errorf("Wrong indexes after rebuild: %v", g.GetIndexes())
+	}
+	if s, _ := g.GetIndexStats(IndexInfo{Edge: true, Type: BtreeIndex, Keys: []string{"since"}}); s.Entries != 1 {
+		t.Errorf("Wrong edge stats after rebuild: %+v", s)
+	}
+}
+
+func TestIndexCatalogErrors(t *testing.T) {
+	g := NewGraph()
+	g.AddNodePropertyIndex("key", HashIndex)
+	expectPanic := func(name string, f func(), check func(interface{}) bool) {
+		defer func() {
+			if !check(recover()) {
+				t.Errorf("%s: Expecting panic", name)
+			}
+		}()
+		f()
+	}
+	unsupported := func(x interface{}) bool { _, ok := x.(ErrUnsupportedIndexType); return ok }
+	expectPanic("edge vector", func() { g.AddEdgePropertyIndex("v", VectorIndex) }, unsupported)
+	expectPanic("edge spatial", func() { g.AddEdgePropertyIndex("loc", SpatialIndex) }, unsupported)
+
+	snap := g.Snapshot()
+	readOnly := func(x interface{}) bool { _, ok := x.(ErrReadOnlyGraph); return ok }
+	info := IndexInfo{Type: HashIndex, Keys: []string{"key"}}
+	expectPanic("drop", func() { snap.DropIndex(info) }, readOnly)
+	expectPanic("rebuild", func() { snap.RebuildIndex(info) }, readOnly)
+	expectPanic("rebuild all", func() { snap.RebuildIndexes() }, readOnly)
+	expectPanic("add", func() { snap.AddNodePropertyIndex("name", BtreeIndex) }, readOnly)
+	if len(snap.GetIndexes()) != 1 || len(g.GetIndexes()) != 1 {
+		t.Errorf("Wrong indexes: %v %v", snap.GetIndexes(), g.GetIndexes())
+	}
+}
+
+func TestIndexStatsPlan(t *testing.T) {
+	g := NewGraph()
+	g.AddNodePropertyIndex("status", HashIndex)
+	// 20 A nodes and 15 B nodes. Most nodes are active
+	as := make([]*Node, 0)
+	for i := 0; i < 20; i++ {
+		as = append(as, g.NewNode([]string{"A"}, nil))
+	}
+	bs := make([]*Node, 0)
+	for i := 0; i < 15; i++ {
+		bs = append(bs, g.NewNode([]string{"B"}, nil))
+	}
+	for i := 0; i < 1000; i++ {
+		node := g.NewNode(nil, nil)
+		if i < 35 {
+			node.SetProperty("status", "inactive")
+		} else {
+			node.SetProperty("status", "active")
+		}
+	}
+	for i := range as {
+		as[i].SetProperty("status", "inactive")
+		g.NewEdge(as[i], bs[i%len(bs)], "e", nil)
+	}
+	for i := range bs {
+		bs[i].SetProperty("status", "inactive")
+	}
+
+	pat := Pattern{
+		{Labels: NewStringSet("A"), Properties: map[string]interface{}{"status": "inactive"}},
+		{Min: 1, Max: 1},
+		{Labels: NewStringSet("B")},
+	}
+	// The label iterator of A is larger than B, but status is selective
+	if _, i := pat.getFastestElement(g, map[string]*PatternSymbol{}); i != 0 {
+		t.Errorf("Expecting 0, got %d", i)
+	}
+	pat[0].Properties = nil
+	if _, i := pat.getFastestElement(g, map[string]*PatternSymbol{}); i != 2 {
+		t.Errorf("Expecting 2, got %d", i)
+	}
+}
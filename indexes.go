@@ -14,11 +14,16 @@
 
 package lpg
 
+import (
+	"fmt"
+)
+
 type index interface {
 	add(value interface{}, id int, item interface{})
 	remove(value interface{}, id int)
 	find(value interface{}) Iterator
 	valueItr() Iterator
+	stats() IndexStats
 }
 
 type IndexType int
@@ -26,13 +31,69 @@ type IndexType int
 const (
 	BtreeIndex IndexType = 0
 	HashIndex  IndexType = 1
+	// FullTextIndex can be used with AddNodePropertyIndex and
+	// AddEdgePropertyIndex to add a full-text index with the default
+	// options. Use AddNodeFullTextIndex and AddEdgeFullTextIndex to
+	// configure the index.
+	FullTextIndex IndexType = 2
+	// VectorIndex and SpatialIndex can be used with
+	// AddNodePropertyIndex to add a vector or a spatial index with the
+	// default options. They are not supported for edges, and
+	// AddEdgePropertyIndex panics with ErrUnsupportedIndexType.
+	VectorIndex  IndexType = 3
+	SpatialIndex IndexType = 4
 )
 
+// ErrUnsupportedIndexType is the panic value when an index is added
+// with an index type that is not supported by the index
+type ErrUnsupportedIndexType struct {
+	Type IndexType
+	Msg  string
+}
+
+func (e ErrUnsupportedIndexType) Error() string {
+	return fmt.Sprintf("Unsupported index type %s: %s", e.Type, e.Msg)
+}
+
+func (t IndexType) String() string {
+	switch t {
+	case BtreeIndex:
+		return "btree"
+	case HashIndex:
+		return "hash"
+	case FullTextIndex:
+		return "fulltext"
+	case VectorIndex:
+		return "vector"
+	case SpatialIndex:
+		return "spatial"
+	}
+	return fmt.Sprintf("IndexType(%d)", int(t))
+}
+
 type graphIndex struct {
 	nodesByLabel NodeMap
 
 	nodeProperties map[string]index
 	edgeProperties map[string]index
+
+	nodeComposites []*compositeIndex
+	edgeComposites []*compositeIndex
+
+	nodeLabelProperties map[labelProperty]index
+	edgeLabelProperties map[labelProperty]index
+
+	nodeFullText map[string]*fullTextIndex
+	edgeFullText map[string]*fullTextIndex
+
+	nodeVectors map[string]*vectorIndex
+	nodeSpatial map[string]*spatialIndex
+
+	nodesByID map[int]*Node
+	edgesByID map[int]*Edge
+
+	nodesByExternalID map[string]*Node
+	edgesByExternalID map[string]*Edge
 }
 
 func newGraphIndex() graphIndex {
@@ -40,6 +101,21 @@ func newGraphIndex() graphIndex {
 		nodesByLabel:   *NewNodeMap(),
 		nodeProperties: make(map[string]index),
 		edgeProperties: make(map[string]index),
+
+		nodeLabelProperties: make(map[labelProperty]index),
+		edgeLabelProperties: make(map[labelProperty]index),
+
+		nodeFullText: make(map[string]*fullTextIndex),
+		edgeFullText: make(map[string]*fullTextIndex),
+
+		nodeVectors: make(map[string]*vectorIndex),
+		nodeSpatial: make(map[string]*spatialIndex),
+
+		nodesByID: make(map[int]*Node),
+		edgesByID: make(map[int]*Edge),
+
+		nodesByExternalID: make(map[string]*Node),
+		edgesByExternalID: make(map[string]*Edge),
 	}
 }
 
@@ -49,17 +125,12 @@ func (g *graphIndex) NodePropertyIndex(propertyName string, graph *Graph, it Ind
 	if exists {
 		return
 	}
-	var ix index
-	if it == BtreeIndex {
-		ix = &setTree{}
-	} else {
-		ix = &hashIndex{}
-	}
+	ix := newIndex(it)
 	g.nodeProperties[propertyName] = ix
 	// Reindex
 	for nodes := graph.GetNodes(); nodes.Next(); {
 		node := nodes.Node()
-		value, ok := node.properties[propertyName]
+		value, ok := node.properties.getProperty(propertyName)
 		if ok {
 			ix.add(value, node.id, node)
 		}
@@ -108,26 +179,72 @@ func (g *graphIndex) EdgesWithProperty(key string) EdgeIterator {
 
 func (g *graphIndex) addNodeToIndex(node *Node, graph *Graph) {
 	g.nodesByLabel.Add(node)
+	g.nodesByID[node.id] = node
+	if len(node.externalID) > 0 {
+		g.nodesByExternalID[node.externalID] = node
+	}
 
-	for k, v := range node.properties {
+	for k, v := range node.properties.load() {
 		index, found := g.nodeProperties[k]
 		if !found {
 			continue
 		}
 		index.add(v, node.id, node)
 	}
+	for _, c := range g.nodeComposites {
+		c.add(&node.properties, node.id, node)
+	}
+	g.addNodeToLabelIndexes(node, "")
+	for key, ix := range g.nodeFullText {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+	for key, ix := range g.nodeVectors {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+	for key, ix := range g.nodeSpatial {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.add(value, node.id, node)
+		}
+	}
 }
 
 func (g *graphIndex) removeNodeFromIndex(node *Node, graph *Graph) {
 	g.nodesByLabel.Remove(node)
+	delete(g.nodesByID, node.id)
+	if len(node.externalID) > 0 {
+		delete(g.nodesByExternalID, node.externalID)
+	}
 
-	for k, v := range node.properties {
+	for k, v := range node.properties.load() {
 		index, found := g.nodeProperties[k]
 		if !found {
 			continue
 		}
 		index.remove(v, node.id)
 	}
+	for _, c := range g.nodeComposites {
+		c.remove(&node.properties, node.id)
+	}
+	g.removeNodeFromLabelIndexes(node, "")
+	for key, ix := range g.nodeFullText {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.remove(value, node.id)
+		}
+	}
+	for key, ix := range g.nodeVectors {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.remove(value, node.id)
+		}
+	}
+	for key, ix := range g.nodeSpatial {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.remove(value, node.id)
+		}
+	}
 }
 
 // EdgePropertyIndex sets up an index for the given edge property
@@ -136,17 +253,12 @@ func (g *graphIndex) EdgePropertyIndex(propertyName string, graph *Graph, it Ind
 	if exists {
 		return
 	}
-	var ix index
-	if it == BtreeIndex {
-		ix = &setTree{}
-	} else {
-		ix = &hashIndex{}
-	}
+	ix := newIndex(it)
 	g.edgeProperties[propertyName] = ix
 	// Reindex
 	for edges := graph.GetEdges(); edges.Next(); {
 		edge := edges.Edge()
-		value, ok := edge.properties[propertyName]
+		value, ok := edge.properties.getProperty(propertyName)
 		if ok {
 			ix.add(value, edge.id, edge)
 		}
@@ -154,23 +266,49 @@ func (g *graphIndex) EdgePropertyIndex(propertyName string, graph *Graph, it Ind
 }
 
 func (g *graphIndex) addEdgeToIndex(edge *Edge, graph *Graph) {
-	for k, v := range edge.properties {
+	g.edgesByID[edge.id] = edge
+	if len(edge.externalID) > 0 {
+		g.edgesByExternalID[edge.externalID] = edge
+	}
+	for k, v := range edge.properties.load() {
 		index, found := g.edgeProperties[k]
 		if !found {
 			continue
 		}
 		index.add(v, edge.id, edge)
 	}
+	for _, c := range g.edgeComposites {
+		c.add(&edge.properties, edge.id, edge)
+	}
+	g.addEdgeToLabelIndexes(edge, "")
+	for key, ix := range g.edgeFullText {
+		if value, ok := edge.properties.getProperty(key); ok {
+			ix.add(value, edge.id, edge)
+		}
+	}
 }
 
 func (g *graphIndex) removeEdgeFromIndex(edge *Edge, graph *Graph) {
-	for k, v := range edge.properties {
+	delete(g.edgesByID, edge.id)
+	if len(edge.externalID) > 0 {
+		delete(g.edgesByExternalID, edge.externalID)
+	}
+	for k, v := range edge.properties.load() {
 		index, found := g.edgeProperties[k]
 		if !found {
 			continue
 		}
 		index.remove(v, edge.id)
 	}
+	for _, c := range g.edgeComposites {
+		c.remove(&edge.properties, edge.id)
+	}
+	g.removeEdgeFromLabelIndexes(edge, "")
+	for key, ix := range g.edgeFullText {
+		if value, ok := edge.properties.getProperty(key); ok {
+			ix.remove(value, edge.id)
+		}
+	}
 }
 
 // GetIteratorForEdgeProperty returns an iterator for the given
@@ -184,3 +322,66 @@ func (g *graphIndex) GetIteratorForEdgeProperty(key string, value interface{}) E
 	itr := index.find(value)
 	return edgeIterator{itr}
 }
+
+// unindexNodeProperty removes the node from the secondary indexes
+// that depend on the property key. This is called before the property
+// changes, and indexNodeProperty is called after.
+func (g *graphIndex) unindexNodeProperty(node *Node, key string) {
+	g.removeNodeComposites(node, key)
+	g.removeNodeFromLabelIndexes(node, key)
+	if ix, ok := g.nodeFullText[key]; ok {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.remove(value, node.id)
+		}
+	}
+	if ix, ok := g.nodeVectors[key]; ok {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.remove(value, node.id)
+		}
+	}
+	if ix, ok := g.nodeSpatial[key]; ok {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.remove(value, node.id)
+		}
+	}
+}
+
+func (g *graphIndex) indexNodeProperty(node *Node, key string) {
+	g.addNodeComposites(node, key)
+	g.addNodeToLabelIndexes(node, key)
+	if ix, ok := g.nodeFullText[key]; ok {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+	if ix, ok := g.nodeVectors[key]; ok {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+	if ix, ok := g.nodeSpatial[key]; ok {
+		if value, ok := node.properties.getProperty(key); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+}
+
+func (g *graphIndex) unindexEdgeProperty(edge *Edge, key string) {
+	g.removeEdgeComposites(edge, key)
+	g.removeEdgeFromLabelIndexes(edge, key)
+	if ix, ok := g.edgeFullText[key]; ok {
+		if value, ok := edge.properties.getProperty(key); ok {
+			ix.remove(value, edge.id)
+		}
+	}
+}
+
+func (g *graphIndex) indexEdgeProperty(edge *Edge, key string) {
+	g.addEdgeComposites(edge, key)
+	g.addEdgeToLabelIndexes(edge, key)
+	if ix, ok := g.edgeFullText[key]; ok {
+		if value, ok := edge.properties.getProperty(key); ok {
+			ix.add(value, edge.id, edge)
+		}
+	}
+}
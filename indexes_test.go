@@ -16,6 +16,7 @@ package lpg
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -69,3 +70,255 @@ func TestHashNodeIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestCompositeIndex(t *testing.T) {
+	for _, ix := range []IndexType{HashIndex, BtreeIndex} {
+		g := NewGraph()
+		for tenant := 0; tenant < 5; tenant++ {
+			for ts := 0; ts < 10; ts++ {
+				g.NewNode([]string{"a"}, map[string]interface{}{"tenant": fmt.Sprint(tenant), "ts": ts})
+			}
+		}
+		g.AddNodeCompositeIndex([]string{"tenant", "ts"}, ix)
+		n := g.NewNode([]string{"a"}, map[string]interface{}{"tenant": "x"})
+		n.SetProperty("ts", 1)
+
+		itr := g.index.GetIteratorForNodeComposite(map[string]interface{}{"tenant": "1", "ts": 2.0, "other": 1})
+		if itr == nil || itr.MaxSize() != 1 {
+			t.Errorf("%v: Composite index not used", ix)
+		}
+		if nodes := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"tenant": "x", "ts": 1})); len(nodes) != 1 || nodes[0] != n {
+			t.Errorf("%v: Wrong result: %v", ix, nodes)
+		}
+		n.RemoveProperty("ts")
+		if nodes := NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"tenant": "x", "ts": 1})); len(nodes) != 0 {
+			t.Errorf("%v: Index not updated: %v", ix, nodes)
+		}
+
+		pat := Pattern{{Name: "n", Properties: map[string]interface{}{"tenant": "2", "ts": 3}}}
+		if _, sz := pat[0].estimateNodeSize(g, nil); sz != 1 {
+			t.Errorf("%v: Planner did not use composite index: %d", ix, sz)
+		}
+		acc := &DefaultMatchAccumulator{}
+		if err := pat.Run(g, nil, acc); err != nil {
+			t.Error(err)
+		}
+		if len(acc.Symbols) != 1 {
+			t.Errorf("%v: Wrong pattern result: %v", ix, acc.Symbols)
+		}
+
+		_, err := g.ScanNodeCompositeIndex([]string{"tenant", "ts"}, CompositeRange{Prefix: []interface{}{"1"}, Min: 3, Max: 6, ExcludeMax: true})
+		if ix == HashIndex {
+			if err == nil {
+				t.Errorf("Expecting error for hash range scan")
+			}
+			continue
+		}
+		for _, tc := range []struct {
+			r        CompositeRange
+			expected int
+		}{
+			{CompositeRange{Prefix: []interface{}{"1"}, Min: 3, Max: 6, ExcludeMax: true}, 3},
+			{CompositeRange{Prefix: []interface{}{"1"}, Min: 3, Max: 6}, 4},
+			{CompositeRange{Prefix: []interface{}{"1"}, Min: 3, ExcludeMin: true}, 6},
+			{CompositeRange{Prefix: []interface{}{"1"}, Max: 4.5}, 5},
+			{CompositeRange{Prefix: []interface{}{"4"}}, 10},
+			{CompositeRange{Min: "1", Max: "2"}, 20},
+			{CompositeRange{}, 50},
+		} {
+			itr, err := g.ScanNodeCompositeIndex([]string{"tenant", "ts"}, tc.r)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			nodes := NodeSlice(itr)
+			if len(nodes) != tc.expected {
+				t.Errorf("%+v: expected %d got %d", tc.r, tc.expected, len(nodes))
+			}
+			for _, node := range nodes {
+				v, _ := node.GetProperty("ts")
+				if len(tc.r.Prefix) > 0 && tc.r.Min != nil && ComparePropertyValue(v, tc.r.Min) < 0 {
+					t.Errorf("%+v: out of range: %v", tc.r, v)
+				}
+			}
+		}
+	}
+}
+
+func TestHashIndexSliceValues(t *testing.T) {
+	g := NewGraph()
+	g.AddNodePropertyIndex("key", HashIndex)
+	g.NewNode(nil, map[string]interface{}{"key": []string{"a", "b"}})
+	g.NewNode(nil, map[string]interface{}{"key": map[string]interface{}{"a": 1}})
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": []string{"a", "b"}}))); n != 1 {
+		t.Errorf("Expecting 1, got %d", n)
+	}
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": map[string]interface{}{"a": 1}}))); n != 1 {
+		t.Errorf("Expecting 1, got %d", n)
+	}
+}
+
+func TestHashIndexSpecialNumbers(t *testing.T) {
+	big := uint64(1 << 63)
+	if ComparePropertyValue(big, float64(1<<63)) != 0 || ComparePropertyValue(math.NaN(), math.NaN()) != 0 {
+		t.Fatalf("Expecting equal values")
+	}
+	for _, ix := range []IndexType{HashIndex, BtreeIndex} {
+		g := NewGraph()
+		g.AddNodePropertyIndex("key", ix)
+		nan := g.NewNode(nil, map[string]interface{}{"key": math.NaN()})
+		g.NewNode(nil, map[string]interface{}{"key": big})
+		g.NewNode(nil, map[string]interface{}{"key": uint64(math.MaxUint64)})
+		if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": math.NaN()}))); n != 1 {
+			t.Errorf("%v: Expecting 1 NaN, got %d", ix, n)
+		}
+		if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": float64(1 << 63)}))); n != 1 {
+			t.Errorf("%v: Expecting 1 for 2^63, got %d", ix, n)
+		}
+		if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": uint64(math.MaxUint64)}))); n != 1 {
+			t.Errorf("%v: Expecting 1 for MaxUint64, got %d", ix, n)
+		}
+		// NaN entries can be removed
+		nan.SetProperty("key", 1)
+		if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": math.NaN()}))); n != 0 {
+			t.Errorf("%v: NaN not removed: %d", ix, n)
+		}
+		if s, _ := g.GetIndexStats(IndexInfo{Type: ix, Keys: []string{"key"}}); s.Entries != 3 || s.DistinctValues != 3 {
+			t.Errorf("%v: Wrong stats: %+v", ix, s)
+		}
+	}
+}
+
+func TestLabelPropertyIndex(t *testing.T) {
+	for _, ix := range []IndexType{HashIndex, BtreeIndex} {
+		g := NewGraph()
+		for i := 0; i < 10; i++ {
+			g.NewNode([]string{"Person"}, map[string]interface{}{"name": fmt.Sprint(i)})
+			g.NewNode([]string{"Company"}, map[string]interface{}{"name": fmt.Sprint(i)})
+		}
+		g.AddNodePropertyIndex("name", ix)
+		g.AddNodeLabelPropertyIndex("Person", "name", ix)
+
+		size := func(labels StringSet, name string) int {
+			itr := g.index.GetIteratorForNodeLabelProperty(labels, "name", name)
+			if itr == nil {
+				return -1
+			}
+			return len(NodeSlice(itr))
+		}
+		if n := size(NewStringSet("Person"), "1"); n != 1 {
+			t.Errorf("%v: Expecting 1, got %d", ix, n)
+		}
+		if n := size(NewStringSet("Company"), "1"); n != -1 {
+			t.Errorf("%v: Expecting no index for Company, got %d", ix, n)
+		}
+
+		// Relabeling updates the index
+		c := NodeSlice(g.FindNodes(NewStringSet("Company"), map[string]interface{}{"name": "2"}))[0]
+		c.SetLabels(NewStringSet("Company", "Person"))
+		if n := size(NewStringSet("Person"), "2"); n != 2 {
+			t.Errorf("%v: Index not updated on SetLabels: %d", ix, n)
+		}
+		if nodes := NodeSlice(g.FindNodes(NewStringSet("Person", "Company"), map[string]interface{}{"name": "2"})); len(nodes) != 1 || nodes[0] != c {
+			t.Errorf("%v: Wrong result: %v", ix, nodes)
+		}
+		c.SetLabels(NewStringSet("Company"))
+		if n := size(NewStringSet("Person"), "2"); n != 1 {
+			t.Errorf("%v: Index not updated on SetLabels: %d", ix, n)
+		}
+
+		// Property changes, and rollback
+		p := NodeSlice(g.FindNodes(NewStringSet("Person"), map[string]interface{}{"name": "3"}))[0]
+		tx := g.Begin()
+		p.SetProperty("name", "x")
+		if n := size(NewStringSet("Person"), "x"); n != 1 {
+			t.Errorf("%v: Index not updated on SetProperty: %d", ix, n)
+		}
+		tx.Rollback()
+		if n := size(NewStringSet("Person"), "x"); n != 0 {
+			t.Errorf("%v: Index not rolled back: %d", ix, n)
+		}
+		p.RemoveProperty("name")
+		if n := size(NewStringSet("Person"), "3"); n != 0 {
+			t.Errorf("%v: Index not updated on RemoveProperty: %d", ix, n)
+		}
+		p.DetachAndRemove()
+
+		// The planner prefers the label-scoped index
+		pat := Pattern{{Name: "n", Labels: NewStringSet("Person"), Properties: map[string]interface{}{"name": "4"}}}
+		itr, sz := pat[0].estimateNodeSize(g, nil)
+		if sz != 1 {
+			t.Errorf("%v: Planner did not use label index: %d", ix, sz)
+		}
+		if nodes := NodeSlice(itr.(NodeIterator)); len(nodes) != 1 || !nodes[0].HasLabel("Person") {
+			t.Errorf("%v: Wrong planner iterator: %v", ix, nodes)
+		}
+
+		// Snapshots keep the index
+		snap := g.Snapshot()
+		if _, ok := snap.index.nodeLabelProperties[labelProperty{label: "Person", property: "name"}]; !ok {
+			t.Errorf("%v: Snapshot lost label index", ix)
+		}
+	}
+}
+
+func TestEdgeLabelPropertyIndex(t *testing.T) {
+	g := NewGraph()
+	a := g.NewNode(nil, nil)
+	b := g.NewNode(nil, nil)
+	for i := 0; i < 5; i++ {
+		g.NewEdge(a, b, "knows", map[string]interface{}{"since": i})
+		g.NewEdge(a, b, "likes", map[string]interface{}{"since": i})
+	}
+	g.AddEdgeLabelPropertyIndex("knows", "since", HashIndex)
+	if itr := g.index.GetIteratorForEdgeLabelProperty(NewStringSet("knows", "likes"), "since", 1); itr != nil {
+		t.Errorf("Expecting nil iterator for labels without index")
+	}
+	itr := g.index.GetIteratorForEdgeLabelProperty(NewStringSet("knows"), "since", 1)
+	if itr == nil || itr.MaxSize() != 1 {
+		t.Errorf("Label index not used")
+	}
+	e := EdgeSlice(g.FindEdges(NewStringSet("likes"), map[string]interface{}{"since": 1}))[0]
+	e.SetLabel("knows")
+	if edges := EdgeSlice(g.FindEdges(NewStringSet("knows"), map[string]interface{}{"since": 1})); len(edges) != 2 {
+		t.Errorf("Index not updated on SetLabel: %v", edges)
+	}
+	e.SetProperty("since", 10)
+	if edges := EdgeSlice(g.FindEdges(NewStringSet("knows"), map[string]interface{}{"since": 10})); len(edges) != 1 || edges[0] != e {
+		t.Errorf("Index not updated on SetProperty: %v", edges)
+	}
+	e.Remove()
+	if edges := EdgeSlice(g.FindEdges(NewStringSet("knows"), map[string]interface{}{"since": 10})); len(edges) != 0 {
+		t.Errorf("Index not updated on Remove: %v", edges)
+	}
+}
+
+func TestUnsupportedIndexType(t *testing.T) {
+	g := NewGraph()
+	g.NewNode([]string{"a"}, map[string]interface{}{"x": "1"})
+	expectPanic := func(name string, f func()) {
+		defer func() {
+			if _, ok := recover().(ErrUnsupportedIndexType); !ok {
+				t.Errorf("%s: Expecting unsupported index type panic", name)
+			}
+		}()
+		f()
+	}
+	expectPanic("label", func() { g.AddNodeLabelPropertyIndex("a", "x", FullTextIndex) })
+	expectPanic("edge label", func() { g.AddEdgeLabelPropertyIndex("a", "x", VectorIndex) })
+	expectPanic("composite", func() { g.AddNodeCompositeIndex([]string{"x", "y"}, SpatialIndex) })
+	expectPanic("property", func() { g.AddNodePropertyIndex("x", IndexType(10)) })
+	if ixs := g.GetIndexes(); len(ixs) != 0 {
+		t.Errorf("Unexpected indexes: %v", ixs)
+	}
+	// A rejected index does not change the graph
+	if g.indexVersion != 0 {
+		t.Errorf("Index version changed: %d", g.indexVersion)
+	}
+	tx := g.Begin()
+	expectPanic("composite in tx", func() { g.AddEdgeCompositeIndex([]string{"x"}, FullTextIndex) })
+	if len(g.journal) != 0 {
+		t.Errorf("Rejected index is journaled")
+	}
+	tx.Rollback()
+}
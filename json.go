@@ -133,11 +133,38 @@ type JSON struct {
 	// returned key is empty, the property is not marshaled. If this is
 	// nil, the default json marshaler is used for property value.
 	PropertyMarshaler func(key string, value interface{}) (string, json.RawMessage, error)
+
+	// If PreserveTypes is true, property values are marshaled with a
+	// type tag, as {"t": "int", "v": 1}, so they can be unmarshaled
+	// with the same Go type. See EncodeTypedJSONValue for the types
+	// that keep their Go types. This is ignored for properties handled
+	// by PropertyMarshaler/PropertyUnmarshaler.
+	PreserveTypes bool
+
+	// PropertyTypes declares the expected types of properties by
+	// key. During unmarshaling, property values are converted to the
+	// declared type if possible without loss, otherwise unmarshaling
+	// fails with ErrPropertyType.
+	PropertyTypes map[string]PropertyType
+
+	// If TypedValues is true, property values are unmarshaled as
+	// PropertyValue values. The type of a value is the declared type
+	// in PropertyTypes, or the type of the unmarshaled value. Use
+	// with PreserveTypes to unmarshal values with the types they were
+	// marshaled with.
+	TypedValues bool
+
+	// If UseNodeIDs is true, node IDs are used as node indexes during
+	// marshaling, and nodes are created with those IDs during
+	// unmarshaling, so a graph can be reloaded with the same node
+	// IDs. Edges are created after all the nodes.
+	UseNodeIDs bool
 }
 
 // jsonNode contains the graph representation of a JSON node
 type jsonNode struct {
 	N          int                        `json:"n"`
+	ID         string                     `json:"id,omitempty"`
 	Labels     []string                   `json:"labels,omitempty"`
 	Properties map[string]json.RawMessage `json:"properties,omitempty"`
 	Edges      []jsonOutgoingEdge         `json:"edges,omitempty"`
@@ -146,14 +173,25 @@ type jsonNode struct {
 // jsonEdge contains the graph representation of a JSON edge, using
 // node indexes to address nodes
 type jsonEdge struct {
+	ID         string                     `json:"id,omitempty"`
 	From       int                        `json:"from"`
 	To         int                        `json:"to"`
 	Label      string                     `json:"label,omitempty"`
 	Properties map[string]json.RawMessage `json:"properties,omitempty"`
+
+	// Index of the edge in the edges array, or -1
+	ix int
+}
+
+// jsonPath contains a path as node and edge indexes
+type jsonPath struct {
+	Nodes []int `json:"nodes"`
+	Edges []int `json:"edges,omitempty"`
 }
 
 // jsonOutgoingEdge contains an edge included in a node
 type jsonOutgoingEdge struct {
+	ID         string                     `json:"id,omitempty"`
 	To         int                        `json:"to"`
 	Label      string                     `json:"label,omitempty"`
 	Properties map[string]json.RawMessage `json:"properties,omitempty"`
@@ -163,23 +201,118 @@ var (
 	objBegin      = []byte{'{'}
 	objEnd        = []byte{'}'}
 	nKey          = []byte(`"n":`)
+	idKey         = []byte(`"id":`)
 	comma         = []byte{','}
 	labelsKey     = []byte(`"labels":`)
 	propertiesKey = []byte(`"properties":`)
 	edgesKey      = []byte(`"edges":`)
 	nodesKey      = []byte(`"nodes":`)
+	pathsKey      = []byte(`"paths":`)
 	arrBegin      = []byte{'['}
 	arrEnd        = []byte{']'}
 )
 
 // Encode the graph in JSON
 func (j JSON) Encode(g *Graph, out io.Writer) error {
+	nodes := make([]*Node, 0, g.NumNodes())
+	for itr := g.GetNodes(); itr.Next(); {
+		nodes = append(nodes, itr.Node())
+	}
+	edges := make([]*Edge, 0, g.NumEdges())
+	for itr := g.GetEdges(); itr.Next(); {
+		edges = append(edges, itr.Edge())
+	}
+	return j.encode(nodes, edges, nil, out)
+}
+
+// EncodeSubgraph encodes the given nodes and edges in the same
+// format as Encode. The endpoints of the edges are included even if
+// they are not in nodes.
+func (j JSON) EncodeSubgraph(nodes []*Node, edges []*Edge, out io.Writer) error {
+	return j.encode(nodes, edges, nil, out)
+}
+
+// EncodeNodes encodes the nodes in the node set, and the edges
+// between them. Use with Neighborhood to encode the k-hop
+// neighborhood of nodes.
+func (j JSON) EncodeNodes(nodes *NodeSet, out io.Writer) error {
+	return j.encode(nodes.Slice(), InducedEdges(nodes), nil, out)
+}
+
+// EncodePaths encodes the nodes and edges of the paths, and the
+// paths themselves under the "paths" key. Each path is written as
+// the list of its node indexes and the list of its edge indexes:
+//
+//	{
+//	  "nodes": [...],
+//	  "edges": [...],
+//	  "paths": [
+//	     {"nodes": [0, 1, 2], "edges": [0, 1]},
+//	     {"nodes": [3]}
+//	  ]
+//	}
+//
+// Edge indexes refer to the elements of the "edges" array, so the
+// edges are always marshaled separately.
+func (j JSON) EncodePaths(paths []*Path, out io.Writer) error {
+	nodes := make([]*Node, 0)
+	edges := make([]*Edge, 0)
+	seenNodes := make(map[*Node]struct{})
+	seenEdges := make(map[*Edge]struct{})
+	for _, path := range paths {
+		for i := 0; i < path.NumNodes(); i++ {
+			node := path.GetNode(i)
+			if _, ok := seenNodes[node]; !ok {
+				seenNodes[node] = struct{}{}
+				nodes = append(nodes, node)
+			}
+		}
+		for i := 0; i < path.NumEdges(); i++ {
+			edge := path.GetEdge(i)
+			if _, ok := seenEdges[edge]; !ok {
+				seenEdges[edge] = struct{}{}
+				edges = append(edges, edge)
+			}
+		}
+	}
+	if paths == nil {
+		paths = []*Path{}
+	}
+	return j.encode(nodes, edges, paths, out)
+}
+
+func (j JSON) writeValue(key []byte, value interface{}, out io.Writer) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(key); err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encode the selected nodes and edges. If paths is non-nil, edges
+// are written separately and the paths are written under the "paths"
+// key.
+func (j JSON) encode(nodes []*Node, edges []*Edge, paths []*Path, out io.Writer) error {
 	nodeMap := make(map[*Node]int)
+	edgeMap := make(map[*Edge]int)
+	separateEdges := j.MarshalEdgesSeparately || paths != nil
 
 	marshalProperties := func(in map[string]interface{}) (map[string]json.RawMessage, error) {
 		ret := make(map[string]json.RawMessage)
 		for k, v := range in {
 			if j.PropertyMarshaler == nil {
+				if j.PreserveTypes {
+					d, err := EncodeTypedJSONValue(v)
+					if err != nil {
+						return nil, err
+					}
+					ret[k] = d
+					continue
+				}
 				d, _ := json.Marshal(v)
 				ret[k] = d
 			} else {
@@ -198,7 +331,7 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 	encodeEdge := func(edge *Edge, writeFrom bool) error {
 		var e interface{}
 		edgeProps := make(map[string]any)
-		for ix, v := range edge.properties {
+		for ix, v := range edge.properties.load() {
 			edgeProps[ix] = v
 		}
 		properties, err := marshalProperties(edgeProps)
@@ -207,6 +340,7 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 		}
 		if writeFrom {
 			e = jsonEdge{
+				ID:         edge.externalID,
 				From:       nodeMap[edge.GetFrom()],
 				To:         nodeMap[edge.GetTo()],
 				Label:      edge.label,
@@ -214,6 +348,7 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 			}
 		} else {
 			e = jsonOutgoingEdge{
+				ID:         edge.externalID,
 				To:         nodeMap[edge.GetTo()],
 				Label:      edge.label,
 				Properties: properties,
@@ -229,18 +364,39 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 		return nil
 	}
 
-	i := 0
 	// Give each node an index
-	for nodes := g.GetNodes(); nodes.Next(); {
-		node := nodes.Node()
-		nodeMap[node] = i
-		i++
+	addNode := func(node *Node) {
+		if _, ok := nodeMap[node]; !ok {
+			if j.UseNodeIDs {
+				nodeMap[node] = node.id
+			} else {
+				nodeMap[node] = len(nodes)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	selected := nodes
+	nodes = make([]*Node, 0, len(selected))
+	for _, node := range selected {
+		addNode(node)
+	}
+	// Give each edge an index, dropping duplicates
+	selectedEdges := edges
+	edges = make([]*Edge, 0, len(selectedEdges))
+	for _, edge := range selectedEdges {
+		if _, ok := edgeMap[edge]; ok {
+			continue
+		}
+		edgeMap[edge] = len(edges)
+		edges = append(edges, edge)
+		addNode(edge.GetFrom())
+		addNode(edge.GetTo())
 	}
 
 	if _, err := out.Write(objBegin); err != nil {
 		return err
 	}
-	if len(nodeMap) > 0 {
+	if len(nodes) > 0 {
 		if _, err := out.Write(nodesKey); err != nil {
 			return err
 		}
@@ -249,11 +405,8 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 		}
 
 		// Write nodes
-		firstNode := true
-		for node, ix := range nodeMap {
-			if firstNode {
-				firstNode = false
-			} else {
+		for ix, node := range nodes {
+			if ix > 0 {
 				if _, err := out.Write(comma); err != nil {
 					return err
 				}
@@ -264,10 +417,18 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 			if _, err := out.Write(nKey); err != nil {
 				return err
 			}
-			s := strconv.Itoa(ix)
+			s := strconv.Itoa(nodeMap[node])
 			if _, err := out.Write([]byte(s)); err != nil {
 				return err
 			}
+			if len(node.externalID) > 0 {
+				if _, err := out.Write(comma); err != nil {
+					return err
+				}
+				if err := j.writeValue(idKey, node.externalID, out); err != nil {
+					return err
+				}
+			}
 			if node.labels.Len() > 0 {
 				data, _ := json.Marshal(node.labels)
 				if _, err := out.Write(comma); err != nil {
@@ -280,7 +441,7 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 					return err
 				}
 			}
-			if len(node.properties) > 0 {
+			if node.properties.numProperties() > 0 {
 				if _, err := out.Write(comma); err != nil {
 					return err
 				}
@@ -288,7 +449,7 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 					return err
 				}
 				nodeProps := make(map[string]any)
-				for ix, v := range node.properties {
+				for ix, v := range node.properties.load() {
 					nodeProps[ix] = v
 				}
 				m, err := marshalProperties(nodeProps)
@@ -304,7 +465,7 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 				}
 			}
 
-			if j.MarshalEdgesSeparately {
+			if separateEdges {
 				if _, err := out.Write(objEnd); err != nil {
 					return err
 				}
@@ -314,6 +475,9 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 			first := true
 			for edges := node.GetEdges(OutgoingEdge); edges.Next(); {
 				edge := edges.Edge()
+				if _, ok := edgeMap[edge]; !ok {
+					continue
+				}
 
 				if first {
 					if _, err := out.Write(comma); err != nil {
@@ -349,9 +513,11 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 		}
 	}
 
-	if j.MarshalEdgesSeparately {
-		if _, err := out.Write(comma); err != nil {
-			return err
+	if separateEdges && len(edges) > 0 {
+		if len(nodes) > 0 {
+			if _, err := out.Write(comma); err != nil {
+				return err
+			}
 		}
 		if _, err := out.Write(edgesKey); err != nil {
 			return err
@@ -359,12 +525,8 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 		if _, err := out.Write(arrBegin); err != nil {
 			return err
 		}
-		first := true
-		for edges := g.GetEdges(); edges.Next(); {
-			edge := edges.Edge()
-			if first {
-				first = false
-			} else {
+		for ix, edge := range edges {
+			if ix > 0 {
 				if _, err := out.Write(comma); err != nil {
 					return err
 				}
@@ -378,6 +540,28 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 		}
 	}
 
+	if paths != nil {
+		jpaths := make([]jsonPath, 0, len(paths))
+		for _, path := range paths {
+			jp := jsonPath{Nodes: make([]int, 0, path.NumNodes())}
+			for i := 0; i < path.NumNodes(); i++ {
+				jp.Nodes = append(jp.Nodes, nodeMap[path.GetNode(i)])
+			}
+			for i := 0; i < path.NumEdges(); i++ {
+				jp.Edges = append(jp.Edges, edgeMap[path.GetEdge(i)])
+			}
+			jpaths = append(jpaths, jp)
+		}
+		if len(nodes) > 0 || len(edges) > 0 {
+			if _, err := out.Write(comma); err != nil {
+				return err
+			}
+		}
+		if err := j.writeValue(pathsKey, jpaths, out); err != nil {
+			return err
+		}
+	}
+
 	if _, err := out.Write(objEnd); err != nil {
 		return err
 	}
@@ -386,14 +570,36 @@ func (j JSON) Encode(g *Graph, out io.Writer) error {
 }
 
 func (j JSON) unmarshalProperty(key string, value json.RawMessage) (string, interface{}, error) {
-	if j.PropertyUnmarshaler == nil {
-		var v interface{}
-		if err := json.Unmarshal(value, &v); err != nil {
+	var v interface{}
+	if j.PropertyUnmarshaler != nil {
+		var err error
+		key, v, err = j.PropertyUnmarshaler(key, value)
+		if err != nil {
+			return "", nil, err
+		}
+	} else if j.PreserveTypes {
+		var err error
+		v, err = DecodeTypedJSONValue(value)
+		if err != nil {
 			return "", nil, err
 		}
+	} else if err := json.Unmarshal(value, &v); err != nil {
+		return "", nil, err
+	}
+	if len(key) == 0 || v == nil {
 		return key, v, nil
 	}
-	return j.PropertyUnmarshaler(key, value)
+	if t, ok := j.PropertyTypes[key]; ok {
+		coerced, ok := t.Coerce(v)
+		if !ok {
+			return "", nil, ErrPropertyType{Key: key, Expected: t, Value: v}
+		}
+		v = coerced
+	}
+	if j.TypedValues {
+		v = PropertyValueOf(v)
+	}
+	return key, v, nil
 }
 
 func (j JSON) unmarshalProperties(input map[string]json.RawMessage) (map[string]interface{}, error) {
@@ -414,45 +620,155 @@ func (j JSON) unmarshalProperties(input map[string]json.RawMessage) (map[string]
 	return ret, nil
 }
 
-func (j JSON) addNode(g *Graph, node jsonNode, nodeMap map[int]*Node, edgeQueue []jsonEdge) ([]jsonEdge, error) {
+// jsonGraphDecoder keeps the state of a decoding operation
+type jsonGraphDecoder struct {
+	JSON
+	g *Graph
+	// If true, nodes and edges are merged into existing nodes and
+	// edges with the same external ID
+	merge bool
+	// If nonempty, nodes are matched to existing nodes using this key
+	nodeKey string
+	// Nodes by index
+	nodeMap map[int]*Node
+	// Edges by the index in the "edges" array
+	edges     []*Edge
+	edgeQueue []jsonEdge
+	paths     []jsonPath
+}
+
+func (j *jsonGraphDecoder) addNode(node jsonNode) error {
 	p, err := j.unmarshalProperties(node.Properties)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for i := range node.Labels {
 		node.Labels[i] = j.Interner.Intern(node.Labels[i])
 	}
-	newNode := g.NewNode(node.Labels, p)
-	nodeMap[node.N] = newNode
+	newNode, err := j.mergeNode(node.ID, node.Labels, p)
+	if err != nil {
+		return err
+	}
+	if newNode == nil {
+		if j.UseNodeIDs {
+			newNode, err = j.g.NewNodeWithID(node.N, node.Labels, p)
+			if err != nil {
+				return err
+			}
+		} else {
+			newNode = j.g.NewNode(node.Labels, p)
+		}
+		if err := newNode.SetExternalID(node.ID); err != nil {
+			return err
+		}
+	}
+	j.nodeMap[node.N] = newNode
 	for _, edge := range node.Edges {
-		to, ok := nodeMap[edge.To]
-		if !ok {
-			edgeQueue = append(edgeQueue, jsonEdge{
-				From:       node.N,
-				To:         edge.To,
-				Label:      edge.Label,
-				Properties: edge.Properties,
-			})
+		e := jsonEdge{
+			ID:         edge.ID,
+			From:       node.N,
+			To:         edge.To,
+			Label:      edge.Label,
+			Properties: edge.Properties,
+			ix:         -1,
+		}
+		to, ok := j.nodeMap[edge.To]
+		// With node IDs, edges are created after all nodes, so the edge
+		// IDs do not collide with the IDs of the nodes decoded later
+		if !ok || j.UseNodeIDs {
+			j.edgeQueue = append(j.edgeQueue, e)
 		} else {
-			if err := j.addEdge(g, newNode, to, edge.Label, edge.Properties); err != nil {
+			if _, err := j.addEdge(newNode, to, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeNode finds the node that has the same external ID or the same
+// nodeKey value and merges the labels and properties into it. Returns
+// nil if there is no such node.
+func (j *jsonGraphDecoder) mergeNode(id string, labels []string, properties map[string]interface{}) (*Node, error) {
+	if !j.merge {
+		return nil, nil
+	}
+	var node *Node
+	if len(id) > 0 {
+		node = j.g.GetNodeByExternalID(id)
+	}
+	if node == nil && len(j.nodeKey) > 0 {
+		key, ok := properties[j.nodeKey]
+		if !ok {
+			return nil, nil
+		}
+		nodes := j.g.FindNodes(StringSet{}, map[string]interface{}{j.nodeKey: key})
+		if !nodes.Next() {
+			return nil, nil
+		}
+		node = nodes.Node()
+		if len(id) > 0 && len(node.externalID) == 0 {
+			if err := node.SetExternalID(id); err != nil {
 				return nil, err
 			}
 		}
 	}
-	return edgeQueue, nil
+	if node == nil {
+		return nil, nil
+	}
+	if !node.labels.HasAll(labels...) {
+		newLabels := node.GetLabels()
+		newLabels.Add(labels...)
+		node.SetLabels(newLabels)
+	}
+	for k, v := range properties {
+		node.SetProperty(k, v)
+	}
+	return node, nil
 }
 
-func (j JSON) addEdge(g *Graph, from, to *Node, label string, properties map[string]json.RawMessage) error {
-	p, err := j.unmarshalProperties(properties)
+func (j *jsonGraphDecoder) addEdge(from, to *Node, edge jsonEdge) (*Edge, error) {
+	p, err := j.unmarshalProperties(edge.Properties)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	g.NewEdge(from, to, label, p)
-	return nil
+	var existing *Edge
+	if j.merge && len(edge.ID) > 0 {
+		existing = j.g.GetEdgeByExternalID(edge.ID)
+	}
+	if existing == nil && j.merge && len(j.nodeKey) > 0 {
+		// Merge into an existing edge with the same label
+		for _, e := range EdgesBetweenNodes(from, to) {
+			if e.label == edge.Label {
+				existing = e
+				break
+			}
+		}
+	}
+	if existing != nil {
+		for k, v := range p {
+			existing.SetProperty(k, v)
+		}
+		return existing, nil
+	}
+	newEdge := j.g.NewEdge(from, to, edge.Label, p)
+	if err := newEdge.SetExternalID(edge.ID); err != nil {
+		return nil, err
+	}
+	return newEdge, nil
 }
 
-// Decode a graph in JSON
-func (j JSON) Decode(g *Graph, input *json.Decoder) error {
+func (j *jsonGraphDecoder) setEdge(ix int, edge *Edge) {
+	if ix < 0 {
+		return
+	}
+	for len(j.edges) <= ix {
+		j.edges = append(j.edges, nil)
+	}
+	j.edges[ix] = edge
+}
+
+func (j *jsonGraphDecoder) decode(input *json.Decoder) error {
 	if j.Interner == nil {
 		j.Interner = make(MapInterner)
 	}
@@ -463,70 +779,145 @@ func (j JSON) Decode(g *Graph, input *json.Decoder) error {
 	if tok != json.Delim('{') {
 		return &json.SyntaxError{Offset: input.InputOffset()}
 	}
-	depth := 0
-	nodeMap := make(map[int]*Node)
-	edgeQueue := make([]jsonEdge, 0)
+	j.nodeMap = make(map[int]*Node)
 	for {
 		tok, err = input.Token()
 		if err != nil {
 			return err
 		}
-		if depth == 0 {
-			if s, ok := tok.(string); ok {
-				if s == "nodes" {
-					var nodes []jsonNode
-					if err := input.Decode(&nodes); err != nil {
-						return err
-					}
-					for _, node := range nodes {
-						if edgeQueue, err = j.addNode(g, node, nodeMap, edgeQueue); err != nil {
-							return err
-						}
-					}
-				} else if s == "edges" {
-					var edges []jsonEdge
-					if err := input.Decode(&edges); err != nil {
-						return err
-					}
-					for _, edge := range edges {
-						from, fromExists := nodeMap[edge.From]
-						to, toExists := nodeMap[edge.To]
-						if fromExists && toExists {
-							if err := j.addEdge(g, from, to, edge.Label, edge.Properties); err != nil {
-								return err
-							}
-						} else {
-							edgeQueue = append(edgeQueue, edge)
-						}
-					}
-				} else {
-					depth = 1
+		if tok == json.Delim('}') {
+			break
+		}
+		s, ok := tok.(string)
+		if !ok {
+			return &json.SyntaxError{Offset: input.InputOffset()}
+		}
+		switch s {
+		case "nodes":
+			var nodes []jsonNode
+			if err := input.Decode(&nodes); err != nil {
+				return err
+			}
+			for _, node := range nodes {
+				if err := j.addNode(node); err != nil {
+					return err
 				}
-			} else if tok == json.Delim('}') {
-				for _, edge := range edgeQueue {
-					from, ok := nodeMap[edge.From]
-					if !ok {
-						return ErrInvalidGraph{Msg: fmt.Sprintf("Invalid edge.from: %d", edge.From)}
-					}
-					to, ok := nodeMap[edge.To]
-					if !ok {
-						return ErrInvalidGraph{Msg: fmt.Sprintf("Invalid edge.to: %d", edge.To)}
-					}
-					if err := j.addEdge(g, from, to, edge.Label, edge.Properties); err != nil {
+			}
+		case "edges":
+			var edges []jsonEdge
+			if err := input.Decode(&edges); err != nil {
+				return err
+			}
+			base := len(j.edges)
+			for ix, edge := range edges {
+				edge.ix = base + ix
+				from, fromExists := j.nodeMap[edge.From]
+				to, toExists := j.nodeMap[edge.To]
+				if fromExists && toExists && !j.UseNodeIDs {
+					e, err := j.addEdge(from, to, edge)
+					if err != nil {
 						return err
 					}
+					j.setEdge(edge.ix, e)
+				} else {
+					j.setEdge(edge.ix, nil)
+					j.edgeQueue = append(j.edgeQueue, edge)
 				}
-				return nil
 			}
-		} else {
-			switch tok {
-			case json.Delim('{'), json.Delim('['):
-				depth++
-			case json.Delim('}'), json.Delim(']'):
-				depth--
-			default:
-				depth--
+		case "paths":
+			if err := input.Decode(&j.paths); err != nil {
+				return err
+			}
+		default:
+			// Skip unknown keys
+			var value json.RawMessage
+			if err := input.Decode(&value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, edge := range j.edgeQueue {
+		from, ok := j.nodeMap[edge.From]
+		if !ok {
+			return ErrInvalidGraph{Msg: fmt.Sprintf("Invalid edge.from: %d", edge.From)}
+		}
+		to, ok := j.nodeMap[edge.To]
+		if !ok {
+			return ErrInvalidGraph{Msg: fmt.Sprintf("Invalid edge.to: %d", edge.To)}
+		}
+		e, err := j.addEdge(from, to, edge)
+		if err != nil {
+			return err
+		}
+		j.setEdge(edge.ix, e)
+	}
+	return nil
+}
+
+// buildPaths returns the decoded paths
+func (j *jsonGraphDecoder) buildPaths() ([]*Path, error) {
+	ret := make([]*Path, 0, len(j.paths))
+	for _, jp := range j.paths {
+		if len(jp.Nodes) != len(jp.Edges)+1 {
+			return nil, ErrInvalidGraph{Msg: "Invalid path"}
+		}
+		first, ok := j.nodeMap[jp.Nodes[0]]
+		if !ok {
+			return nil, ErrInvalidGraph{Msg: fmt.Sprintf("Invalid path node: %d", jp.Nodes[0])}
+		}
+		if len(jp.Edges) == 0 {
+			ret = append(ret, PathFromNode(first))
+			continue
+		}
+		elements := make([]PathElement, 0, len(jp.Edges))
+		for i, ix := range jp.Edges {
+			if ix < 0 || ix >= len(j.edges) || j.edges[ix] == nil {
+				return nil, ErrInvalidGraph{Msg: fmt.Sprintf("Invalid path edge: %d", ix)}
+			}
+			edge := j.edges[ix]
+			source, ok := j.nodeMap[jp.Nodes[i]]
+			if !ok {
+				return nil, ErrInvalidGraph{Msg: fmt.Sprintf("Invalid path node: %d", jp.Nodes[i])}
 			}
+			elements = append(elements, PathElement{Edge: edge, Reverse: edge.GetFrom() != source})
 		}
+		ret = append(ret, NewPathFromElements(elements...))
+	}
+	return ret, nil
+}
+
+// Decode a graph in JSON
+func (j JSON) Decode(g *Graph, input *json.Decoder) error {
+	dec := jsonGraphDecoder{JSON: j, g: g}
+	return dec.decode(input)
+}
+
+// DecodePaths decodes a graph encoded by EncodePaths into g, and
+// returns the decoded paths. All decoded nodes and edges are
+// created. Use Merge to merge them into existing nodes and edges.
+func (j JSON) DecodePaths(g *Graph, input *json.Decoder) ([]*Path, error) {
+	dec := jsonGraphDecoder{JSON: j, g: g}
+	if err := dec.decode(input); err != nil {
+		return nil, err
+	}
+	return dec.buildPaths()
+}
+
+// Merge decodes a graph, or a graph fragment encoded by
+// EncodeSubgraph, EncodeNodes, or EncodePaths, into an existing
+// graph. A decoded node is merged into the existing node with the
+// same external ID, or if nodeKey is nonempty, the same nodeKey
+// property value: the labels of the decoded node are added to the
+// existing node, and its properties are set. Nodes without a match
+// are created. Edges are merged into existing edges with the same
+// external ID, and if nodeKey is nonempty, into existing edges with
+// the same label between the same nodes.
+//
+// Returns the paths included in the input, if any.
+func (j JSON) Merge(g *Graph, input *json.Decoder, nodeKey string) ([]*Path, error) {
+	dec := jsonGraphDecoder{JSON: j, g: g, merge: true, nodeKey: nodeKey}
+	if err := dec.decode(input); err != nil {
+		return nil, err
 	}
+	return dec.buildPaths()
 }
@@ -16,7 +16,10 @@ package lpg
 import (
 	"bytes"
 	"encoding/json"
+	"math"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestEncode(t *testing.T) {
@@ -51,3 +54,178 @@ func TestEncode(t *testing.T) {
 	}
 
 }
+
+func TestPreserveTypes(t *testing.T) {
+	g := NewGraph()
+	tm := time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC)
+	props := map[string]interface{}{
+		"int":    1,
+		"int64":  int64(2),
+		"float":  3.0,
+		"string": "s",
+		"bool":   true,
+		"time":   tm,
+		"date":   NewDate(2021, 1, 2),
+		"dur":    Duration{Months: 14, Days: 3, Nanos: 1500},
+		"ints":   []int{1, 2},
+		"list":   []interface{}{1, "a", nil},
+		"map":    map[string]interface{}{"a": int64(1), "b": 1.5},
+		"int8":   int8(-3),
+		"uint":   uint(4),
+		"uint64": uint64(math.MaxUint64),
+		"f32":    float32(1.1),
+		"list2":  []interface{}{uint16(5), int32(-6)},
+	}
+	g.NewNode([]string{"a"}, props)
+	j := JSON{PreserveTypes: true}
+	buf := bytes.Buffer{}
+	if err := j.Encode(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	newg := NewGraph()
+	if err := j.Decode(newg, json.NewDecoder(&buf)); err != nil {
+		t.Errorf("Err: %v %s", err, buf.String())
+		return
+	}
+	node := newg.GetNodes()
+	node.Next()
+	for k, v := range props {
+		pv, _ := node.Node().GetProperty(k)
+		if !reflect.DeepEqual(v, pv) {
+			t.Errorf("Wrong value for %s: %v (%T)", k, pv, pv)
+		}
+	}
+}
+
+func TestPropertyTypes(t *testing.T) {
+	input := `{"nodes":[{"n":0,"properties":{"age":30,"ts":"2021-01-02T03:04:05Z","name":"x"}}]}`
+	j := JSON{PropertyTypes: map[string]PropertyType{
+		"age": IntPropertyType,
+		"ts":  TimePropertyType,
+	}}
+	g := NewGraph()
+	if err := j.Decode(g, json.NewDecoder(bytes.NewReader([]byte(input)))); err != nil {
+		t.Error(err)
+		return
+	}
+	nodes := g.GetNodes()
+	nodes.Next()
+	if v, _ := nodes.Node().GetProperty("age"); v != 30 {
+		t.Errorf("Wrong age: %v (%T)", v, v)
+	}
+	if v, _ := nodes.Node().GetProperty("ts"); !v.(time.Time).Equal(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Wrong ts: %v", v)
+	}
+
+	j.PropertyTypes["name"] = IntPropertyType
+	err := j.Decode(NewGraph(), json.NewDecoder(bytes.NewReader([]byte(input))))
+	if _, ok := err.(ErrPropertyType); !ok {
+		t.Errorf("Expecting ErrPropertyType, got %v", err)
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	for _, tc := range []struct {
+		t        PropertyType
+		value    interface{}
+		expected interface{}
+		ok       bool
+	}{
+		{IntPropertyType, 2.0, 2, true},
+		{IntPropertyType, 2.5, nil, false},
+		{Int64PropertyType, uint64(math.MaxUint64), nil, false},
+		{FloatPropertyType, 3, 3.0, true},
+		{FloatPropertyType, int64(1 << 53), float64(1 << 53), true},
+		{FloatPropertyType, int64(1<<53 + 1), nil, false},
+		{FloatPropertyType, int64(math.MaxInt64), nil, false},
+		{FloatPropertyType, uint64(math.MaxUint64), nil, false},
+		{FloatPropertyType, uint64(1 << 63), float64(1 << 63), true},
+		{FloatPropertyType, float32(1.5), 1.5, true},
+		{StringPropertyType, 1, nil, false},
+	} {
+		v, ok := tc.t.Coerce(tc.value)
+		if ok != tc.ok || (ok && v != tc.expected) {
+			t.Errorf("%v %v (%T): expected %v %v, got %v %v", tc.t, tc.value, tc.value, tc.expected, tc.ok, v, ok)
+		}
+	}
+}
+
+func TestEncodePaths(t *testing.T) {
+	g := NewGraph()
+	nodes := make([]*Node, 0)
+	for i := 0; i < 4; i++ {
+		nodes = append(nodes, g.NewNode([]string{"a"}, map[string]interface{}{"id": i}))
+	}
+	e1 := g.NewEdge(nodes[0], nodes[1], "e", nil)
+	e2 := g.NewEdge(nodes[2], nodes[1], "e", nil)
+	g.NewEdge(nodes[2], nodes[3], "e", nil)
+	paths := []*Path{
+		NewPathFromElements(PathElement{Edge: e1}, PathElement{Edge: e2, Reverse: true}),
+		PathFromNode(nodes[3]),
+	}
+	buf := bytes.Buffer{}
+	if err := (JSON{}).EncodePaths(paths, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	newg := NewGraph()
+	decoded, err := (JSON{PropertyTypes: map[string]PropertyType{"id": IntPropertyType}}).DecodePaths(newg, json.NewDecoder(&buf))
+	if err != nil {
+		t.Errorf("Err: %v %s", err, buf.String())
+		return
+	}
+	if newg.NumNodes() != 4 || newg.NumEdges() != 2 || len(decoded) != 2 {
+		t.Errorf("Wrong decode: %d %d %d", newg.NumNodes(), newg.NumEdges(), len(decoded))
+		return
+	}
+	if decoded[0].NumEdges() != 2 || !decoded[0].path[1].Reverse {
+		t.Errorf("Wrong path: %s", decoded[0])
+	}
+	for i, id := range []int{0, 1, 2} {
+		if v, _ := decoded[0].GetNode(i).GetProperty("id"); v != id {
+			t.Errorf("Wrong node %d: %v", i, v)
+		}
+	}
+	if v, _ := decoded[1].First().GetProperty("id"); v != 3 {
+		t.Errorf("Wrong single node path: %v", v)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	g := NewGraph()
+	n1 := g.NewNode([]string{"a"}, map[string]interface{}{"key": "1"})
+	n2 := g.NewNode([]string{"a"}, map[string]interface{}{"key": "2"})
+	g.NewEdge(n1, n2, "e", nil)
+
+	src := NewGraph()
+	m1 := src.NewNode([]string{"b"}, map[string]interface{}{"key": "1", "x": "y"})
+	m2 := src.NewNode([]string{"a"}, map[string]interface{}{"key": "2"})
+	m3 := src.NewNode([]string{"a"}, map[string]interface{}{"key": "3"})
+	src.NewEdge(m1, m2, "e", map[string]interface{}{"p": "q"})
+	src.NewEdge(m2, m3, "e", nil)
+	buf := bytes.Buffer{}
+	if err := (JSON{}).EncodeNodes(Neighborhood([]*Node{m2}, 1, AnyEdge), &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	// Unknown keys must be skipped
+	input := `{"meta":{"a":[1,{"b":2}]},` + buf.String()[1:]
+	if _, err := (JSON{}).Merge(g, json.NewDecoder(bytes.NewReader([]byte(input))), "key"); err != nil {
+		t.Error(err)
+		return
+	}
+	if g.NumNodes() != 3 || g.NumEdges() != 2 {
+		t.Errorf("Wrong merge: %d %d", g.NumNodes(), g.NumEdges())
+	}
+	if !n1.HasLabel("a") || !n1.HasLabel("b") {
+		t.Errorf("Wrong labels: %v", n1.GetLabels())
+	}
+	if v, _ := n1.GetProperty("x"); v != "y" {
+		t.Errorf("Wrong property: %v", v)
+	}
+	edges := EdgesBetweenNodes(n1, n2)
+	if v, _ := edges[0].GetProperty("p"); len(edges) != 1 || v != "q" {
+		t.Errorf("Wrong edge merge")
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// typedJSONValue is the JSON representation of a property value with
+// a type tag. T is the type tag, and V is the value.
+//
+//	{"t": "int", "v": 1}
+//	{"t": "time", "v": "2021-01-01T00:00:00Z"}
+//	{"t": "list", "v": [{"t":"int", "v": 1}, {"t": "string", "v": "a"}]}
+type typedJSONValue struct {
+	T string          `json:"t"`
+	V json.RawMessage `json:"v,omitempty"`
+}
+
+// Type tags for values that have no PropertyType, or that are
+// encoded differently from their PropertyType
+const (
+	jsonTagNull        = "null"
+	jsonTagIntSlice    = "[]int"
+	jsonTagInt64Slice  = "[]int64"
+	jsonTagStringSlice = "[]string"
+	jsonTagFloatSlice  = "[]float"
+	jsonTagBoolSlice   = "[]bool"
+	jsonTagJSON        = "json"
+)
+
+// jsonNumericTags are the type tags of the numeric types that have no
+// PropertyType. The tag is the Go type name.
+var jsonNumericTags = map[string]reflect.Type{
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)),
+}
+
+// EncodeTypedJSONValue encodes the value with a type tag, so that it
+// can be decoded exactly using DecodeTypedJSONValue. The values that
+// are decoded with their Go types are nil, strings, bools, all
+// integer and floating point types, time.Time, Point, Date, Duration,
+// slices of int, int64, string, float64, and bool, []interface{}, and
+// map[string]interface{} of such values. Values of other types are
+// marshaled using the default JSON marshaler, and decoded as generic
+// JSON values.
+func EncodeTypedJSONValue(value interface{}) (json.RawMessage, error) {
+	if n, ok := value.(WithNativeValue); ok {
+		value = n.GetNativeValue()
+	}
+	var tag string
+	var v interface{}
+	switch t := value.(type) {
+	case nil:
+		return json.Marshal(typedJSONValue{T: jsonTagNull})
+	case string:
+		tag, v = StringPropertyType.String(), t
+	case bool:
+		tag, v = BoolPropertyType.String(), t
+	case int:
+		tag, v = IntPropertyType.String(), t
+	case int64:
+		tag, v = Int64PropertyType.String(), t
+	case float64:
+		tag, v = FloatPropertyType.String(), t
+	case time.Time:
+		tag, v = TimePropertyType.String(), t.Format(time.RFC3339Nano)
+	case Point:
+		tag, v = PointPropertyType.String(), t
+	case Date:
+		tag, v = DatePropertyType.String(), t.String()
+	case Duration:
+		tag, v = DurationPropertyType.String(), t.String()
+	case []int:
+		tag, v = jsonTagIntSlice, t
+	case []int64:
+		tag, v = jsonTagInt64Slice, t
+	case []string:
+		tag, v = jsonTagStringSlice, t
+	case []float64:
+		tag, v = jsonTagFloatSlice, t
+	case []bool:
+		tag, v = jsonTagBoolSlice, t
+	case []interface{}:
+		elements := make([]json.RawMessage, 0, len(t))
+		for _, x := range t {
+			d, err := EncodeTypedJSONValue(x)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, d)
+		}
+		tag, v = ListPropertyType.String(), elements
+	case map[string]interface{}:
+		m := make(map[string]json.RawMessage, len(t))
+		for k, x := range t {
+			d, err := EncodeTypedJSONValue(x)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = d
+		}
+		tag, v = MapPropertyType.String(), m
+	default:
+		tag, v = jsonTagJSON, t
+		if typ := reflect.TypeOf(t); jsonNumericTags[typ.Name()] == typ {
+			tag = typ.Name()
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(typedJSONValue{T: tag, V: data})
+}
+
+// DecodeTypedJSONValue decodes a value encoded by EncodeTypedJSONValue
+func DecodeTypedJSONValue(in json.RawMessage) (interface{}, error) {
+	var tv typedJSONValue
+	if err := json.Unmarshal(in, &tv); err != nil {
+		return nil, err
+	}
+	unmarshal := func(out interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(tv.V))
+		return dec.Decode(out)
+	}
+	switch tv.T {
+	case jsonTagNull:
+		return nil, nil
+	case "string":
+		var s string
+		err := unmarshal(&s)
+		return s, err
+	case "bool":
+		var b bool
+		err := unmarshal(&b)
+		return b, err
+	case "int":
+		var i int
+		err := unmarshal(&i)
+		return i, err
+	case "int64":
+		var i int64
+		err := unmarshal(&i)
+		return i, err
+	case "float":
+		var f float64
+		err := unmarshal(&f)
+		return f, err
+	case "time":
+		var s string
+		if err := unmarshal(&s); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case "point":
+		var p Point
+		err := unmarshal(&p)
+		return p, err
+	case "date":
+		var d Date
+		err := unmarshal(&d)
+		return d, err
+	case "duration":
+		var d Duration
+		err := unmarshal(&d)
+		return d, err
+	case jsonTagIntSlice:
+		var v []int
+		err := unmarshal(&v)
+		return v, err
+	case jsonTagInt64Slice:
+		var v []int64
+		err := unmarshal(&v)
+		return v, err
+	case jsonTagStringSlice:
+		var v []string
+		err := unmarshal(&v)
+		return v, err
+	case jsonTagFloatSlice:
+		var v []float64
+		err := unmarshal(&v)
+		return v, err
+	case jsonTagBoolSlice:
+		var v []bool
+		err := unmarshal(&v)
+		return v, err
+	case "list":
+		var elements []json.RawMessage
+		if err := unmarshal(&elements); err != nil {
+			return nil, err
+		}
+		ret := make([]interface{}, 0, len(elements))
+		for _, e := range elements {
+			x, err := DecodeTypedJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, x)
+		}
+		return ret, nil
+	case "map":
+		var m map[string]json.RawMessage
+		if err := unmarshal(&m); err != nil {
+			return nil, err
+		}
+		ret := make(map[string]interface{}, len(m))
+		for k, e := range m {
+			x, err := DecodeTypedJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = x
+		}
+		return ret, nil
+	case jsonTagJSON:
+		var v interface{}
+		err := unmarshal(&v)
+		return v, err
+	}
+	if typ, ok := jsonNumericTags[tv.T]; ok {
+		v := reflect.New(typ)
+		err := unmarshal(v.Interface())
+		return v.Elem().Interface(), err
+	}
+	return nil, fmt.Errorf("Unknown type tag: %s", tv.T)
+}
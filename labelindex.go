@@ -0,0 +1,191 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+// labelProperty identifies a label-scoped property index
+type labelProperty struct {
+	label    string
+	property string
+}
+
+// checkIndexType panics with ErrUnsupportedIndexType if the index
+// type is not btree or hash
+func checkIndexType(it IndexType) {
+	if it != BtreeIndex && it != HashIndex {
+		panic(ErrUnsupportedIndexType{Type: it, Msg: "Expecting a btree or hash index"})
+	}
+}
+
+// newIndex returns a btree or a hash index. Panics with
+// ErrUnsupportedIndexType for other index types.
+func newIndex(it IndexType) index {
+	checkIndexType(it)
+	if it == BtreeIndex {
+		return &setTree{}
+	}
+	return &hashIndex{}
+}
+
+// NodeLabelPropertyIndex sets up an index for the property of the
+// nodes with the label
+func (g *graphIndex) NodeLabelPropertyIndex(label, propertyName string, graph *Graph, it IndexType) {
+	key := labelProperty{label: label, property: propertyName}
+	if _, exists := g.nodeLabelProperties[key]; exists {
+		return
+	}
+	ix := newIndex(it)
+	g.nodeLabelProperties[key] = ix
+	for nodes := g.nodesByLabel.IteratorAllLabels(NewStringSet(label)); nodes.Next(); {
+		node := nodes.Node()
+		if value, ok := node.properties.getProperty(propertyName); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+}
+
+// EdgeLabelPropertyIndex sets up an index for the property of the
+// edges with the label
+func (g *graphIndex) EdgeLabelPropertyIndex(label, propertyName string, graph *Graph, it IndexType) {
+	key := labelProperty{label: label, property: propertyName}
+	if _, exists := g.edgeLabelProperties[key]; exists {
+		return
+	}
+	ix := newIndex(it)
+	g.edgeLabelProperties[key] = ix
+	for edges := graph.GetEdgesWithAnyLabel(NewStringSet(label)); edges.Next(); {
+		edge := edges.Edge()
+		if value, ok := edge.properties.getProperty(propertyName); ok {
+			ix.add(value, edge.id, edge)
+		}
+	}
+}
+
+// addNodeToLabelIndexes adds the node to the label-scoped indexes for
+// its labels. If property is nonempty, only the indexes for that
+// property are updated.
+func (g *graphIndex) addNodeToLabelIndexes(node *Node, property string) {
+	for k, ix := range g.nodeLabelProperties {
+		if (len(property) > 0 && k.property != property) || !node.labels.Has(k.label) {
+			continue
+		}
+		if value, ok := node.properties.getProperty(k.property); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+}
+
+// removeNodeFromLabelIndexes removes the node from the label-scoped
+// indexes for its labels. If property is nonempty, only the indexes
+// for that property are updated.
+func (g *graphIndex) removeNodeFromLabelIndexes(node *Node, property string) {
+	for k, ix := range g.nodeLabelProperties {
+		if (len(property) > 0 && k.property != property) || !node.labels.Has(k.label) {
+			continue
+		}
+		if value, ok := node.properties.getProperty(k.property); ok {
+			ix.remove(value, node.id)
+		}
+	}
+}
+
+func (g *graphIndex) addEdgeToLabelIndexes(edge *Edge, property string) {
+	for k, ix := range g.edgeLabelProperties {
+		if (len(property) > 0 && k.property != property) || edge.label != k.label {
+			continue
+		}
+		if value, ok := edge.properties.getProperty(k.property); ok {
+			ix.add(value, edge.id, edge)
+		}
+	}
+}
+
+func (g *graphIndex) removeEdgeFromLabelIndexes(edge *Edge, property string) {
+	for k, ix := range g.edgeLabelProperties {
+		if (len(property) > 0 && k.property != property) || edge.label != k.label {
+			continue
+		}
+		if value, ok := edge.properties.getProperty(k.property); ok {
+			ix.remove(value, edge.id)
+		}
+	}
+}
+
+// GetIteratorForNodeLabelProperty returns an iterator for the nodes
+// with one of the labels and the key/value using the most selective
+// label-scoped index, or nil if there is no label-scoped index
+func (g *graphIndex) GetIteratorForNodeLabelProperty(labels StringSet, key string, value interface{}) NodeIterator {
+	if len(g.nodeLabelProperties) == 0 {
+		return nil
+	}
+	var ret Iterator
+	for label := range labels.M {
+		ix, ok := g.nodeLabelProperties[labelProperty{label: label, property: key}]
+		if !ok {
+			continue
+		}
+		itr := ix.find(value)
+		if ret == nil || itr.MaxSize() < ret.MaxSize() {
+			ret = itr
+		}
+	}
+	if ret == nil {
+		return nil
+	}
+	return nodeIterator{ret}
+}
+
+// GetIteratorForEdgeLabelProperty returns an iterator for the edges
+// that have one of the labels, and the key/value. All the labels must
+// have a label-scoped index for the key, otherwise returns nil.
+func (g *graphIndex) GetIteratorForEdgeLabelProperty(labels StringSet, key string, value interface{}) EdgeIterator {
+	if len(g.edgeLabelProperties) == 0 || labels.Len() == 0 {
+		return nil
+	}
+	iterators := make([]Iterator, 0, labels.Len())
+	size := 0
+	for label := range labels.M {
+		ix, ok := g.edgeLabelProperties[labelProperty{label: label, property: key}]
+		if !ok {
+			return nil
+		}
+		itr := ix.find(value)
+		iterators = append(iterators, itr)
+		size += itr.MaxSize()
+	}
+	if len(iterators) == 1 {
+		return edgeIterator{iterators[0]}
+	}
+	return edgeIterator{withSize(MultiIterator(iterators...), size)}
+}
+
+// AddNodeLabelPropertyIndex adds an index for the property of the
+// nodes with the label. Unlike the index added by
+// AddNodePropertyIndex, this index only includes the nodes with the
+// label, so FindNodes and pattern searches for nodes with the label
+// prefer it. The index type must be BtreeIndex or HashIndex, otherwise
+// this call panics with ErrUnsupportedIndexType.
+func (g *Graph) AddNodeLabelPropertyIndex(label, propertyName string, ix IndexType) {
+	checkIndexType(ix)
+	g.indexesChanged()
+	g.index.NodeLabelPropertyIndex(label, propertyName, g, ix)
+}
+
+// AddEdgeLabelPropertyIndex adds an index for the property of the
+// edges with the label.
+func (g *Graph) AddEdgeLabelPropertyIndex(label, propertyName string, ix IndexType) {
+	checkIndexType(ix)
+	g.indexesChanged()
+	g.index.EdgeLabelPropertyIndex(label, propertyName, g, ix)
+}
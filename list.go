@@ -97,6 +97,7 @@ type nodeElement struct {
 
 func (list *nodeList) add(node *Node) {
 	node.prev = list.tail
+	node.next = nil
 	if list.tail != nil {
 		list.tail.next = node
 	}
@@ -117,11 +118,32 @@ func (list *nodeList) remove(node *Node) {
 	if node.next != nil {
 		node.next.prev = node.prev
 	} else {
-		list.tail = node
+		list.tail = node.prev
 	}
+	node.next = nil
+	node.prev = nil
 	list.n--
 }
 
+// insertAfter inserts node after prev. If prev is nil, node is
+// inserted to the head of the list
+func (list *nodeList) insertAfter(node, prev *Node) {
+	node.prev = prev
+	if prev == nil {
+		node.next = list.head
+		list.head = node
+	} else {
+		node.next = prev.next
+		prev.next = node
+	}
+	if node.next != nil {
+		node.next.prev = node
+	} else {
+		list.tail = node
+	}
+	list.n++
+}
+
 type nodeListIterator struct {
 	current, next *Node
 	n             int
@@ -40,10 +40,6 @@ func (nm *NodeMap) Replace(node *Node, oldLabels, newLabels StringSet) {
 		}
 		nm.nolabels.remove(node.id)
 	}
-	if newLabels.Len() == 0 {
-		nm.nolabels.add(node.id, node)
-		return
-	}
 	var set *fastSet
 	// Process removed labels
 	for label := range oldLabels.M {
@@ -59,6 +55,10 @@ func (nm *NodeMap) Replace(node *Node, oldLabels, newLabels StringSet) {
 			}
 		}
 	}
+	if newLabels.Len() == 0 {
+		nm.nolabels.add(node.id, node)
+		return
+	}
 	// Process added labels
 	for label := range newLabels.M {
 		if !oldLabels.Has(label) {
@@ -112,6 +112,24 @@ func (nm NodeMap) Remove(node *Node) {
 	}
 }
 
+// sizeLabel returns the number of nodes with the label
+func (nm NodeMap) sizeLabel(label string) int {
+	v, found := nm.m.Get(label)
+	if !found {
+		return 0
+	}
+	return v.(*fastSet).size()
+}
+
+// labels returns the labels of the nodes
+func (nm NodeMap) labels() StringSet {
+	ret := NewStringSet()
+	for _, k := range nm.m.Keys() {
+		ret.Add(k.(string))
+	}
+	return ret
+}
+
 func (nm NodeMap) IsEmpty() bool {
 	if nm.m.Size() == 0 {
 		return true
@@ -28,8 +28,8 @@ func TestNodeMap(t *testing.T) {
 		for i := 0; i < 10; i++ {
 			node := &Node{labels: NewStringSet(l...), id: id}
 			id++
-			node.properties = make(properties)
-			node.properties["index"] = i
+			node.properties.m = make(map[string]any)
+			node.properties.m["index"] = i
 			m.Add(node)
 			data[fmt.Sprintf("%d:%d", len(l), i)] = struct{}{}
 		}
@@ -39,7 +39,7 @@ func TestNodeMap(t *testing.T) {
 	found := make(map[string]struct{})
 	for itr.Next() {
 		node := itr.Node()
-		found[fmt.Sprintf("%d:%d", node.labels.Len(), node.properties["index"])] = struct{}{}
+		found[fmt.Sprintf("%d:%d", node.labels.Len(), node.properties.m["index"])] = struct{}{}
 	}
 	if len(found) != len(data) {
 		t.Errorf("found: %v", found)
@@ -54,7 +54,7 @@ func TestNodeMap(t *testing.T) {
 			if !node.labels.HasAll(label...) {
 				t.Errorf("Expecting %v got %+v", label, node)
 			}
-			found[fmt.Sprint(node.properties["index"])] = struct{}{}
+			found[fmt.Sprint(node.properties.m["index"])] = struct{}{}
 		}
 		if len(found) != 10 {
 			t.Errorf("10 entries were expected, got %v", found)
@@ -0,0 +1,124 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MermaidRenderer renders a graph as a Mermaid flowchart
+type MermaidRenderer struct {
+	// NodeRenderer renders a node. If the node is to be excluded, returns false.
+	NodeRenderer func(string, *Node, io.Writer) (bool, error)
+	// EdgeRenderer renders an edge. The from and to nodes are rendered
+	// if this is called. If the edge is to be excluded, returns false
+	EdgeRenderer func(fromID string, toID string, edge *Edge, w io.Writer) (bool, error)
+
+	// Direction is the flowchart direction (LR, RL, TD, BT). If empty, LR is used.
+	Direction string
+
+	// Properties are the property keys rendered by the default node
+	// and edge renderers
+	Properties []string
+
+	// If positive, at most MaxNodes nodes and MaxEdges edges are rendered
+	MaxNodes int
+	MaxEdges int
+}
+
+// RenderNode renders a node. If node renderer is not set, calls the default renderer
+func (m MermaidRenderer) RenderNode(ID string, node *Node, w io.Writer) (bool, error) {
+	if m.NodeRenderer == nil {
+		return true, DefaultMermaidNodeRender(ID, node, m.Properties, w)
+	}
+	return m.NodeRenderer(ID, node, w)
+}
+
+// RenderEdge renders an edge. If edge renderer is not set, call the default renderer
+func (m MermaidRenderer) RenderEdge(fromID, toID string, edge *Edge, w io.Writer) (bool, error) {
+	if m.EdgeRenderer == nil {
+		return true, DefaultMermaidEdgeRender(fromID, toID, edge, m.Properties, w)
+	}
+	return m.EdgeRenderer(fromID, toID, edge, w)
+}
+
+// EscapeMermaidString escapes a string so it can be used in a quoted
+// Mermaid label
+func EscapeMermaidString(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br/>").Replace(s)
+}
+
+// DefaultMermaidNodeRender renders the node with its labels and the
+// given properties
+func DefaultMermaidNodeRender(ID string, node *Node, properties []string, w io.Writer) error {
+	lines := make([]string, 0, len(properties)+1)
+	if node.labels.Len() > 0 {
+		lines = append(lines, EscapeMermaidString(displayLabels(node.labels)))
+	}
+	for _, p := range displayProperties(node, properties) {
+		lines = append(lines, EscapeMermaidString(p))
+	}
+	if len(lines) == 0 {
+		_, err := fmt.Fprintf(w, "  %s\n", ID)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "  %s[\"%s\"]\n", ID, strings.Join(lines, "<br/>"))
+	return err
+}
+
+// DefaultMermaidEdgeRender renders the edge with its label and the
+// given properties
+func DefaultMermaidEdgeRender(fromNode, toNode string, edge *Edge, properties []string, w io.Writer) error {
+	lines := make([]string, 0, len(properties)+1)
+	if len(edge.label) > 0 {
+		lines = append(lines, EscapeMermaidString(edge.label))
+	}
+	for _, p := range displayProperties(edge, properties) {
+		lines = append(lines, EscapeMermaidString(p))
+	}
+	if len(lines) == 0 {
+		_, err := fmt.Fprintf(w, "  %s --> %s\n", fromNode, toNode)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "  %s -->|\"%s\"| %s\n", fromNode, strings.Join(lines, "<br/>"), toNode)
+	return err
+}
+
+// Render writes a Mermaid flowchart
+func (m MermaidRenderer) Render(g *Graph, out io.Writer) error {
+	dir := m.Direction
+	if len(dir) == 0 {
+		dir = "LR"
+	}
+	if _, err := fmt.Fprintf(out, "flowchart %s\n", dir); err != nil {
+		return err
+	}
+	omittedNodes, omittedEdges, err := renderGraphNodesEdges(g, "n", m.MaxNodes, m.MaxEdges, func(ID string, node *Node) (bool, error) {
+		return m.RenderNode(ID, node, out)
+	}, func(fromID, toID string, edge *Edge) (bool, error) {
+		return m.RenderEdge(fromID, toID, edge, out)
+	})
+	if err != nil {
+		return err
+	}
+	if omittedNodes > 0 || omittedEdges > 0 {
+		if _, err := fmt.Fprintf(out, "  %%%% %d nodes and %d edges omitted\n", omittedNodes, omittedEdges); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -29,6 +29,9 @@ type Node struct {
 	incoming edgeMap
 	outgoing edgeMap
 	id       int
+
+	// User-defined unique key, if nonempty
+	externalID string
 }
 
 // GetProperty returns the property value in the string table
@@ -66,6 +69,46 @@ func (node *Node) GetEdges(dir EdgeDir) EdgeIterator {
 	return edgeIterator{withSize(MultiIterator(i1, i2), i1.MaxSize()+i2.MaxSize())}
 }
 
+// Degree returns the number of incoming or outgoing edges of the
+// node. For AnyEdge, returns the sum of the two, so a self-loop is
+// counted twice.
+func (node *Node) Degree(dir EdgeDir) int {
+	switch dir {
+	case IncomingEdge:
+		return node.incoming.size()
+	case OutgoingEdge:
+		return node.outgoing.size()
+	}
+	return node.incoming.size() + node.outgoing.size()
+}
+
+// DegreeWithLabel returns the number of incoming or outgoing edges of
+// the node with the given label. For AnyEdge, returns the sum of the
+// two.
+func (node *Node) DegreeWithLabel(dir EdgeDir, label string) int {
+	switch dir {
+	case IncomingEdge:
+		return node.incoming.sizeLabel(label)
+	case OutgoingEdge:
+		return node.outgoing.sizeLabel(label)
+	}
+	return node.incoming.sizeLabel(label) + node.outgoing.sizeLabel(label)
+}
+
+// GetEdgeLabels returns the labels of the incoming or outgoing edges
+// of the node
+func (node *Node) GetEdgeLabels(dir EdgeDir) StringSet {
+	switch dir {
+	case IncomingEdge:
+		return node.incoming.labels()
+	case OutgoingEdge:
+		return node.outgoing.labels()
+	}
+	ret := node.incoming.labels()
+	ret.AddSet(node.outgoing.labels())
+	return ret
+}
+
 // Returns an edge iterator for incoming or outgoing edges with the given label
 func (node *Node) GetEdgesWithLabel(dir EdgeDir, label string) EdgeIterator {
 	switch dir {
@@ -100,26 +143,31 @@ func (node *Node) GetEdgesWithAnyLabel(dir EdgeDir, labels StringSet) EdgeIterat
 
 // SetLabels sets the node labels
 func (node *Node) SetLabels(labels StringSet) {
+	defer node.graph.endMutation(node.graph.mutation(), nil)
 	node.graph.setNodeLabels(node, labels)
 }
 
 // SetProperty sets a node property
 func (node *Node) SetProperty(key string, value interface{}) {
+	defer node.graph.endMutation(node.graph.mutation(), nil)
 	node.graph.setNodeProperty(node, key, value)
 }
 
 // RemoveProperty removes a node property
 func (node *Node) RemoveProperty(key string) {
+	defer node.graph.endMutation(node.graph.mutation(), nil)
 	node.graph.removeNodeProperty(node, key)
 }
 
 // Remove all connected edges, and remove the node
 func (node *Node) DetachAndRemove() {
+	defer node.graph.endMutation(node.graph.mutation(), nil)
 	node.graph.detachRemoveNode(node)
 }
 
 // Remove all connected edges
 func (node *Node) Detach() {
+	defer node.graph.endMutation(node.graph.mutation(), nil)
 	node.graph.detachNode(node)
 }
 
@@ -129,7 +177,7 @@ func (node *Node) String() string {
 	if node.labels.Len() > 0 {
 		labels = ":" + labels
 	}
-	return fmt.Sprintf("(%s %s)", labels, node.properties)
+	return fmt.Sprintf("(%s %s)", labels, &node.properties)
 }
 
 func (node *Node) MarshalJSON() ([]byte, error) {
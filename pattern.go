@@ -52,6 +52,15 @@ type PatternItem struct {
 	// name is defined, it is used to constrain values. If not, it is
 	// used to store values
 	Name string
+
+	// If Nearest is set, the node only matches the nearest nodes
+	// found using the vector index. The other constraints of the item
+	// are applied to those nodes, so the item may match fewer than
+	// Nearest.K nodes.
+	Nearest *NearestQuery
+
+	// The result of the nearest query, set when the plan is built
+	nearest *NodeSet
 }
 
 func (p PatternItem) getEdgeFilter() func(*Edge) bool {
@@ -59,7 +68,13 @@ func (p PatternItem) getEdgeFilter() func(*Edge) bool {
 }
 
 func (p PatternItem) getNodeFilter() func(*Node) bool {
-	return GetNodeFilterFunc(p.Labels, p.Properties)
+	filter := GetNodeFilterFunc(p.Labels, p.Properties)
+	if p.nearest == nil {
+		return filter
+	}
+	return func(node *Node) bool {
+		return p.nearest.Has(node) && filter(node)
+	}
 }
 
 // Returns the set of nodes constraining the pattern item. That is,
@@ -113,9 +128,13 @@ func (p PatternItem) isConstrainedEdges(ctx *MatchContext) (*EdgeSet, error) {
 func (p *PatternItem) estimateNodeSize(g *Graph, symbols map[string]*PatternSymbol) (NodeIterator, int) {
 	max := -1
 	var ret NodeIterator
+	if p.nearest != nil {
+		max = p.nearest.Len()
+		ret = p.nearest.Iterator()
+	}
 	if p.Labels.Len() > 0 {
 		itr := g.index.nodesByLabel.IteratorAllLabels(p.Labels)
-		if sz := itr.MaxSize(); sz != -1 {
+		if sz := itr.MaxSize(); sz != -1 && (max == -1 || sz < max) {
 			max = sz
 			ret = itr
 		}
@@ -135,6 +154,22 @@ func (p *PatternItem) estimateNodeSize(g *Graph, symbols map[string]*PatternSymb
 				ret = itr
 			}
 		}
+		if itr := g.index.GetIteratorForNodeComposite(p.Properties); itr != nil {
+			if maxSize := itr.MaxSize(); maxSize != -1 && (max == -1 || maxSize < max) {
+				max = maxSize
+				ret = itr
+			}
+		}
+		for k, v := range p.Properties {
+			itr := g.index.GetIteratorForNodeLabelProperty(p.Labels, k, v)
+			if itr == nil {
+				continue
+			}
+			if maxSize := itr.MaxSize(); maxSize != -1 && (max == -1 || maxSize <= max) {
+				max = maxSize
+				ret = itr
+			}
+		}
 	}
 	if len(p.Name) > 0 {
 		sym, ok := symbols[p.Name]
@@ -191,7 +226,23 @@ func (p PatternItem) estimateEdgeSize(g *Graph, symbols map[string]*PatternSymbo
 			if maxSize == -1 {
 				continue
 			}
-			if maxSize < max {
+			if max == -1 || maxSize < max {
+				max = maxSize
+				ret = itr
+			}
+		}
+		if itr := g.index.GetIteratorForEdgeComposite(p.Properties); itr != nil {
+			if maxSize := itr.MaxSize(); maxSize != -1 && (max == -1 || maxSize < max) {
+				max = maxSize
+				ret = itr
+			}
+		}
+		for k, v := range p.Properties {
+			itr := g.index.GetIteratorForEdgeLabelProperty(p.Labels, k, v)
+			if itr == nil {
+				continue
+			}
+			if maxSize := itr.MaxSize(); maxSize != -1 && (max == -1 || maxSize <= max) {
 				max = maxSize
 				ret = itr
 			}
@@ -348,7 +399,7 @@ func (pattern Pattern) FindNodes(graph *Graph, symbols map[string]*PatternSymbol
 }
 
 func (pattern Pattern) getFastestElement(graph *Graph, symbols map[string]*PatternSymbol) (Iterator, int) {
-	maxSize := -1
+	best := -1.0
 	index := 0
 	var itr Iterator
 	for i := range pattern {
@@ -360,8 +411,9 @@ func (pattern Pattern) getFastestElement(graph *Graph, symbols map[string]*Patte
 			t, sz = pattern[i].estimateEdgeSize(graph, symbols)
 		}
 		if sz != -1 {
-			if maxSize == -1 || sz < maxSize {
-				maxSize = sz
+			rows := pattern[i].estimateRows(graph, (i%2) == 1, sz)
+			if best == -1 || rows < best {
+				best = rows
 				index = i
 				itr = t
 			}
@@ -370,6 +422,44 @@ func (pattern Pattern) getFastestElement(graph *Graph, symbols map[string]*Patte
 	return itr, index
 }
 
+// estimateRows estimates the number of nodes or edges matching the
+// pattern item, given the size of its iterator. The iterator is
+// filtered by the properties of the item, and the selectivity of an
+// indexed property is estimated from the index statistics as the
+// fraction of nodes or edges with the property, divided by the number
+// of distinct values. Properties are assumed to be independent.
+func (p PatternItem) estimateRows(g *Graph, edge bool, size int) float64 {
+	ret := float64(size)
+	total := g.NumNodes()
+	if edge {
+		total = g.NumEdges()
+	}
+	if total == 0 {
+		return ret
+	}
+	for k, v := range p.Properties {
+		if v == nil {
+			continue
+		}
+		stats, ok := g.index.propertyStats(edge, k)
+		if !ok || stats.DistinctValues == 0 {
+			continue
+		}
+		// Skip the property if the iterator is from its index
+		var itr Iterator
+		if edge {
+			itr = g.index.GetIteratorForEdgeProperty(k, v)
+		} else {
+			itr = g.index.GetIteratorForNodeProperty(k, v)
+		}
+		if itr.MaxSize() <= size {
+			continue
+		}
+		ret *= float64(stats.Entries) / float64(total) / float64(stats.DistinctValues)
+	}
+	return ret
+}
+
 func (pattern Pattern) GetSymbolNames() StringSet {
 	ret := NewStringSet()
 	for _, p := range pattern {
@@ -380,8 +470,42 @@ func (pattern Pattern) GetSymbolNames() StringSet {
 	return ret
 }
 
+// resolveNearest runs the nearest queries of the pattern items, and
+// returns a copy of the pattern with the results
+func (pattern Pattern) resolveNearest(graph *Graph) (Pattern, error) {
+	var ret Pattern
+	for i := range pattern {
+		if pattern[i].Nearest == nil {
+			continue
+		}
+		q := pattern[i].Nearest
+		if (i % 2) == 1 {
+			return nil, ErrVectorIndex{Property: q.Property, Msg: "Nearest query on an edge"}
+		}
+		items, err := graph.index.nearestNodes(q.Property, q.Vector, q.K)
+		if err != nil {
+			return nil, err
+		}
+		if ret == nil {
+			ret = append(Pattern{}, pattern...)
+		}
+		ret[i].nearest = NewNodeSet()
+		for _, item := range items {
+			ret[i].nearest.Add(item.item.(*Node))
+		}
+	}
+	if ret == nil {
+		return pattern, nil
+	}
+	return ret, nil
+}
+
 // GetPlan returns a match execution plan
 func (pattern Pattern) GetPlan(graph *Graph, symbols map[string]*PatternSymbol) (MatchPlan, error) {
+	pattern, err := pattern.resolveNearest(graph)
+	if err != nil {
+		return MatchPlan{}, err
+	}
 	itr, index := pattern.getFastestElement(graph, symbols)
 	plan := MatchPlan{}
 	processors := make([]planProcessor, len(pattern))
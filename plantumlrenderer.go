@@ -0,0 +1,126 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PlantUMLRenderer renders a graph as a PlantUML object diagram
+type PlantUMLRenderer struct {
+	// NodeRenderer renders a node. If the node is to be excluded, returns false.
+	NodeRenderer func(string, *Node, io.Writer) (bool, error)
+	// EdgeRenderer renders an edge. The from and to nodes are rendered
+	// if this is called. If the edge is to be excluded, returns false
+	EdgeRenderer func(fromID string, toID string, edge *Edge, w io.Writer) (bool, error)
+
+	// Properties are the property keys rendered by the default node
+	// and edge renderers
+	Properties []string
+
+	// If positive, at most MaxNodes nodes and MaxEdges edges are rendered
+	MaxNodes int
+	MaxEdges int
+}
+
+// RenderNode renders a node. If node renderer is not set, calls the default renderer
+func (p PlantUMLRenderer) RenderNode(ID string, node *Node, w io.Writer) (bool, error) {
+	if p.NodeRenderer == nil {
+		return true, DefaultPlantUMLNodeRender(ID, node, p.Properties, w)
+	}
+	return p.NodeRenderer(ID, node, w)
+}
+
+// RenderEdge renders an edge. If edge renderer is not set, call the default renderer
+func (p PlantUMLRenderer) RenderEdge(fromID, toID string, edge *Edge, w io.Writer) (bool, error) {
+	if p.EdgeRenderer == nil {
+		return true, DefaultPlantUMLEdgeRender(fromID, toID, edge, p.Properties, w)
+	}
+	return p.EdgeRenderer(fromID, toID, edge, w)
+}
+
+// EscapePlantUMLString escapes a string so it can be used in a
+// PlantUML object name or field
+func EscapePlantUMLString(s string) string {
+	return strings.NewReplacer(`"`, "'", "\n", `\n`, "{", "(", "}", ")").Replace(s)
+}
+
+// DefaultPlantUMLNodeRender renders the node as an object named after
+// its labels, with the given properties as fields
+func DefaultPlantUMLNodeRender(ID string, node *Node, properties []string, w io.Writer) error {
+	name := displayLabels(node.labels)
+	if len(name) == 0 {
+		name = ID
+	}
+	if _, err := fmt.Fprintf(w, "object \"%s\" as %s", EscapePlantUMLString(name), ID); err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(properties))
+	for _, k := range properties {
+		if v, ok := node.GetProperty(k); ok {
+			fields = append(fields, fmt.Sprintf("  %s = %s\n", EscapePlantUMLString(k), EscapePlantUMLString(fmt.Sprint(v))))
+		}
+	}
+	if len(fields) == 0 {
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	if _, err := io.WriteString(w, " {\n"+strings.Join(fields, "")+"}\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DefaultPlantUMLEdgeRender renders the edge as a link with its label
+// and the given properties
+func DefaultPlantUMLEdgeRender(fromNode, toNode string, edge *Edge, properties []string, w io.Writer) error {
+	lines := make([]string, 0, len(properties)+1)
+	if len(edge.label) > 0 {
+		lines = append(lines, EscapePlantUMLString(edge.label))
+	}
+	for _, p := range displayProperties(edge, properties) {
+		lines = append(lines, EscapePlantUMLString(p))
+	}
+	if len(lines) == 0 {
+		_, err := fmt.Fprintf(w, "%s --> %s\n", fromNode, toNode)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s --> %s : %s\n", fromNode, toNode, strings.Join(lines, `\n`))
+	return err
+}
+
+// Render writes a PlantUML object diagram
+func (p PlantUMLRenderer) Render(g *Graph, out io.Writer) error {
+	if _, err := io.WriteString(out, "@startuml\n"); err != nil {
+		return err
+	}
+	omittedNodes, omittedEdges, err := renderGraphNodesEdges(g, "n", p.MaxNodes, p.MaxEdges, func(ID string, node *Node) (bool, error) {
+		return p.RenderNode(ID, node, out)
+	}, func(fromID, toID string, edge *Edge) (bool, error) {
+		return p.RenderEdge(fromID, toID, edge, out)
+	})
+	if err != nil {
+		return err
+	}
+	if omittedNodes > 0 || omittedEdges > 0 {
+		if _, err := fmt.Fprintf(out, "' %d nodes and %d edges omitted\n", omittedNodes, omittedEdges); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(out, "@enduml\n")
+	return err
+}
@@ -19,25 +19,37 @@ import (
 	"strings"
 )
 
-type properties map[string]any
+// properties are the properties of a node or edge. If the graph pages
+// properties to disk, m is nil while the properties are paged out, and
+// they are loaded by the accessors.
+type properties struct {
+	m map[string]any
+	// Non-nil if the properties are managed by a property pager
+	page *propertyPage
+	// If true, m is shared with a snapshot
+	shared bool
+}
 
-// GetProperty returns the value for the key, and whether or not key
-// exists. p can be nil
-func (p *properties) getProperty(key string) (interface{}, bool) {
-	if *p == nil {
-		return nil, false
+// load returns the property map, loading it if it is paged out. The
+// returned map can be nil, and must not be modified.
+func (p *properties) load() map[string]any {
+	if p.page != nil {
+		return p.page.pager.load(p)
 	}
-	x, ok := (*p)[key]
+	return p.m
+}
+
+// getProperty returns the value for the key, and whether or not key
+// exists
+func (p *properties) getProperty(key string) (interface{}, bool) {
+	x, ok := p.load()[key]
 	return x, ok
 }
 
-// ForEachProperty calls f for each property in p until f returns
-// false. Returns false if f returned false. p can be nil
+// forEachProperty calls f for each property in p until f returns
+// false. Returns false if f returned false.
 func (p *properties) forEachProperty(f func(string, interface{}) bool) bool {
-	if *p == nil {
-		return true
-	}
-	for k, v := range *p {
+	for k, v := range p.load() {
 		if !f(k, v) {
 			return false
 		}
@@ -45,172 +57,71 @@ func (p *properties) forEachProperty(f func(string, interface{}) bool) bool {
 	return true
 }
 
-// WithNativeValue is used to return a native value for property
-// values. If the property value implements this interface, the
-// underlying native value for indexing and comparison is obtained
-// from this interface.
-type WithNativeValue interface {
-	GetNativeValue() interface{}
-}
-
-// ComparePropertyValue compares a and b. They must be
-// comparable. Supported types are
-//
-//	int
-//	string
-//	[]int
-//	[]string
-//	[]interface
-//
-// The []interface must have one of the supported types as its elements
-//
-// If one of the values implement GetNativeValue() method, then it is
-// called to get the underlying value
-func ComparePropertyValue(a, b interface{}) int {
-
-	if n, ok := a.(WithNativeValue); ok {
-		return ComparePropertyValue(n.GetNativeValue(), b)
+// propertyKeys returns the property keys
+func (p *properties) propertyKeys() []string {
+	m := p.load()
+	if m == nil {
+		return nil
 	}
-	if n, ok := b.(WithNativeValue); ok {
-		return ComparePropertyValue(a, n.GetNativeValue())
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
 	}
+	return ret
+}
 
-	switch v1 := a.(type) {
-	case string:
-		if v2, ok := b.(string); ok {
-			if v1 == v2 {
-				return 0
-			}
-			if v1 < v2 {
-				return -1
-			}
-			return 1
-		}
-
-	case int:
-		if v2, ok := b.(int); ok {
-			if v1 == v2 {
-				return 0
-			}
-			if v1 < v2 {
-				return -1
-			}
-			return 1
-		}
+// numProperties returns the number of properties
+func (p *properties) numProperties() int {
+	return len(p.load())
+}
 
-	case []string:
-		if v2, ok := b.([]string); ok {
-			l1 := len(v1)
-			l2 := len(v2)
-			for i := 0; i < l1 && i < l2; i++ {
-				if v1[i] < v2[i] {
-					return -1
-				}
-				if v1[i] > v2[i] {
-					return 1
-				}
-			}
-			if l1 < l2 {
-				return -1
-			}
-			if l1 > l2 {
-				return 1
-			}
-			return 0
-		}
-		if v2, ok := b.([]interface{}); ok {
-			l1 := len(v1)
-			l2 := len(v2)
-			for i := 0; i < l1 && i < l2; i++ {
-				switch ComparePropertyValue(v1[i], v2[i]) {
-				case -1:
-					return -1
-				case 1:
-					return 1
-				}
-			}
-			if l1 < l2 {
-				return -1
-			}
-			if l1 > l2 {
-				return 1
-			}
-			return 0
-		}
+// set sets a property value, copying the properties first if they
+// are shared with a snapshot. Returns the old value.
+func (p *properties) set(key string, value interface{}) (interface{}, bool) {
+	p.load()
+	p.unshare()
+	if p.m == nil {
+		p.m = make(map[string]any)
+	}
+	oldValue, exists := p.m[key]
+	p.m[key] = value
+	p.modified()
+	return oldValue, exists
+}
 
-	case []int:
-		if v2, ok := b.([]int); ok {
-			l1 := len(v1)
-			l2 := len(v2)
-			for i := 0; i < l1 && i < l2; i++ {
-				if v1[i] < v2[i] {
-					return -1
-				}
-				if v1[i] > v2[i] {
-					return 1
-				}
-			}
-			if l1 < l2 {
-				return -1
-			}
-			if l1 > l2 {
-				return 1
-			}
-			return 0
-		}
-		if v2, ok := b.([]interface{}); ok {
-			l1 := len(v1)
-			l2 := len(v2)
-			for i := 0; i < l1 && i < l2; i++ {
-				switch ComparePropertyValue(v1[i], v2[i]) {
-				case -1:
-					return -1
-				case 1:
-					return 1
-				}
-			}
-			if l1 < l2 {
-				return -1
-			}
-			if l1 > l2 {
-				return 1
-			}
-			return 0
-		}
+// remove removes a property, copying the properties first if they are
+// shared with a snapshot. Returns the removed value.
+func (p *properties) remove(key string) (interface{}, bool) {
+	value, exists := p.load()[key]
+	if !exists {
+		return nil, false
+	}
+	p.unshare()
+	delete(p.m, key)
+	p.modified()
+	return value, true
+}
 
-	case []interface{}:
-		if v2, ok := b.([]interface{}); ok {
-			l1 := len(v1)
-			l2 := len(v2)
-			for i := 0; i < l1 && i < l2; i++ {
-				switch ComparePropertyValue(v1[i], v2[i]) {
-				case -1:
-					return -1
-				case 1:
-					return 1
-				}
-			}
-			if l1 < l2 {
-				return -1
-			}
-			if l1 > l2 {
-				return 1
-			}
-			return 0
-		}
-		if v2, ok := b.([]string); ok {
-			return -ComparePropertyValue(v2, v1)
-		}
-		if v2, ok := b.([]int); ok {
-			return -ComparePropertyValue(v2, v1)
-		}
+// modified records that the properties are changed, so they are
+// written to disk when they are paged out
+func (p *properties) modified() {
+	if p.page != nil {
+		p.page.pager.modified(p)
 	}
-	panic(fmt.Sprintf("Incomparable values: %v (%T) vs %v (%T)", a, a, b, b))
 }
 
-func (p properties) String() string {
-	elements := make([]string, 0, len(p))
-	for k, v := range p {
+// WithNativeValue is used to return a native value for property
+// values. If the property value implements this interface, the
+// underlying native value for indexing and comparison is obtained
+// from this interface.
+type WithNativeValue interface {
+	GetNativeValue() interface{}
+}
+
+func (p *properties) String() string {
+	m := p.load()
+	elements := make([]string, 0, len(m))
+	for k, v := range m {
 		if _, node := v.(*Node); node {
 			continue
 		}
@@ -223,9 +134,13 @@ func (p properties) String() string {
 }
 
 // lookup proprs from source. allocate to target
-func (p properties) clone(sourceGraph, targetGraph *Graph, cloneProperty func(string, interface{}) interface{}) properties {
-	ret := make(properties, len(p))
-	for k, v := range p {
+func (p *properties) clone(sourceGraph, targetGraph *Graph, cloneProperty func(string, interface{}) interface{}) map[string]any {
+	m := p.load()
+	if m == nil {
+		return nil
+	}
+	ret := make(map[string]any, len(m))
+	for k, v := range m {
 		ret[k] = cloneProperty(k, v)
 	}
 	return ret
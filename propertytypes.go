@@ -0,0 +1,255 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// PropertyType is the type of a property value
+type PropertyType int
+
+const (
+	AnyPropertyType PropertyType = iota
+	StringPropertyType
+	IntPropertyType
+	Int64PropertyType
+	FloatPropertyType
+	BoolPropertyType
+	TimePropertyType
+	ListPropertyType
+	MapPropertyType
+	PointPropertyType
+	DatePropertyType
+	DurationPropertyType
+)
+
+var propertyTypeNames = map[PropertyType]string{
+	AnyPropertyType:    "any",
+	StringPropertyType: "string",
+	IntPropertyType:    "int",
+	Int64PropertyType:  "int64",
+	FloatPropertyType:  "float",
+	BoolPropertyType:   "bool",
+	TimePropertyType:   "time",
+	ListPropertyType:   "list",
+	MapPropertyType:    "map",
+	PointPropertyType:  "point",
+
+	DatePropertyType:     "date",
+	DurationPropertyType: "duration",
+}
+
+func (t PropertyType) String() string {
+	if s, ok := propertyTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("PropertyType(%d)", int(t))
+}
+
+// ParsePropertyType returns the property type from its name
+func ParsePropertyType(s string) (PropertyType, error) {
+	for k, v := range propertyTypeNames {
+		if v == s {
+			return k, nil
+		}
+	}
+	return AnyPropertyType, fmt.Errorf("Unknown property type: %s", s)
+}
+
+func (t PropertyType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *PropertyType) UnmarshalText(in []byte) error {
+	v, err := ParsePropertyType(string(in))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// ErrPropertyType is returned when a property value does not match
+// the declared property type
+type ErrPropertyType struct {
+	Key      string
+	Expected PropertyType
+	Value    interface{}
+}
+
+func (e ErrPropertyType) Error() string {
+	return fmt.Sprintf("Property %s: expecting %s, got %v (%T)", e.Key, e.Expected, e.Value, e.Value)
+}
+
+// TypeOfPropertyValue returns the property type of the value. Returns
+// AnyPropertyType for nil and for values of unrecognized types.
+func TypeOfPropertyValue(value interface{}) PropertyType {
+	if n, ok := value.(WithNativeValue); ok {
+		value = n.GetNativeValue()
+	}
+	switch value.(type) {
+	case nil:
+		return AnyPropertyType
+	case string:
+		return StringPropertyType
+	case int, int8, int16, int32:
+		return IntPropertyType
+	case int64, uint, uint8, uint16, uint32, uint64:
+		return Int64PropertyType
+	case float32, float64:
+		return FloatPropertyType
+	case bool:
+		return BoolPropertyType
+	case time.Time:
+		return TimePropertyType
+	case Point:
+		return PointPropertyType
+	case Date:
+		return DatePropertyType
+	case Duration:
+		return DurationPropertyType
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array:
+		return ListPropertyType
+	case reflect.Map:
+		return MapPropertyType
+	}
+	return AnyPropertyType
+}
+
+// Coerce converts value to the property type if this can be done
+// without loss. Numeric values are converted to int, int64, or float
+// if they fit, so integers above 2^53 that cannot be represented
+// exactly are not floats. Strings are parsed as RFC3339 time values
+// for TimePropertyType. Returns false if the value cannot be
+// converted.
+func (t PropertyType) Coerce(value interface{}) (interface{}, bool) {
+	if n, ok := value.(WithNativeValue); ok {
+		value = n.GetNativeValue()
+	}
+	if t == AnyPropertyType {
+		return value, true
+	}
+	switch t {
+	case StringPropertyType:
+		s, ok := value.(string)
+		return s, ok
+	case BoolPropertyType:
+		b, ok := value.(bool)
+		return b, ok
+	case IntPropertyType, Int64PropertyType:
+		var i int64
+		switch v := value.(type) {
+		case int, int8, int16, int32, int64:
+			i = reflect.ValueOf(v).Int()
+		case uint, uint8, uint16, uint32, uint64:
+			u := reflect.ValueOf(v).Uint()
+			if u > math.MaxInt64 {
+				return nil, false
+			}
+			i = int64(u)
+		case float32, float64:
+			f := reflect.ValueOf(v).Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, false
+			}
+			i = int64(f)
+		default:
+			return nil, false
+		}
+		if t == Int64PropertyType {
+			return i, true
+		}
+		if int64(int(i)) != i {
+			return nil, false
+		}
+		return int(i), true
+	case FloatPropertyType:
+		switch v := value.(type) {
+		case float32, float64:
+			return reflect.ValueOf(v).Float(), true
+		case int, int8, int16, int32, int64:
+			i := reflect.ValueOf(v).Int()
+			// float64(math.MaxInt64) rounds up to 2^63, which is out of range
+			f := float64(i)
+			if f >= math.MaxInt64 || int64(f) != i {
+				return nil, false
+			}
+			return f, true
+		case uint, uint8, uint16, uint32, uint64:
+			u := reflect.ValueOf(v).Uint()
+			f := float64(u)
+			if f >= math.MaxUint64 || uint64(f) != u {
+				return nil, false
+			}
+			return f, true
+		}
+		return nil, false
+	case TimePropertyType:
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			tm, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, false
+			}
+			return tm, true
+		}
+		return nil, false
+	case ListPropertyType:
+		k := reflect.ValueOf(value).Kind()
+		return value, k == reflect.Slice || k == reflect.Array
+	case MapPropertyType:
+		return value, reflect.ValueOf(value).Kind() == reflect.Map
+	case PointPropertyType:
+		p, ok := toPoint(value)
+		return p, ok
+	case DatePropertyType:
+		switch v := value.(type) {
+		case Date:
+			return v, true
+		case time.Time:
+			return DateOf(v), true
+		case string:
+			d, err := ParseDate(v)
+			if err != nil {
+				return nil, false
+			}
+			return d, true
+		}
+		return nil, false
+	case DurationPropertyType:
+		switch v := value.(type) {
+		case Duration:
+			return v, true
+		case time.Duration:
+			return DurationOf(v), true
+		case string:
+			d, err := ParseDuration(v)
+			if err != nil {
+				return nil, false
+			}
+			return d, true
+		}
+		return nil, false
+	}
+	return nil, false
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// PropertyValue is a property value with a type. The value is kept
+// as the Go type of its property type: string, int, int64, float64,
+// bool, time.Time, Date, Duration, []interface{},
+// map[string]interface{}, or Point.
+//
+// PropertyValue implements WithNativeValue, so it is compared,
+// indexed, and marshaled the same way as its native value.
+type PropertyValue struct {
+	typ   PropertyType
+	value interface{}
+}
+
+// NewPropertyValue returns a property value of the given type. The
+// value is coerced to the type using PropertyType.Coerce. Lists and
+// maps are converted to []interface{} and map[string]interface{}.
+// Returns ErrPropertyType if the value cannot be coerced.
+func NewPropertyValue(t PropertyType, value interface{}) (PropertyValue, error) {
+	value = nativeValue(value)
+	var v interface{}
+	var ok bool
+	switch t {
+	case AnyPropertyType:
+		v, ok = value, true
+	case ListPropertyType:
+		v, ok = toList(value)
+	case MapPropertyType:
+		v, ok = toMap(value)
+	default:
+		v, ok = t.Coerce(value)
+	}
+	if !ok {
+		return PropertyValue{}, ErrPropertyType{Expected: t, Value: value}
+	}
+	return PropertyValue{typ: t, value: v}, nil
+}
+
+// PropertyValueOf returns a property value for the value, with the
+// type given by TypeOfPropertyValue
+func PropertyValueOf(value interface{}) PropertyValue {
+	if pv, ok := value.(PropertyValue); ok {
+		return pv
+	}
+	ret, err := NewPropertyValue(TypeOfPropertyValue(value), value)
+	if err != nil {
+		return PropertyValue{typ: AnyPropertyType, value: nativeValue(value)}
+	}
+	return ret
+}
+
+func StringValue(s string) PropertyValue {
+	return PropertyValue{typ: StringPropertyType, value: s}
+}
+
+func IntValue(i int) PropertyValue {
+	return PropertyValue{typ: IntPropertyType, value: i}
+}
+
+func Int64Value(i int64) PropertyValue {
+	return PropertyValue{typ: Int64PropertyType, value: i}
+}
+
+func FloatValue(f float64) PropertyValue {
+	return PropertyValue{typ: FloatPropertyType, value: f}
+}
+
+func BoolValue(b bool) PropertyValue {
+	return PropertyValue{typ: BoolPropertyType, value: b}
+}
+
+func TimeValue(t time.Time) PropertyValue {
+	return PropertyValue{typ: TimePropertyType, value: t}
+}
+
+func DateValue(d Date) PropertyValue {
+	return PropertyValue{typ: DatePropertyType, value: d}
+}
+
+func DurationValue(d Duration) PropertyValue {
+	return PropertyValue{typ: DurationPropertyType, value: d}
+}
+
+func ListValue(values ...interface{}) PropertyValue {
+	return PropertyValue{typ: ListPropertyType, value: values}
+}
+
+func MapValue(m map[string]interface{}) PropertyValue {
+	return PropertyValue{typ: MapPropertyType, value: m}
+}
+
+// Type returns the type of the value
+func (v PropertyValue) Type() PropertyType { return v.typ }
+
+// GetNativeValue returns the Go value
+func (v PropertyValue) GetNativeValue() interface{} { return v.value }
+
+func (v PropertyValue) String() string { return fmt.Sprint(v.value) }
+
+// MarshalJSON marshals the native value
+func (v PropertyValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.value)
+}
+
+// nativeValue returns the native value if value implements
+// WithNativeValue
+func nativeValue(value interface{}) interface{} {
+	if n, ok := value.(WithNativeValue); ok {
+		return n.GetNativeValue()
+	}
+	return value
+}
+
+// toList returns the slice or array as []interface{}
+func toList(value interface{}) ([]interface{}, bool) {
+	if l, ok := value.([]interface{}); ok {
+		return l, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	ret := make([]interface{}, rv.Len())
+	for i := range ret {
+		ret[i] = rv.Index(i).Interface()
+	}
+	return ret, true
+}
+
+// toMap returns the map with string keys as map[string]interface{}
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	ret := make(map[string]interface{}, rv.Len())
+	for itr := rv.MapRange(); itr.Next(); {
+		ret[itr.Key().String()] = itr.Value().Interface()
+	}
+	return ret, true
+}
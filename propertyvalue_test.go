@@ -0,0 +1,151 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTypedPropertyAccessors(t *testing.T) {
+	g := NewGraph()
+	tm := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	node := g.NewNode(nil, map[string]interface{}{
+		"s":     "str",
+		"i":     int64(3),
+		"f":     3.0,
+		"frac":  3.5,
+		"b":     true,
+		"t":     tm,
+		"ts":    "2021-01-02T03:04:05Z",
+		"ints":  []int{1, 2},
+		"m":     map[string]int{"a": 1},
+		"typed": IntValue(5),
+		"big":   int64(1<<53 + 1),
+		"exact": int64(1 << 53),
+	})
+	if v, ok := node.GetStringProperty("s"); !ok || v != "str" {
+		t.Errorf("Wrong string: %v", v)
+	}
+	if _, ok := node.GetStringProperty("i"); ok {
+		t.Errorf("Int coerced to string")
+	}
+	if v, ok := node.GetIntProperty("i"); !ok || v != 3 {
+		t.Errorf("Wrong int: %v", v)
+	}
+	if v, ok := node.GetIntProperty("f"); !ok || v != 3 {
+		t.Errorf("Wrong int from float: %v", v)
+	}
+	if _, err := node.GetIntPropertyE("frac"); err == nil {
+		t.Errorf("Fraction coerced to int")
+	} else if e, ok := err.(ErrPropertyType); !ok || e.Key != "frac" || e.Expected != IntPropertyType {
+		t.Errorf("Wrong error: %v", err)
+	}
+	if _, err := node.GetIntPropertyE("missing"); err != (ErrPropertyNotFound{Key: "missing"}) {
+		t.Errorf("Wrong error: %v", err)
+	}
+	if v, ok := node.GetFloatProperty("i"); !ok || v != 3 {
+		t.Errorf("Wrong float: %v", v)
+	}
+	if _, ok := node.GetFloatProperty("big"); ok {
+		t.Errorf("Inexact int coerced to float")
+	}
+	if v, ok := node.GetFloatProperty("exact"); !ok || v != 1<<53 {
+		t.Errorf("Wrong float: %v", v)
+	}
+	if v, ok := node.GetBoolProperty("b"); !ok || !v {
+		t.Errorf("Wrong bool: %v", v)
+	}
+	if v, ok := node.GetTimeProperty("t"); !ok || !v.Equal(tm) {
+		t.Errorf("Wrong time: %v", v)
+	}
+	if v, ok := node.GetTimeProperty("ts"); !ok || !v.Equal(tm) {
+		t.Errorf("Wrong time from string: %v", v)
+	}
+	if v, ok := node.GetListProperty("ints"); !ok || !reflect.DeepEqual(v, []interface{}{1, 2}) {
+		t.Errorf("Wrong list: %v", v)
+	}
+	if v, ok := node.GetMapProperty("m"); !ok || !reflect.DeepEqual(v, map[string]interface{}{"a": 1}) {
+		t.Errorf("Wrong map: %v", v)
+	}
+	if v, ok := node.GetInt64Property("typed"); !ok || v != 5 {
+		t.Errorf("Wrong value from PropertyValue: %v", v)
+	}
+
+	edge := g.NewEdge(node, node, "e", map[string]interface{}{"w": 2})
+	if v, err := edge.GetFloatPropertyE("w"); err != nil || v != 2 {
+		t.Errorf("Wrong edge float: %v %v", v, err)
+	}
+}
+
+func TestPropertyValue(t *testing.T) {
+	if _, err := NewPropertyValue(IntPropertyType, "x"); err == nil {
+		t.Errorf("Expecting error")
+	}
+	v, err := NewPropertyValue(ListPropertyType, []string{"a", "b"})
+	if err != nil || !reflect.DeepEqual(v.GetNativeValue(), []interface{}{"a", "b"}) {
+		t.Errorf("Wrong list: %v %v", v, err)
+	}
+	if v := PropertyValueOf(int32(1)); v.Type() != IntPropertyType || v.GetNativeValue() != 1 {
+		t.Errorf("Wrong value: %v %v", v.Type(), v)
+	}
+	if ComparePropertyValue(IntValue(1), 1.0) != 0 || ComparePropertyValue(StringValue("a"), "b") >= 0 {
+		t.Errorf("Wrong comparison")
+	}
+
+	// Typed and native values are indexed the same way
+	g := NewGraph()
+	g.AddNodePropertyIndex("h", HashIndex)
+	g.AddNodePropertyIndex("b", BtreeIndex)
+	g.AddNodePropertyIndex("text", FullTextIndex)
+	g.NewNode(nil, map[string]interface{}{"h": IntValue(1), "b": FloatValue(2), "text": StringValue("typed value")})
+	g.NewNode(nil, map[string]interface{}{"h": 1, "b": 2, "text": "native value"})
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"h": int64(1)}))); n != 2 {
+		t.Errorf("Expecting 2 from hash index, got %d", n)
+	}
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"b": Int64Value(2)}))); n != 2 {
+		t.Errorf("Expecting 2 from btree index, got %d", n)
+	}
+	if itr, err := g.SearchNodes("text", "value"); err != nil || itr.MaxSize() != 2 {
+		t.Errorf("Expecting 2 from full-text index, got %v", err)
+	}
+
+	// JSON round trip
+	buf := bytes.Buffer{}
+	if err := (JSON{PreserveTypes: true}).Encode(g, &buf); err != nil {
+		t.Fatal(err)
+	}
+	newg := NewGraph()
+	if err := (JSON{PreserveTypes: true, TypedValues: true}).Decode(newg, json.NewDecoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	for nodes := newg.GetNodes(); nodes.Next(); {
+		h, _ := nodes.Node().GetProperty("h")
+		b, _ := nodes.Node().GetProperty("b")
+		if h.(PropertyValue).Type() != IntPropertyType {
+			t.Errorf("Wrong type for h: %v", h)
+		}
+		if typ := b.(PropertyValue).Type(); typ != FloatPropertyType && typ != IntPropertyType {
+			t.Errorf("Wrong type for b: %v", b)
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"v": ListValue(1, "a")})
+	if string(data) != `{"v":[1,"a"]}` {
+		t.Errorf("Wrong JSON: %s", data)
+	}
+}
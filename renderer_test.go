@@ -0,0 +1,107 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func getRendererTestGraph() *Graph {
+	g := NewGraph()
+	n1 := g.NewNode([]string{"Person"}, map[string]interface{}{"name": `John "J" <Doe>`})
+	n2 := g.NewNode([]string{"Company"}, map[string]interface{}{"name": "Acme & Co"})
+	n3 := g.NewNode(nil, nil)
+	g.NewEdge(n1, n2, "WORKS_AT", map[string]interface{}{"name": "x"})
+	g.NewEdge(n2, n3, "", nil)
+	return g
+}
+
+func TestMermaidRenderer(t *testing.T) {
+	g := getRendererTestGraph()
+	buf := bytes.Buffer{}
+	if err := (MermaidRenderer{Properties: []string{"name"}}).Render(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	out := buf.String()
+	for _, s := range []string{"flowchart LR", `n0[":Person<br/>name: John #quot;J#quot; #lt;Doe#gt;"]`, `n0 -->|"WORKS_AT<br/>name: x"| n1`, "n1 --> n2"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Missing %s in %s", s, out)
+		}
+	}
+
+	buf = bytes.Buffer{}
+	if err := (MermaidRenderer{MaxNodes: 2, MaxEdges: 1}).Render(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if strings.Contains(buf.String(), "n2") || !strings.Contains(buf.String(), "1 nodes and 0 edges omitted") {
+		t.Errorf("Wrong output: %s", buf.String())
+	}
+}
+
+func TestPlantUMLRenderer(t *testing.T) {
+	g := getRendererTestGraph()
+	buf := bytes.Buffer{}
+	if err := (PlantUMLRenderer{Properties: []string{"name"}}).Render(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	out := buf.String()
+	for _, s := range []string{"@startuml", `object ":Person" as n0 {`, "name = John 'J' <Doe>", "n0 --> n1 : WORKS_AT\\nname: x", "@enduml"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Missing %s in %s", s, out)
+		}
+	}
+}
+
+func TestGEXFRenderer(t *testing.T) {
+	g := getRendererTestGraph()
+	buf := bytes.Buffer{}
+	if err := (GEXFRenderer{Properties: []string{"name"}, MaxEdges: 1}).Render(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID        string `xml:"id,attr"`
+				Label     string `xml:"label,attr"`
+				AttValues []struct {
+					For   string `xml:"for,attr"`
+					Value string `xml:"value,attr"`
+				} `xml:"attvalues>attvalue"`
+			} `xml:"nodes>node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edges>edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Errorf("Invalid XML: %v %s", err, buf.String())
+		return
+	}
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 1 {
+		t.Errorf("Wrong output: %s", buf.String())
+		return
+	}
+	if doc.Graph.Nodes[0].Label != ":Person" || doc.Graph.Nodes[0].AttValues[0].Value != `John "J" <Doe>` {
+		t.Errorf("Wrong node: %+v", doc.Graph.Nodes[0])
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphSchema is the implicit schema of a graph, inferred using
+// InferSchema. It can be marshaled as JSON, and used to validate other
+// graphs.
+type GraphSchema struct {
+	Nodes []*NodeSchema `json:"nodes,omitempty"`
+	Edges []*EdgeSchema `json:"edges,omitempty"`
+}
+
+// NodeSchema describes the nodes with the same label combination
+type NodeSchema struct {
+	Labels     []string                   `json:"labels"`
+	Count      int                        `json:"count"`
+	Properties map[string]*PropertySchema `json:"properties,omitempty"`
+}
+
+// PropertySchema describes a property of the nodes or edges of a
+// schema
+type PropertySchema struct {
+	// Count is the number of nodes or edges with a non-nil value for
+	// the property
+	Count int `json:"count"`
+	// NullRate is the fraction of the nodes or edges that do not have
+	// the property, or have a nil value for it
+	NullRate float64 `json:"nullRate"`
+	// Types gives the number of values of each type
+	Types map[PropertyType]int `json:"types,omitempty"`
+}
+
+// EdgeSchema describes the edges with the same label, between nodes
+// with the same label combinations: (:FromLabels)-[:Label]->(:ToLabels)
+type EdgeSchema struct {
+	FromLabels []string                   `json:"fromLabels"`
+	Label      string                     `json:"label"`
+	ToLabels   []string                   `json:"toLabels"`
+	Count      int                        `json:"count"`
+	Properties map[string]*PropertySchema `json:"properties,omitempty"`
+	// MaxOut is the maximum number of these edges from a node
+	MaxOut int `json:"maxOut"`
+	// MaxIn is the maximum number of these edges to a node
+	MaxIn int `json:"maxIn"`
+}
+
+// Cardinality returns the cardinality of the edge pattern as one of
+// 1:1, 1:N, N:1, N:M
+func (e *EdgeSchema) Cardinality() string {
+	left, right := "1", "1"
+	if e.MaxIn > 1 {
+		left = "N"
+	}
+	if e.MaxOut > 1 {
+		right = "N"
+		if left == "N" {
+			right = "M"
+		}
+	}
+	return left + ":" + right
+}
+
+// String returns the edge pattern as (:A)-[:R]->(:B)
+func (e *EdgeSchema) String() string {
+	return fmt.Sprintf("(%s)-[:%s]->(%s)", displayLabels(NewStringSet(e.FromLabels...)), e.Label, displayLabels(NewStringSet(e.ToLabels...)))
+}
+
+func schemaLabelsKey(labels []string) string {
+	return strings.Join(labels, "\x00")
+}
+
+func edgeSchemaKey(from []string, label string, to []string) string {
+	return schemaLabelsKey(from) + "\x01" + label + "\x01" + schemaLabelsKey(to)
+}
+
+// propertyStats collects property statistics
+type propertyStats map[string]*PropertySchema
+
+func (p propertyStats) add(obj WithProperties, keys []string) {
+	for _, k := range keys {
+		v, _ := obj.GetProperty(k)
+		ps := p[k]
+		if ps == nil {
+			ps = &PropertySchema{Types: make(map[PropertyType]int)}
+			p[k] = ps
+		}
+		if v != nil {
+			ps.Count++
+			ps.Types[TypeOfPropertyValue(v)]++
+		}
+	}
+}
+
+func (p propertyStats) finish(total int) map[string]*PropertySchema {
+	if len(p) == 0 {
+		return nil
+	}
+	for _, ps := range p {
+		ps.NullRate = float64(total-ps.Count) / float64(total)
+	}
+	return p
+}
+
+// InferSchema returns the schema of the graph. The schema contains
+// the node label combinations and the edge patterns of the graph, the
+// property keys with the observed types and null rates, and the edge
+// cardinalities.
+func InferSchema(g *Graph) *GraphSchema {
+	nodes := make(map[string]*NodeSchema)
+	nodeProps := make(map[string]propertyStats)
+	for itr := g.GetNodes(); itr.Next(); {
+		node := itr.Node()
+		labels := node.labels.SortedSlice()
+		key := schemaLabelsKey(labels)
+		ns := nodes[key]
+		if ns == nil {
+			ns = &NodeSchema{Labels: labels}
+			nodes[key] = ns
+			nodeProps[key] = make(propertyStats)
+		}
+		ns.Count++
+		nodeProps[key].add(node, node.propertyKeys())
+	}
+
+	edges := make(map[string]*EdgeSchema)
+	edgeProps := make(map[string]propertyStats)
+	outCounts := make(map[string]map[*Node]int)
+	inCounts := make(map[string]map[*Node]int)
+	for itr := g.GetEdges(); itr.Next(); {
+		edge := itr.Edge()
+		from := edge.from.labels.SortedSlice()
+		to := edge.to.labels.SortedSlice()
+		key := edgeSchemaKey(from, edge.label, to)
+		es := edges[key]
+		if es == nil {
+			es = &EdgeSchema{FromLabels: from, Label: edge.label, ToLabels: to}
+			edges[key] = es
+			edgeProps[key] = make(propertyStats)
+			outCounts[key] = make(map[*Node]int)
+			inCounts[key] = make(map[*Node]int)
+		}
+		es.Count++
+		edgeProps[key].add(edge, edge.propertyKeys())
+		outCounts[key][edge.from]++
+		inCounts[key][edge.to]++
+		if n := outCounts[key][edge.from]; n > es.MaxOut {
+			es.MaxOut = n
+		}
+		if n := inCounts[key][edge.to]; n > es.MaxIn {
+			es.MaxIn = n
+		}
+	}
+
+	ret := &GraphSchema{}
+	for key, ns := range nodes {
+		// The null rate of a key includes the nodes that do not have
+		// the key, because the count of a key is the number of non-nil
+		// values
+		ns.Properties = nodeProps[key].finish(ns.Count)
+		ret.Nodes = append(ret.Nodes, ns)
+	}
+	for key, es := range edges {
+		es.Properties = edgeProps[key].finish(es.Count)
+		ret.Edges = append(ret.Edges, es)
+	}
+	sort.Slice(ret.Nodes, func(i, j int) bool {
+		return schemaLabelsKey(ret.Nodes[i].Labels) < schemaLabelsKey(ret.Nodes[j].Labels)
+	})
+	sort.Slice(ret.Edges, func(i, j int) bool {
+		return edgeSchemaKey(ret.Edges[i].FromLabels, ret.Edges[i].Label, ret.Edges[i].ToLabels) <
+			edgeSchemaKey(ret.Edges[j].FromLabels, ret.Edges[j].Label, ret.Edges[j].ToLabels)
+	})
+	return ret
+}
+
+// SchemaViolationKind is the type of a schema violation
+type SchemaViolationKind string
+
+const (
+	// The node label combination is not in the schema
+	UnknownNodeLabels SchemaViolationKind = "unknownNodeLabels"
+	// The edge pattern is not in the schema
+	UnknownEdgePattern SchemaViolationKind = "unknownEdgePattern"
+	// The property is not in the schema
+	UnknownProperty SchemaViolationKind = "unknownProperty"
+	// The property value type is not in the schema
+	PropertyTypeMismatch SchemaViolationKind = "propertyType"
+	// The property is present in all nodes or edges of the schema, but
+	// not in this node or edge
+	MissingProperty SchemaViolationKind = "missingProperty"
+	// There are more edges from or to a node than the schema allows
+	CardinalityViolation SchemaViolationKind = "cardinality"
+)
+
+// SchemaViolation describes a node or edge that does not match the
+// schema
+type SchemaViolation struct {
+	Kind SchemaViolationKind `json:"kind"`
+	// NodeID is the ID of the node, or -1
+	NodeID int `json:"nodeId"`
+	// EdgeID is the ID of the edge, or -1
+	EdgeID   int    `json:"edgeId"`
+	Property string `json:"property,omitempty"`
+	Msg      string `json:"msg"`
+}
+
+func (v SchemaViolation) String() string {
+	if v.EdgeID != -1 {
+		return fmt.Sprintf("%s: edge %d: %s", v.Kind, v.EdgeID, v.Msg)
+	}
+	return fmt.Sprintf("%s: node %d: %s", v.Kind, v.NodeID, v.Msg)
+}
+
+// SchemaReport is the result of validating a graph against a schema
+type SchemaReport struct {
+	Violations []SchemaViolation `json:"violations,omitempty"`
+}
+
+// IsValid returns true if there are no violations
+func (r *SchemaReport) IsValid() bool { return len(r.Violations) == 0 }
+
+func validateSchemaProperties(obj WithProperties, keys []string, schema map[string]*PropertySchema, violation func(SchemaViolationKind, string, string)) {
+	for _, k := range keys {
+		ps, ok := schema[k]
+		if !ok {
+			violation(UnknownProperty, k, fmt.Sprintf("Unknown property %s", k))
+			continue
+		}
+		v, _ := obj.GetProperty(k)
+		if v == nil {
+			continue
+		}
+		if t := TypeOfPropertyValue(v); ps.Types[t] == 0 {
+			violation(PropertyTypeMismatch, k, fmt.Sprintf("Property %s has unexpected type %s", k, t))
+		}
+	}
+	for k, ps := range schema {
+		if ps.NullRate != 0 {
+			continue
+		}
+		if v, _ := obj.GetProperty(k); v == nil {
+			violation(MissingProperty, k, fmt.Sprintf("Property %s is missing", k))
+		}
+	}
+}
+
+// Validate checks the nodes and edges of g against the schema, and
+// returns the violations. A node or edge is valid if its label
+// combination or edge pattern is in the schema, its properties are in
+// the schema with one of the observed types, and it has the properties
+// that are never missing in the schema. Edge patterns whose MaxOut or
+// MaxIn is 1 must not have more than one edge from or to a node.
+//
+// The violations of nodes come before the violations of edges, and
+// they are sorted by ID, kind, and property.
+func (schema *GraphSchema) Validate(g *Graph) *SchemaReport {
+	report := &SchemaReport{}
+	nodes := make(map[string]*NodeSchema)
+	for _, ns := range schema.Nodes {
+		nodes[schemaLabelsKey(ns.Labels)] = ns
+	}
+	edges := make(map[string]*EdgeSchema)
+	for _, es := range schema.Edges {
+		edges[edgeSchemaKey(es.FromLabels, es.Label, es.ToLabels)] = es
+	}
+
+	for itr := g.GetNodes(); itr.Next(); {
+		node := itr.Node()
+		violation := func(kind SchemaViolationKind, property, msg string) {
+			report.Violations = append(report.Violations, SchemaViolation{Kind: kind, NodeID: node.id, EdgeID: -1, Property: property, Msg: msg})
+		}
+		ns, ok := nodes[schemaLabelsKey(node.labels.SortedSlice())]
+		if !ok {
+			violation(UnknownNodeLabels, "", fmt.Sprintf("Unknown labels %s", displayLabels(node.labels)))
+			continue
+		}
+		validateSchemaProperties(node, node.propertyKeys(), ns.Properties, violation)
+	}
+
+	outCounts := make(map[*EdgeSchema]map[*Node]int)
+	inCounts := make(map[*EdgeSchema]map[*Node]int)
+	for itr := g.GetEdges(); itr.Next(); {
+		edge := itr.Edge()
+		violation := func(kind SchemaViolationKind, property, msg string) {
+			report.Violations = append(report.Violations, SchemaViolation{Kind: kind, NodeID: -1, EdgeID: edge.id, Property: property, Msg: msg})
+		}
+		es, ok := edges[edgeSchemaKey(edge.from.labels.SortedSlice(), edge.label, edge.to.labels.SortedSlice())]
+		if !ok {
+			violation(UnknownEdgePattern, "", fmt.Sprintf("Unknown edge pattern (%s)-[:%s]->(%s)", displayLabels(edge.from.labels), edge.label, displayLabels(edge.to.labels)))
+			continue
+		}
+		validateSchemaProperties(edge, edge.propertyKeys(), es.Properties, violation)
+		if outCounts[es] == nil {
+			outCounts[es] = make(map[*Node]int)
+			inCounts[es] = make(map[*Node]int)
+		}
+		outCounts[es][edge.from]++
+		inCounts[es][edge.to]++
+		if es.MaxOut == 1 && outCounts[es][edge.from] == 2 {
+			violation(CardinalityViolation, "", fmt.Sprintf("Multiple %s edges from node %d", es, edge.from.id))
+		}
+		if es.MaxIn == 1 && inCounts[es][edge.to] == 2 {
+			violation(CardinalityViolation, "", fmt.Sprintf("Multiple %s edges to node %d", es, edge.to.id))
+		}
+	}
+	sort.SliceStable(report.Violations, func(i, j int) bool {
+		a, b := report.Violations[i], report.Violations[j]
+		if a.EdgeID != b.EdgeID {
+			return a.EdgeID < b.EdgeID
+		}
+		if a.NodeID != b.NodeID {
+			return a.NodeID < b.NodeID
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Property < b.Property
+	})
+	return report
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	g := NewGraph()
+	p1 := g.NewNode([]string{"Person"}, map[string]interface{}{"name": "a", "age": 1})
+	p2 := g.NewNode([]string{"Person"}, map[string]interface{}{"name": "b"})
+	c := g.NewNode([]string{"Company", "Org"}, map[string]interface{}{"name": "c"})
+	g.NewEdge(p1, c, "WORKS_AT", map[string]interface{}{"since": 2000})
+	g.NewEdge(p2, c, "WORKS_AT", map[string]interface{}{"since": 2001})
+	g.NewEdge(p1, p2, "KNOWS", nil)
+
+	schema := InferSchema(g)
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	schema = &GraphSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(schema.Nodes) != 2 || len(schema.Edges) != 2 {
+		t.Errorf("Wrong schema: %s", string(data))
+		return
+	}
+	person := schema.Nodes[1]
+	if person.Count != 2 || person.Properties["age"].NullRate != 0.5 || person.Properties["name"].Types[StringPropertyType] != 2 {
+		t.Errorf("Wrong person schema: %s", string(data))
+	}
+	worksAt := schema.Edges[1]
+	if worksAt.String() != "(:Person)-[:WORKS_AT]->(:Company:Org)" || worksAt.Cardinality() != "N:1" {
+		t.Errorf("Wrong edge schema: %s %s", worksAt, worksAt.Cardinality())
+	}
+
+	if report := schema.Validate(g); !report.IsValid() {
+		t.Errorf("Unexpected violations: %v", report.Violations)
+	}
+
+	g2 := NewGraph()
+	q1 := g2.NewNode([]string{"Person"}, map[string]interface{}{"name": 1, "email": "x"})
+	q2 := g2.NewNode([]string{"Person"}, nil)
+	q3 := g2.NewNode([]string{"Robot"}, nil)
+	g2.NewEdge(q1, q2, "KNOWS", nil)
+	g2.NewEdge(q1, q2, "KNOWS", nil)
+	g2.NewEdge(q1, q3, "KNOWS", nil)
+	report := schema.Validate(g2)
+	expected := map[SchemaViolationKind]int{
+		PropertyTypeMismatch: 1,
+		UnknownProperty:      1,
+		MissingProperty:      1,
+		UnknownNodeLabels:    1,
+		CardinalityViolation: 2,
+		UnknownEdgePattern:   1,
+	}
+	found := make(map[SchemaViolationKind]int)
+	for _, v := range report.Violations {
+		found[v.Kind]++
+	}
+	for k, v := range expected {
+		if found[k] != v {
+			t.Errorf("Expecting %d %s violations, got %v", v, k, report.Violations)
+		}
+	}
+}
+
+func TestSchemaViolationOrder(t *testing.T) {
+	g := NewGraph()
+	g.NewNode([]string{"a"}, map[string]interface{}{"p1": 1, "p2": 1, "p3": 1, "p4": 1})
+	schema := InferSchema(g)
+	g.NewNode([]string{"a"}, nil)
+	for i := 0; i < 10; i++ {
+		report := schema.Validate(g)
+		if len(report.Violations) != 4 {
+			t.Errorf("Wrong violations: %v", report.Violations)
+			return
+		}
+		for j, v := range report.Violations {
+			if v.Kind != MissingProperty || v.Property != fmt.Sprintf("p%d", j+1) {
+				t.Errorf("Wrong order: %v", report.Violations)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+// ErrReadOnlyGraph is the panic value when a read-only graph, such as
+// a snapshot, is modified
+type ErrReadOnlyGraph struct{}
+
+func (e ErrReadOnlyGraph) Error() string { return "Graph is read-only" }
+
+// checkWritable panics if the graph is read-only. It is called before
+// the graph is modified, so it also drops the shared snapshot.
+func (g *Graph) checkWritable() {
+	if g.readOnly {
+		panic(ErrReadOnlyGraph{})
+	}
+	g.snap = nil
+}
+
+// IsReadOnly returns true if the graph cannot be modified
+func (g *Graph) IsReadOnly() bool { return g.readOnly }
+
+// unshare copies the properties if they are shared with a snapshot,
+// so they can be modified. The properties must be loaded.
+func (p *properties) unshare() {
+	if !p.shared {
+		return
+	}
+	if p.m != nil {
+		newp := make(map[string]any, len(p.m))
+		for k, v := range p.m {
+			newp[k] = v
+		}
+		p.m = newp
+	}
+	p.shared = false
+}
+
+// Snapshot returns a read-only copy of the graph as of now. The
+// snapshot does not change when the graph is modified, and modifying
+// the snapshot panics with ErrReadOnlyGraph.
+//
+// Snapshots are copied on write: a snapshot is shared by all calls to
+// Snapshot until the graph is modified, so taking a snapshot of an
+// unchanged graph is O(1). The first snapshot after a change is
+// O(N+E), because the snapshot needs its own node and edge objects
+// with the same IDs as the nodes and edges of the graph, and its own
+// indexes. *Node and *Edge values belong to one graph, and the edges
+// of a node are linked in place, so they cannot be shared between the
+// graph and the snapshot. The labels and property maps are shared
+// until the graph modifies them. Property values are not copied, so
+// they should not be modified in place.
+//
+// If the graph has an active transaction, the snapshot includes the
+// uncommitted changes.
+func (g *Graph) Snapshot() *Graph {
+	if g.snap == nil {
+		g.snap = g.snapshot()
+	}
+	return g.snap
+}
+
+// snapshot returns a new read-only copy of the graph
+func (g *Graph) snapshot() *Graph {
+	ret := NewGraph()
+	nodeMap := make(map[*Node]*Node, g.NumNodes())
+	for nodes := g.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		newNode := &Node{
+			labels:     node.labels,
+			graph:      ret,
+			id:         node.id,
+			externalID: node.externalID,
+		}
+		newNode.properties = properties{m: node.properties.load(), shared: true}
+		node.properties.shared = true
+		nodeMap[node] = newNode
+		ret.allNodes.add(newNode)
+		ret.index.addNodeToIndex(newNode, ret)
+	}
+	for edges := g.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		newEdge := &Edge{
+			from:       nodeMap[edge.from],
+			to:         nodeMap[edge.to],
+			label:      edge.label,
+			id:         edge.id,
+			externalID: edge.externalID,
+		}
+		newEdge.properties = properties{m: edge.properties.load(), shared: true}
+		edge.properties.shared = true
+		ret.allEdges.add(newEdge, 0)
+		ret.connect(newEdge)
+		ret.index.addEdgeToIndex(newEdge, ret)
+	}
+	ret.idBase = g.idBase
+	g.index.copyIndexes(ret)
+	ret.readOnly = true
+	return ret
+}
+
+// copyIndexes adds the indexes of g to the target graph
+func (g *graphIndex) copyIndexes(target *Graph) {
+	for k, ix := range g.nodeProperties {
+		target.index.NodePropertyIndex(k, target, indexTypeOf(ix))
+	}
+	for k, ix := range g.edgeProperties {
+		target.index.EdgePropertyIndex(k, target, indexTypeOf(ix))
+	}
+	for _, c := range g.nodeComposites {
+		target.index.NodeCompositeIndex(c.keys, target, c.typ)
+	}
+	for _, c := range g.edgeComposites {
+		target.index.EdgeCompositeIndex(c.keys, target, c.typ)
+	}
+	for k, ix := range g.nodeLabelProperties {
+		target.index.NodeLabelPropertyIndex(k.label, k.property, target, indexTypeOf(ix))
+	}
+	for k, ix := range g.edgeLabelProperties {
+		target.index.EdgeLabelPropertyIndex(k.label, k.property, target, indexTypeOf(ix))
+	}
+	for k, ix := range g.nodeFullText {
+		target.index.NodeFullTextIndex(k, target, ix.options)
+	}
+	for k, ix := range g.edgeFullText {
+		target.index.EdgeFullTextIndex(k, target, ix.options)
+	}
+	for k, ix := range g.nodeVectors {
+		target.index.NodeVectorIndex(k, target, ix.options)
+	}
+	for k, ix := range g.nodeSpatial {
+		target.index.NodeSpatialIndex(k, target, ix.options)
+	}
+}
+
+func indexTypeOf(ix index) IndexType {
+	if _, ok := ix.(*hashIndex); ok {
+		return HashIndex
+	}
+	return BtreeIndex
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	g := getTxTestGraph()
+	before := encodeTxTestGraph(t, g)
+	snap := g.Snapshot()
+
+	nodes := NodeSlice(g.GetNodes())
+	nodes[0].SetProperty("key", "x")
+	nodes[1].SetLabels(NewStringSet("c"))
+	nodes[2].DetachAndRemove()
+	g.NewNode([]string{"a"}, map[string]interface{}{"key": "4"})
+
+	if after := encodeTxTestGraph(t, snap); after != before {
+		t.Errorf("Snapshot changed: %s %s", before, after)
+	}
+	if n := len(NodeSlice(snap.FindNodes(NewStringSet("a"), map[string]interface{}{"key": "1"}))); n != 1 {
+		t.Errorf("Wrong snapshot index: %d", n)
+	}
+	if n := len(NodeSlice(g.FindNodes(NewStringSet("a"), map[string]interface{}{"key": "1"}))); n != 0 {
+		t.Errorf("Wrong graph index: %d", n)
+	}
+	acc, err := Pattern{{Labels: NewStringSet("b")}, {Min: 1, Max: 1}, {}}.FindPaths(snap, map[string]*PatternSymbol{})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(acc.Paths) != 2 {
+		t.Errorf("Wrong pattern result on snapshot: %d", len(acc.Paths))
+	}
+
+	func() {
+		defer func() {
+			if _, ok := recover().(ErrReadOnlyGraph); !ok {
+				t.Errorf("Expecting read-only panic")
+			}
+		}()
+		snap.NewNode(nil, nil)
+	}()
+}
+
+func TestConcurrentSnapshot(t *testing.T) {
+	g := getTxTestGraph()
+	for nodes := g.GetNodes(); nodes.Next(); {
+		nodes.Node().SetProperty("key", -1)
+	}
+	cg := NewConcurrentGraph(g)
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cg.Write(func(g *Graph) error {
+				for nodes := g.GetNodes(); nodes.Next(); {
+					nodes.Node().SetProperty("key", i)
+				}
+				return nil
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			snap := cg.Snapshot()
+			var value interface{}
+			for nodes := snap.GetNodes(); nodes.Next(); {
+				v, _ := nodes.Node().GetProperty("key")
+				if value != nil && v != value {
+					t.Errorf("Inconsistent snapshot")
+				}
+				value = v
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSnapshotSharing(t *testing.T) {
+	g := getTxTestGraph()
+	snap := g.Snapshot()
+	if g.Snapshot() != snap {
+		t.Errorf("Snapshot of an unchanged graph is not shared")
+	}
+	nodes := NodeSlice(g.GetNodes())
+	nodes[0].SetProperty("key", "x")
+	snap2 := g.Snapshot()
+	if snap2 == snap {
+		t.Errorf("Snapshot shared after a change")
+	}
+	if v, _ := NodeSlice(snap.GetNodes())[0].GetProperty("key"); v == "x" {
+		t.Errorf("Snapshot changed")
+	}
+	// Rollback changes the graph
+	tx := g.Begin()
+	nodes[0].SetProperty("key", "y")
+	snap3 := g.Snapshot()
+	tx.Rollback()
+	if snap4 := g.Snapshot(); snap4 == snap3 {
+		t.Errorf("Snapshot shared after a rollback")
+	} else if v, _ := NodeSlice(snap4.GetNodes())[0].GetProperty("key"); v != "x" {
+		t.Errorf("Wrong snapshot after rollback: %v", v)
+	}
+
+	// Concurrent graph snapshots are shared until the next write
+	cg := NewConcurrentGraph(g)
+	csnap := cg.Snapshot()
+	if cg.Snapshot() != csnap {
+		t.Errorf("Concurrent snapshot is not shared")
+	}
+	for i := 0; i < 3; i++ {
+		if err := cg.Write(func(g *Graph) error {
+			g.NewNode(nil, nil)
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+	if csnap.NumNodes() != g.NumNodes()-3 {
+		t.Errorf("Concurrent snapshot changed: %d", csnap.NumNodes())
+	}
+	cg.Read(func(rg *Graph) error {
+		if rg == csnap || rg.NumNodes() != g.NumNodes() {
+			t.Errorf("Wrong replica")
+		}
+		return nil
+	})
+}
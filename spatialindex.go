@@ -0,0 +1,468 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// EarthRadius is the mean radius of the Earth in meters, used for
+// haversine distances
+const EarthRadius = 6371008.8
+
+// Point is a geographic location in degrees. Point values can be used
+// as property values, and indexed using a spatial index.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%g, %g)", p.Lat, p.Lon)
+}
+
+// toPoint returns the point for a property value. A point can be a
+// Point, or a map with numeric "lat" and "lon" values.
+func toPoint(value interface{}) (Point, bool) {
+	switch v := nativeValue(value).(type) {
+	case Point:
+		return v, true
+	case *Point:
+		if v != nil {
+			return *v, true
+		}
+	case map[string]interface{}:
+		lat, ok1 := FloatPropertyType.Coerce(v["lat"])
+		lon, ok2 := FloatPropertyType.Coerce(v["lon"])
+		if ok1 && ok2 && len(v) == 2 {
+			return Point{Lat: lat.(float64), Lon: lon.(float64)}, true
+		}
+	}
+	return Point{}, false
+}
+
+func comparePoints(a, b interface{}) (int, error) {
+	p1, p2 := a.(Point), b.(Point)
+	if c := cmpFloat(p1.Lat, p2.Lat); c != 0 {
+		return c, nil
+	}
+	return cmpFloat(p1.Lon, p2.Lon), nil
+}
+
+func init() {
+	RegisterPropertyComparator(Point{}, comparePoints)
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+
+// HaversineDistance returns the great-circle distance between two
+// points in meters
+func HaversineDistance(a, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLon := radians(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	if h > 1 {
+		h = 1
+	}
+	return 2 * EarthRadius * math.Asin(math.Sqrt(h))
+}
+
+// BoundingBox is a rectangle of latitudes and longitudes. If MinLon
+// is greater than MaxLon, the box crosses the antimeridian.
+type BoundingBox struct {
+	MinLat, MinLon float64
+	MaxLat, MaxLon float64
+}
+
+// Contains returns true if the point is in the box
+func (b BoundingBox) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+	}
+	return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+}
+
+// SpatialIndexOptions configures a spatial index
+type SpatialIndexOptions struct {
+	// CellSize is the size of the grid cells of the index in
+	// degrees. If 0, cells are 1 degree. Smaller cells are faster for
+	// dense data and small queries.
+	CellSize float64
+}
+
+type spatialCell struct {
+	lat, lon int
+}
+
+type spatialEntry struct {
+	id    int
+	item  interface{}
+	point Point
+	cell  spatialCell
+}
+
+// spatialIndex is a grid of cells of latitude and longitude
+type spatialIndex struct {
+	options SpatialIndexOptions
+	nLon    int
+	cells   map[spatialCell]map[int]*spatialEntry
+	entries map[int]*spatialEntry
+}
+
+func newSpatialIndex(options SpatialIndexOptions) *spatialIndex {
+	if options.CellSize <= 0 || options.CellSize > 180 {
+		options.CellSize = 1
+	}
+	return &spatialIndex{
+		options: options,
+		nLon:    int(math.Ceil(360 / options.CellSize)),
+		cells:   make(map[spatialCell]map[int]*spatialEntry),
+		entries: make(map[int]*spatialEntry),
+	}
+}
+
+// normalizeLon returns the longitude in [-180,180)
+func normalizeLon(lon float64) float64 {
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180
+}
+
+func (ix *spatialIndex) latCell(lat float64) int {
+	return int(math.Floor((lat + 90) / ix.options.CellSize))
+}
+
+func (ix *spatialIndex) lonCell(lon float64) int {
+	return int(math.Floor((normalizeLon(lon) + 180) / ix.options.CellSize))
+}
+
+// bounds returns the bounding box of the cell
+func (ix *spatialIndex) bounds(c spatialCell) BoundingBox {
+	s := ix.options.CellSize
+	return BoundingBox{
+		MinLat: float64(c.lat)*s - 90,
+		MaxLat: math.Min(float64(c.lat+1)*s-90, 90),
+		MinLon: float64(c.lon)*s - 180,
+		MaxLon: math.Min(float64(c.lon+1)*s-180, 180),
+	}
+}
+
+func (ix *spatialIndex) add(value interface{}, id int, item interface{}) {
+	p, ok := toPoint(value)
+	if !ok || math.IsNaN(p.Lat) || math.IsInf(p.Lon, 0) || math.IsNaN(p.Lon) || p.Lat < -90 || p.Lat > 90 {
+		return
+	}
+	p.Lon = normalizeLon(p.Lon)
+	entry := &spatialEntry{id: id, item: item, point: p, cell: spatialCell{lat: ix.latCell(p.Lat), lon: ix.lonCell(p.Lon)}}
+	ix.entries[id] = entry
+	m := ix.cells[entry.cell]
+	if m == nil {
+		m = make(map[int]*spatialEntry)
+		ix.cells[entry.cell] = m
+	}
+	m[id] = entry
+}
+
+func (ix *spatialIndex) remove(value interface{}, id int) {
+	entry, ok := ix.entries[id]
+	if !ok {
+		return
+	}
+	delete(ix.entries, id)
+	m := ix.cells[entry.cell]
+	delete(m, id)
+	if len(m) == 0 {
+		delete(ix.cells, entry.cell)
+	}
+}
+
+func (ix *spatialIndex) stats() IndexStats {
+	return IndexStats{
+		Entries:        len(ix.entries),
+		DistinctValues: len(ix.cells),
+		MemoryEstimate: len(ix.entries)*(2*mapEntryBytes+spatialEntryBytes) + len(ix.cells)*(mapEntryBytes+mapBytes),
+	}
+}
+
+// normalize returns the box with the longitudes in [-180,180]
+func (b BoundingBox) normalize() BoundingBox {
+	if b.MaxLon-b.MinLon >= 360 {
+		b.MinLon, b.MaxLon = -180, 180
+		return b
+	}
+	minLon, maxLon := normalizeLon(b.MinLon), normalizeLon(b.MaxLon)
+	if maxLon == -180 && b.MaxLon > b.MinLon {
+		maxLon = 180
+	}
+	b.MinLon, b.MaxLon = minLon, maxLon
+	return b
+}
+
+// lonRanges returns the longitude cell ranges of a normalized box
+func (ix *spatialIndex) lonRanges(box BoundingBox) [][2]int {
+	maxCell := ix.nLon - 1
+	if box.MaxLon < 180 {
+		maxCell = ix.lonCell(box.MaxLon)
+	}
+	if box.MinLon <= box.MaxLon {
+		return [][2]int{{ix.lonCell(box.MinLon), maxCell}}
+	}
+	return [][2]int{{ix.lonCell(box.MinLon), ix.nLon - 1}, {0, maxCell}}
+}
+
+// inBox returns the entries in the bounding box
+func (ix *spatialIndex) inBox(box BoundingBox) []*spatialEntry {
+	ret := make([]*spatialEntry, 0)
+	if box.MinLat > box.MaxLat {
+		return ret
+	}
+	box = box.normalize()
+	check := func(m map[int]*spatialEntry) {
+		for _, e := range m {
+			if box.Contains(e.point) {
+				ret = append(ret, e)
+			}
+		}
+	}
+	minLat, maxLat := ix.latCell(math.Max(box.MinLat, -90)), ix.latCell(math.Min(box.MaxLat, 90))
+	ranges := ix.lonRanges(box)
+	n := 0
+	for _, r := range ranges {
+		n += (r[1] - r[0] + 1) * (maxLat - minLat + 1)
+	}
+	if n > len(ix.cells) {
+		// Fewer occupied cells than the cells in the box
+		for c, m := range ix.cells {
+			if c.lat < minLat || c.lat > maxLat {
+				continue
+			}
+			for _, r := range ranges {
+				if c.lon >= r[0] && c.lon <= r[1] {
+					check(m)
+					break
+				}
+			}
+		}
+	} else {
+		for lat := minLat; lat <= maxLat; lat++ {
+			for _, r := range ranges {
+				for lon := r[0]; lon <= r[1]; lon++ {
+					check(ix.cells[spatialCell{lat: lat, lon: lon}])
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// meridianDistance returns the minimum distance from the point to the
+// meridian at lon between the latitudes minLat and maxLat
+func meridianDistance(p Point, lon, minLat, maxLat float64) float64 {
+	// The cosine of the angular distance from p to (lat, lon) is
+	// sin(p.Lat)sin(lat)+cos(p.Lat)cos(lat)cos(dLon) =
+	// A*cos(lat-lat0). It is maximized at lat0, or at one of the
+	// endpoints
+	phi := radians(p.Lat)
+	dLon := radians(lon - p.Lon)
+	lat0 := math.Atan2(math.Sin(phi), math.Cos(phi)*math.Cos(dLon))
+	cosDist := func(lat float64) float64 {
+		return math.Sin(phi)*math.Sin(lat) + math.Cos(phi)*math.Cos(lat)*math.Cos(dLon)
+	}
+	lo, hi := radians(minLat), radians(maxLat)
+	best := math.Max(cosDist(lo), cosDist(hi))
+	if lat0 >= lo && lat0 <= hi {
+		best = math.Max(best, cosDist(lat0))
+	}
+	if best > 1 {
+		best = 1
+	} else if best < -1 {
+		best = -1
+	}
+	return math.Acos(best) * EarthRadius
+}
+
+// minDistance returns the minimum distance from the point to the
+// cell. On a parallel, the distance increases with the longitude
+// difference, so if the point is not in the longitude range of the
+// cell, the nearest point is on the nearest meridian edge of the
+// cell.
+func (ix *spatialIndex) minDistance(p Point, c spatialCell) float64 {
+	b := ix.bounds(c)
+	if p.Lon >= b.MinLon && p.Lon <= b.MaxLon {
+		if p.Lat < b.MinLat {
+			return radians(b.MinLat-p.Lat) * EarthRadius
+		}
+		if p.Lat > b.MaxLat {
+			return radians(p.Lat-b.MaxLat) * EarthRadius
+		}
+		return 0
+	}
+	return math.Min(meridianDistance(p, b.MinLon, b.MinLat, b.MaxLat),
+		meridianDistance(p, b.MaxLon, b.MinLat, b.MaxLat))
+}
+
+type spatialResult struct {
+	entry    *spatialEntry
+	distance float64
+}
+
+// spatialHeap is a heap of results with the farthest at the top
+type spatialHeap []spatialResult
+
+func (h spatialHeap) Len() int            { return len(h) }
+func (h spatialHeap) Less(i, j int) bool  { return h[i].distance > h[j].distance }
+func (h spatialHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *spatialHeap) Push(x interface{}) { *h = append(*h, x.(spatialResult)) }
+func (h *spatialHeap) Pop() interface{} {
+	n := len(*h)
+	ret := (*h)[n-1]
+	*h = (*h)[:n-1]
+	return ret
+}
+
+// nearest returns the k nearest entries within maxDistance of the
+// point, ordered by distance. If k is negative, returns all the
+// entries within maxDistance.
+func (ix *spatialIndex) nearest(p Point, k int, maxDistance float64) []spatialResult {
+	p.Lon = normalizeLon(p.Lon)
+	type cellDistance struct {
+		cell     spatialCell
+		distance float64
+	}
+	cells := make([]cellDistance, 0, len(ix.cells))
+	for c := range ix.cells {
+		if d := ix.minDistance(p, c); d <= maxDistance {
+			cells = append(cells, cellDistance{cell: c, distance: d})
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].distance < cells[j].distance })
+	results := &spatialHeap{}
+	for _, c := range cells {
+		if k >= 0 && results.Len() == k && c.distance > (*results)[0].distance {
+			break
+		}
+		for _, e := range ix.cells[c.cell] {
+			d := HaversineDistance(p, e.point)
+			if d > maxDistance {
+				continue
+			}
+			if k < 0 || results.Len() < k {
+				heap.Push(results, spatialResult{entry: e, distance: d})
+			} else if d < (*results)[0].distance {
+				(*results)[0] = spatialResult{entry: e, distance: d}
+				heap.Fix(results, 0)
+			}
+		}
+	}
+	ret := []spatialResult(*results)
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].distance == ret[j].distance {
+			return ret[i].entry.id < ret[j].entry.id
+		}
+		return ret[i].distance < ret[j].distance
+	})
+	return ret
+}
+
+func spatialNodeIterator(results []spatialResult) NodeIterator {
+	items := make([]scoredItem, 0, len(results))
+	for _, r := range results {
+		items = append(items, scoredItem{id: r.entry.id, item: r.entry.item, score: r.distance})
+	}
+	return &scoredIterator{items: items, pos: -1}
+}
+
+// NodeSpatialIndex sets up a spatial index for the given node property
+func (g *graphIndex) NodeSpatialIndex(propertyName string, graph *Graph, options SpatialIndexOptions) {
+	if _, exists := g.nodeSpatial[propertyName]; exists {
+		return
+	}
+	ix := newSpatialIndex(options)
+	g.nodeSpatial[propertyName] = ix
+	for nodes := graph.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		if value, ok := node.properties.getProperty(propertyName); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+}
+
+func (g *graphIndex) getNodeSpatialIndex(propertyName string) (*spatialIndex, error) {
+	ix, ok := g.nodeSpatial[propertyName]
+	if !ok {
+		return nil, ErrIndexScan{Keys: []string{propertyName}, Msg: "No spatial index"}
+	}
+	return ix, nil
+}
+
+// AddNodeSpatialIndex adds a spatial index for the node property. The
+// property values are Point values, or maps with "lat" and "lon"
+// keys.
+func (g *Graph) AddNodeSpatialIndex(propertyName string, options SpatialIndexOptions) {
+	g.indexesChanged()
+	g.index.NodeSpatialIndex(propertyName, g, options)
+}
+
+// NodesInBoundingBox returns the nodes whose point in the property is
+// in the box. Returns ErrIndexScan if the property does not have a
+// spatial index.
+func (g *Graph) NodesInBoundingBox(propertyName string, box BoundingBox) (NodeIterator, error) {
+	ix, err := g.index.getNodeSpatialIndex(propertyName)
+	if err != nil {
+		return nil, err
+	}
+	entries := ix.inBox(box)
+	items := make([]scoredItem, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, scoredItem{id: e.id, item: e.item})
+	}
+	return newScoredIterator(items), nil
+}
+
+// NodesWithinDistance returns the nodes whose point in the property is
+// within the given haversine distance in meters from the center,
+// ordered by distance. Returns ErrIndexScan if the property does not
+// have a spatial index.
+func (g *Graph) NodesWithinDistance(propertyName string, center Point, meters float64) (NodeIterator, error) {
+	ix, err := g.index.getNodeSpatialIndex(propertyName)
+	if err != nil {
+		return nil, err
+	}
+	return spatialNodeIterator(ix.nearest(center, -1, meters)), nil
+}
+
+// NearestNodesToPoint returns the k nodes whose point in the property
+// is nearest to the given point, ordered by haversine
+// distance. Returns ErrIndexScan if the property does not have a
+// spatial index.
+func (g *Graph) NearestNodesToPoint(propertyName string, point Point, k int) (NodeIterator, error) {
+	ix, err := g.index.getNodeSpatialIndex(propertyName)
+	if err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		return spatialNodeIterator(nil), nil
+	}
+	return spatialNodeIterator(ix.nearest(point, k, math.Inf(1))), nil
+}
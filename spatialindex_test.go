@@ -0,0 +1,194 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHaversineDistance(t *testing.T) {
+	// Paris - London, about 344km
+	d := HaversineDistance(Point{Lat: 48.8566, Lon: 2.3522}, Point{Lat: 51.5074, Lon: -0.1278})
+	if math.Abs(d-343500) > 1000 {
+		t.Errorf("Wrong distance: %f", d)
+	}
+	if d := HaversineDistance(Point{Lat: 0, Lon: 179.5}, Point{Lat: 0, Lon: -179.5}); math.Abs(d-111195) > 10 {
+		t.Errorf("Wrong distance across antimeridian: %f", d)
+	}
+}
+
+func TestSpatialIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	g := NewGraph()
+	points := make(map[*Node]Point)
+	for i := 0; i < 2000; i++ {
+		p := Point{Lat: rnd.Float64()*180 - 90, Lon: rnd.Float64()*360 - 180}
+		if i%10 == 0 {
+			// Cluster around the antimeridian
+			p = Point{Lat: rnd.Float64()*4 - 2, Lon: normalizeLon(178 + rnd.Float64()*4)}
+		}
+		var value interface{} = p
+		if i%3 == 0 {
+			value = map[string]interface{}{"lat": p.Lat, "lon": p.Lon}
+		}
+		points[g.NewNode(nil, map[string]interface{}{"loc": value})] = p
+	}
+	g.AddNodeSpatialIndex("loc", SpatialIndexOptions{CellSize: 5})
+	moved := g.NewNode(nil, map[string]interface{}{"loc": Point{Lat: 10, Lon: 10}})
+	moved.SetProperty("loc", Point{Lat: 0.5, Lon: 179.9})
+	points[moved] = Point{Lat: 0.5, Lon: 179.9}
+
+	ids := func(itr NodeIterator) []int {
+		ret := make([]int, 0)
+		for itr.Next() {
+			ret = append(ret, itr.Node().GetID())
+		}
+		sort.Ints(ret)
+		return ret
+	}
+	equal := func(a, b []int) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, box := range []BoundingBox{
+		{MinLat: -10, MinLon: -10, MaxLat: 10, MaxLon: 10},
+		{MinLat: -1, MinLon: 179, MaxLat: 1, MaxLon: -179},
+		{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180},
+		{MinLat: 30, MinLon: 0, MaxLat: 60, MaxLon: 180},
+	} {
+		expected := make([]int, 0)
+		for n, p := range points {
+			if box.Contains(p) {
+				expected = append(expected, n.GetID())
+			}
+		}
+		sort.Ints(expected)
+		itr, err := g.NodesInBoundingBox("loc", box)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if result := ids(itr); !equal(result, expected) {
+			t.Errorf("%v: Expected %d nodes, got %d", box, len(expected), len(result))
+		}
+	}
+
+	for _, center := range []Point{{Lat: 0, Lon: 180}, {Lat: 89, Lon: 0}, {Lat: 45, Lon: 45}} {
+		expected := make([]int, 0)
+		for n, p := range points {
+			if HaversineDistance(center, p) <= 500000 {
+				expected = append(expected, n.GetID())
+			}
+		}
+		sort.Ints(expected)
+		itr, err := g.NodesWithinDistance("loc", center, 500000)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if result := ids(itr); !equal(result, expected) {
+			t.Errorf("%v: Expected %d nodes, got %d", center, len(expected), len(result))
+		}
+
+		nodes := make([]*Node, 0, len(points))
+		for n := range points {
+			nodes = append(nodes, n)
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			return HaversineDistance(center, points[nodes[i]]) < HaversineDistance(center, points[nodes[j]])
+		})
+		itr, err = g.NearestNodesToPoint("loc", center, 5)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		result := NodeSlice(itr)
+		if len(result) != 5 {
+			t.Errorf("Expecting 5 results, got %d", len(result))
+			continue
+		}
+		for i := range result {
+			if result[i] != nodes[i] {
+				t.Errorf("%v: Wrong nearest node at %d", center, i)
+			}
+		}
+	}
+
+	moved.RemoveProperty("loc")
+	if itr, _ := g.NodesWithinDistance("loc", Point{Lat: 0.5, Lon: 179.9}, 1); itr.MaxSize() != 0 {
+		t.Errorf("Index not updated")
+	}
+	if _, err := g.NodesInBoundingBox("x", BoundingBox{}); err == nil {
+		t.Errorf("Expecting error")
+	}
+}
+
+func TestPointValues(t *testing.T) {
+	p := Point{Lat: 1.5, Lon: -2}
+	data, err := EncodeTypedJSONValue(p)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	v, err := DecodeTypedJSONValue(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v != p {
+		t.Errorf("Wrong value: %v", v)
+	}
+	if TypeOfPropertyValue(p) != PointPropertyType {
+		t.Errorf("Wrong type")
+	}
+	if x, ok := PointPropertyType.Coerce(map[string]interface{}{"lat": 1.5, "lon": -2}); !ok || x != p {
+		t.Errorf("Coerce failed: %v", x)
+	}
+	if ComparePropertyValue(p, Point{Lat: 1.5, Lon: 0}) >= 0 {
+		t.Errorf("Wrong comparison")
+	}
+
+	g := NewGraph()
+	g.NewNode(nil, map[string]interface{}{"loc": p})
+	for _, codec := range []JSON{{PreserveTypes: true}, {PropertyTypes: map[string]PropertyType{"loc": PointPropertyType}}} {
+		var buf bytes.Buffer
+		if err := codec.Encode(g, &buf); err != nil {
+			t.Error(err)
+			return
+		}
+		g2 := NewGraph()
+		if err := codec.Decode(g2, json.NewDecoder(&buf)); err != nil {
+			t.Error(err)
+			return
+		}
+		nodes := NodeSlice(g2.GetNodes())
+		if v, _ := nodes[0].GetProperty("loc"); v != p {
+			t.Errorf("Wrong decoded value: %v %T", v, v)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is a calendar date without a time zone. Date values are
+// ordered after time.Time values and before Duration values.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// NewDate returns the date. The month and day are normalized as in
+// time.Date, so October 32 is November 1.
+func NewDate(year int, month time.Month, day int) Date {
+	return DateOf(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+// DateOf returns the date of t in the location of t
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+// ParseDate parses a date in the form 2006-01-02
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(t), nil
+}
+
+// Time returns the start of the date in the location
+func (d Date) Time(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// Add returns the date plus the duration. The months and the days of
+// the duration are added first, and then the whole days of the
+// remaining time.
+func (d Date) Add(dur Duration) Date {
+	return DateOf(dur.AddTo(d.Time(time.UTC)))
+}
+
+func (d Date) String() string {
+	return d.Time(time.UTC).Format("2006-01-02")
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Date) UnmarshalText(in []byte) error {
+	v, err := ParseDate(string(in))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+func compareDates(a, b Date) int {
+	if c := cmpInt(int64(a.Year), int64(b.Year)); c != 0 {
+		return c
+	}
+	if c := cmpInt(int64(a.Month), int64(b.Month)); c != 0 {
+		return c
+	}
+	return cmpInt(int64(a.Day), int64(b.Day))
+}
+
+// Duration is an amount of time in months, days, and nanoseconds, as
+// in openCypher and ISO 8601. Months and days are kept separately,
+// because their lengths vary.
+type Duration struct {
+	Months int64
+	Days   int64
+	Nanos  int64
+}
+
+// DurationOf returns the duration with the time.Duration as
+// nanoseconds
+func DurationOf(d time.Duration) Duration {
+	return Duration{Nanos: int64(d)}
+}
+
+// Average lengths used to order durations, as in openCypher
+const (
+	secondsPerDay   = 86400
+	secondsPerMonth = 2629746
+)
+
+// approxSeconds returns the approximate length of the duration in
+// seconds
+func (d Duration) approxSeconds() float64 {
+	return float64(d.Months)*secondsPerMonth + float64(d.Days)*secondsPerDay + float64(d.Nanos)/1e9
+}
+
+// compareDurations orders durations by their approximate lengths, and
+// then by months, days, and nanoseconds, so only equal durations
+// compare equal
+func compareDurations(a, b Duration) int {
+	if c := cmpFloat(a.approxSeconds(), b.approxSeconds()); c != 0 {
+		return c
+	}
+	if c := cmpInt(a.Months, b.Months); c != 0 {
+		return c
+	}
+	if c := cmpInt(a.Days, b.Days); c != 0 {
+		return c
+	}
+	return cmpInt(a.Nanos, b.Nanos)
+}
+
+// AddTo returns t plus the duration
+func (d Duration) AddTo(t time.Time) time.Time {
+	return t.AddDate(0, int(d.Months), int(d.Days)).Add(time.Duration(d.Nanos))
+}
+
+// String returns the duration in ISO 8601 format, such as P1Y2M3DT4H5M6.5S
+func (d Duration) String() string {
+	if d == (Duration{}) {
+		return "PT0S"
+	}
+	sb := strings.Builder{}
+	sb.WriteByte('P')
+	if y := d.Months / 12; y != 0 {
+		fmt.Fprintf(&sb, "%dY", y)
+	}
+	if m := d.Months % 12; m != 0 {
+		fmt.Fprintf(&sb, "%dM", m)
+	}
+	if d.Days != 0 {
+		fmt.Fprintf(&sb, "%dD", d.Days)
+	}
+	if d.Nanos == 0 {
+		return sb.String()
+	}
+	sb.WriteByte('T')
+	n := d.Nanos
+	sign := ""
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	if h := n / int64(time.Hour); h != 0 {
+		fmt.Fprintf(&sb, "%s%dH", sign, h)
+	}
+	if m := (n % int64(time.Hour)) / int64(time.Minute); m != 0 {
+		fmt.Fprintf(&sb, "%s%dM", sign, m)
+	}
+	if n = n % int64(time.Minute); n != 0 {
+		s := strconv.FormatInt(n/int64(time.Second), 10)
+		if frac := n % int64(time.Second); frac != 0 {
+			s += strings.TrimRight(fmt.Sprintf(".%09d", frac), "0")
+		}
+		fmt.Fprintf(&sb, "%s%sS", sign, s)
+	}
+	return sb.String()
+}
+
+// ParseDuration parses an ISO 8601 duration of the form
+// PnYnMnWnDTnHnMnS. Each component can be negative, the duration can
+// start with '-' to negate all components, and the seconds can have
+// up to 9 fractional digits.
+func ParseDuration(s string) (Duration, error) {
+	in := s
+	errInvalid := fmt.Errorf("Invalid duration: %s", in)
+	negate := false
+	if strings.HasPrefix(s, "-") {
+		negate = true
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) == 1 {
+		return Duration{}, errInvalid
+	}
+	s = s[1:]
+	var ret Duration
+	inTime := false
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime || len(s) == 1 {
+				return Duration{}, errInvalid
+			}
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		end := strings.IndexAny(s, "YMWDHS")
+		if end <= 0 {
+			return Duration{}, errInvalid
+		}
+		num, unit := s[:end], s[end]
+		s = s[end+1:]
+		if inTime && unit == 'S' {
+			secs, frac := num, ""
+			if i := strings.IndexAny(num, ".,"); i != -1 {
+				secs, frac = num[:i], num[i+1:]
+				if len(frac) == 0 || len(frac) > 9 {
+					return Duration{}, errInvalid
+				}
+			}
+			n, err := strconv.ParseInt(secs, 10, 64)
+			if err != nil {
+				return Duration{}, errInvalid
+			}
+			nanos := n * int64(time.Second)
+			if len(frac) > 0 {
+				f, err := strconv.ParseInt((frac + "000000000")[:9], 10, 64)
+				if err != nil || f < 0 {
+					return Duration{}, errInvalid
+				}
+				if strings.HasPrefix(secs, "-") {
+					f = -f
+				}
+				nanos += f
+			}
+			ret.Nanos += nanos
+			continue
+		}
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return Duration{}, errInvalid
+		}
+		switch {
+		case !inTime && unit == 'Y':
+			ret.Months += n * 12
+		case !inTime && unit == 'M':
+			ret.Months += n
+		case !inTime && unit == 'W':
+			ret.Days += n * 7
+		case !inTime && unit == 'D':
+			ret.Days += n
+		case inTime && unit == 'H':
+			ret.Nanos += n * int64(time.Hour)
+		case inTime && unit == 'M':
+			ret.Nanos += n * int64(time.Minute)
+		default:
+			return Duration{}, errInvalid
+		}
+	}
+	if negate {
+		ret = Duration{Months: -ret.Months, Days: -ret.Days, Nanos: -ret.Nanos}
+	}
+	return ret, nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(in []byte) error {
+	v, err := ParseDuration(string(in))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected Duration
+		str      string
+	}{
+		{"P1Y2M3DT4H5M6.5S", Duration{Months: 14, Days: 3, Nanos: int64(4*time.Hour + 5*time.Minute + 6500*time.Millisecond)}, "P1Y2M3DT4H5M6.5S"},
+		{"P2W", Duration{Days: 14}, "P14D"},
+		{"PT0S", Duration{}, "PT0S"},
+		{"PT90M", Duration{Nanos: int64(90 * time.Minute)}, "PT1H30M"},
+		{"-P1DT1S", Duration{Days: -1, Nanos: -int64(time.Second)}, "P-1DT-1S"},
+		{"PT-0.25S", Duration{Nanos: -int64(250 * time.Millisecond)}, "PT-0.25S"},
+		{"PT0.000000001S", Duration{Nanos: 1}, "PT0.000000001S"},
+	} {
+		d, err := ParseDuration(tc.in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if d != tc.expected {
+			t.Errorf("%s: expected %+v got %+v", tc.in, tc.expected, d)
+		}
+		if d.String() != tc.str {
+			t.Errorf("%s: expected %s got %s", tc.in, tc.str, d.String())
+		}
+		if r, _ := ParseDuration(d.String()); r != d {
+			t.Errorf("%s: no round trip: %+v", tc.in, r)
+		}
+	}
+	for _, in := range []string{"", "P", "1D", "PT", "P1H", "PT1D", "P1.5D", "PT1.S", "PT1.0000000001S", "P1DT"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Errorf("%s: expecting error", in)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	d, err := ParseDate("2021-01-31")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d != NewDate(2021, 1, 31) || d.String() != "2021-01-31" {
+		t.Errorf("Wrong date: %v", d)
+	}
+	if x := d.Add(Duration{Months: 1}); x != NewDate(2021, 3, 3) {
+		t.Errorf("Wrong date: %v", x)
+	}
+	if x := d.Add(Duration{Days: 1, Nanos: int64(47 * time.Hour)}); x != NewDate(2021, 2, 2) {
+		t.Errorf("Wrong date: %v", x)
+	}
+	if x := DateOf(time.Date(2021, 1, 1, 23, 0, 0, 0, time.FixedZone("x", -3600))); x != NewDate(2021, 1, 1) {
+		t.Errorf("Wrong date: %v", x)
+	}
+
+	if v, ok := DatePropertyType.Coerce("2021-01-31"); !ok || v != d {
+		t.Errorf("Cannot coerce date: %v", v)
+	}
+	if v, ok := DurationPropertyType.Coerce(time.Minute); !ok || v != DurationOf(time.Minute) {
+		t.Errorf("Cannot coerce duration: %v", v)
+	}
+	if TypeOfPropertyValue(d) != DatePropertyType || TypeOfPropertyValue(Duration{}) != DurationPropertyType {
+		t.Errorf("Wrong types")
+	}
+}
+
+func TestTemporalIndex(t *testing.T) {
+	g := NewGraph()
+	g.AddNodePropertyIndex("day", BtreeIndex)
+	g.AddNodeCompositeIndex([]string{"day"}, BtreeIndex)
+	start := NewDate(2021, 1, 1)
+	for i := 0; i < 20; i++ {
+		g.NewNode(nil, map[string]interface{}{"day": start.Add(Duration{Days: int64(i)})})
+	}
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"day": NewDate(2021, 1, 5)}))); n != 1 {
+		t.Errorf("Expecting 1, got %d", n)
+	}
+	itr, err := g.ScanNodeCompositeIndex([]string{"day"}, CompositeRange{Min: NewDate(2021, 1, 5), Max: NewDate(2021, 1, 10), ExcludeMax: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n := len(NodeSlice(itr)); n != 5 {
+		t.Errorf("Expecting 5, got %d", n)
+	}
+
+	buf := bytes.Buffer{}
+	if err := (CypherExporter{}).Export(g, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(buf.String(), "date('2021-01-05')") {
+		t.Errorf("No date literal: %s", buf.String())
+	}
+	target := NewGraph()
+	if err := (CypherImporter{}).Import(target, &buf); err != nil {
+		t.Error(err)
+		return
+	}
+	if n := len(NodeSlice(target.FindNodes(StringSet{}, map[string]interface{}{"day": NewDate(2021, 1, 20)}))); n != 1 {
+		t.Errorf("Expecting 1, got %d", n)
+	}
+}
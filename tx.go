@@ -0,0 +1,229 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+// ErrTx is returned for invalid transaction operations, such as
+// committing a transaction twice, or committing a transaction while a
+// nested transaction is still open.
+type ErrTx struct {
+	Msg string
+}
+
+func (e ErrTx) Error() string { return "Transaction error: " + e.Msg }
+
+// Tx is a graph transaction. All mutations to the graph made after
+// Begin are recorded, so they can be undone by Rollback. Transactions
+// can be nested: a nested transaction is committed into its parent,
+// and rolling back the parent also rolls back the committed nested
+// transactions.
+//
+// A Tx is not a concurrency control mechanism. A graph is still not
+// safe for concurrent use.
+//
+// Rollback restores the nodes, edges, labels, properties, and indexes
+// of the graph. Indexes created or dropped in the transaction are
+// dropped or created again. The iteration order of the restored edges
+// may be different.
+type Tx struct {
+	g      *Graph
+	parent *Tx
+	// The journal index this transaction started at
+	start int
+	done  bool
+}
+
+// Savepoint records a point in a transaction that can be rolled back
+// to using Tx.RollbackTo
+type Savepoint struct {
+	tx *Tx
+	n  int
+}
+
+// Begin starts a new transaction. If there is already an active
+// transaction, the new transaction is nested in it.
+func (g *Graph) Begin() *Tx {
+	tx := &Tx{
+		g:      g,
+		parent: g.tx,
+		start:  len(g.journal),
+	}
+	g.tx = tx
+	if tx.parent == nil {
+		for _, o := range g.txObservers {
+			o.txBegin()
+		}
+	}
+	return tx
+}
+
+// txObserver is notified when an outermost transaction begins and
+// ends. txCommit is called before the outermost transaction commits,
+// and if it returns an error, the transaction is rolled back, and
+// Commit returns the error.
+type txObserver interface {
+	txBegin()
+	txCommit() error
+	txEnd(committed bool)
+}
+
+// mutation starts an implicit transaction for a change made outside a
+// transaction if the graph has constraints or transaction observers,
+// so the change is validated and observed as a unit, and it can be
+// rejected at commit. Returns nil if no transaction is needed. The public methods that modify the
+// graph call it as:
+//
+//	defer g.endMutation(g.mutation(), nil)
+func (g *Graph) mutation() *Tx {
+	if g.tx != nil || (len(g.txObservers) == 0 && len(g.constraints) == 0) {
+		return nil
+	}
+	return g.Begin()
+}
+
+// endMutation ends the implicit transaction started by mutation. If
+// the change panics, the transaction is rolled back, and the panic
+// continues. If err is not nil, the change returns an error through
+// it: the transaction is rolled back if the change failed, and the
+// commit error is returned through it. Otherwise, the commit error is
+// the panic value.
+func (g *Graph) endMutation(tx *Tx, err *error) {
+	if tx == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		tx.Rollback()
+		panic(r)
+	}
+	if err != nil && *err != nil {
+		tx.Rollback()
+		return
+	}
+	if cerr := tx.Commit(); cerr != nil {
+		if err == nil {
+			panic(cerr)
+		}
+		*err = cerr
+	}
+}
+
+// InTx returns true if there is an active transaction
+func (g *Graph) InTx() bool { return g.tx != nil }
+
+// record an undo operation if there is an active transaction
+func (g *Graph) record(undo func()) {
+	if g.tx != nil {
+		g.journal = append(g.journal, undo)
+	}
+}
+
+// undo the journal entries up to n. The undo operations call the same
+// graph methods as the mutations, so recording is disabled while they
+// run.
+func (g *Graph) undo(n int) {
+	g.snap = nil
+	tx := g.tx
+	g.tx = nil
+	for i := len(g.journal) - 1; i >= n; i-- {
+		g.journal[i]()
+		g.journal[i] = nil
+	}
+	g.journal = g.journal[:n]
+	g.tx = tx
+}
+
+func (tx *Tx) check() error {
+	if tx.done {
+		return ErrTx{Msg: "transaction is already committed or rolled back"}
+	}
+	if tx.g.tx != tx {
+		return ErrTx{Msg: "nested transaction is still active"}
+	}
+	return nil
+}
+
+func (tx *Tx) end(committed bool) {
+	tx.done = true
+	tx.g.tx = tx.parent
+	if tx.parent == nil {
+		tx.g.journal = nil
+		for _, o := range tx.g.txObservers {
+			o.txEnd(committed)
+		}
+	}
+}
+
+// Commit the transaction. If this is a nested transaction, the
+// changes become part of the parent transaction.
+//
+// If the graph has constraints, the nodes and edges modified in the
+// transaction are validated when the outermost transaction
+// commits. If there is a violation, the transaction is rolled back,
+// and the constraint error is returned. Similarly, if the graph is a
+// PersistentGraph and the changes cannot be logged, the transaction is
+// rolled back and the error is returned.
+func (tx *Tx) Commit() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if tx.parent == nil {
+		if err := tx.g.validateDirty(); err != nil {
+			tx.g.undo(tx.start)
+			tx.end(false)
+			return err
+		}
+		for _, o := range tx.g.txObservers {
+			if err := o.txCommit(); err != nil {
+				tx.g.undo(tx.start)
+				tx.end(false)
+				return err
+			}
+		}
+	}
+	tx.end(true)
+	return nil
+}
+
+// Rollback undoes all the changes made in the transaction
+func (tx *Tx) Rollback() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	tx.g.undo(tx.start)
+	if tx.parent == nil {
+		tx.g.dirtyNodes = nil
+		tx.g.dirtyEdges = nil
+	}
+	tx.end(false)
+	return nil
+}
+
+// Savepoint returns a savepoint for the current state of the
+// transaction
+func (tx *Tx) Savepoint() Savepoint {
+	return Savepoint{tx: tx, n: len(tx.g.journal)}
+}
+
+// RollbackTo undoes the changes made after the savepoint. The
+// transaction remains active.
+func (tx *Tx) RollbackTo(sp Savepoint) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if sp.tx != tx || sp.n > len(tx.g.journal) {
+		return ErrTx{Msg: "invalid savepoint"}
+	}
+	tx.g.undo(sp.n)
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func getTxTestGraph() *Graph {
+	g := NewGraph()
+	g.AddNodePropertyIndex("key", HashIndex)
+	g.AddEdgePropertyIndex("w", BtreeIndex)
+	n1 := g.NewNode([]string{"a"}, map[string]interface{}{"key": "1"})
+	n2 := g.NewNode([]string{"b"}, map[string]interface{}{"key": "2"})
+	n3 := g.NewNode([]string{"a", "b"}, map[string]interface{}{"key": "3"})
+	g.NewEdge(n1, n2, "e", map[string]interface{}{"w": 1})
+	g.NewEdge(n2, n3, "f", map[string]interface{}{"w": 2})
+	g.NewEdge(n3, n1, "e", nil)
+	return g
+}
+
+// encodeTxTestGraph returns a string describing the graph. Labels are
+// sorted, so graphs with the same content have the same encoding.
+func encodeTxTestGraph(t *testing.T, g *Graph) string {
+	buf := bytes.Buffer{}
+	for nodes := g.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		fmt.Fprintf(&buf, "(%d %v %v)", node.GetID(), node.GetLabels().SortedSlice(), node.properties.load())
+	}
+	for edges := g.GetEdges(); edges.Next(); {
+		edge := edges.Edge()
+		fmt.Fprintf(&buf, "[%d %d-%s->%d %v]", edge.GetID(), edge.GetFrom().GetID(), edge.GetLabel(), edge.GetTo().GetID(), edge.properties.load())
+	}
+	return buf.String()
+}
+
+func TestTxRollback(t *testing.T) {
+	g := getTxTestGraph()
+	before := encodeTxTestGraph(t, g)
+
+	tx := g.Begin()
+	nodes := NodeSlice(g.GetNodes())
+	nodes[0].SetProperty("key", "x")
+	nodes[1].SetLabels(NewStringSet("c"))
+	nodes[2].DetachAndRemove()
+	n4 := g.NewNode([]string{"a"}, map[string]interface{}{"key": "4"})
+	e := g.NewEdge(nodes[0], n4, "e", map[string]interface{}{"w": 5})
+	e.SetLabel("g")
+	for edges := g.GetEdges(); edges.Next(); {
+		edges.Edge().RemoveProperty("w")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+
+	if after := encodeTxTestGraph(t, g); after != before {
+		t.Errorf("Rollback failed: %s %s", before, after)
+	}
+	if g.NumNodes() != 3 || g.NumEdges() != 3 {
+		t.Errorf("Wrong size: %d %d", g.NumNodes(), g.NumEdges())
+	}
+	if n := len(NodeSlice(g.FindNodes(NewStringSet("a"), map[string]interface{}{"key": "3"}))); n != 1 {
+		t.Errorf("Node index not restored: %d", n)
+	}
+	if n := len(NodeSlice(g.FindNodes(NewStringSet("a"), map[string]interface{}{"key": "4"}))); n != 0 {
+		t.Errorf("Node index not restored: %d", n)
+	}
+	if n := len(EdgeSlice(g.FindEdges(NewStringSet("e"), map[string]interface{}{"w": 1}))); n != 1 {
+		t.Errorf("Edge index not restored: %d", n)
+	}
+	if n := len(EdgeSlice(g.GetEdgesWithAnyLabel(NewStringSet("g")))); n != 0 {
+		t.Errorf("Edge label not restored: %d", n)
+	}
+	if n4 := g.NewNode(nil, nil); n4.GetID() != 6 {
+		t.Errorf("Id not restored: %d", n4.GetID())
+	}
+}
+
+func TestTxSavepoint(t *testing.T) {
+	g := getTxTestGraph()
+	tx := g.Begin()
+	g.NewNode([]string{"x"}, nil)
+	sp := tx.Savepoint()
+	g.NewNode([]string{"y"}, nil)
+	nested := g.Begin()
+	g.NewNode([]string{"z"}, nil)
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expecting error committing with an active nested tx")
+	}
+	if err := nested.Commit(); err != nil {
+		t.Error(err)
+	}
+	if g.NumNodes() != 6 {
+		t.Errorf("Wrong size: %d", g.NumNodes())
+	}
+	if err := tx.RollbackTo(sp); err != nil {
+		t.Error(err)
+	}
+	if g.NumNodes() != 4 {
+		t.Errorf("Wrong size: %d", g.NumNodes())
+	}
+	if err := tx.Commit(); err != nil {
+		t.Error(err)
+	}
+	if err := tx.Rollback(); err == nil {
+		t.Errorf("Expecting error rolling back a committed tx")
+	}
+	if g.InTx() || g.NumNodes() != 4 {
+		t.Errorf("Wrong state")
+	}
+}
+
+func TestTxIndexes(t *testing.T) {
+	g := getTxTestGraph()
+	before := g.GetIndexes()
+	tx := g.Begin()
+	g.AddNodePropertyIndex("name", BtreeIndex)
+	g.AddNodeCompositeIndex([]string{"key", "name"}, HashIndex)
+	g.DropIndex(IndexInfo{Type: HashIndex, Keys: []string{"key"}})
+	g.AddNodePropertyIndex("key", BtreeIndex)
+	g.RebuildIndexes()
+	g.NewNode([]string{"a"}, map[string]interface{}{"key": "4", "name": "x"})
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+	after := g.GetIndexes()
+	if len(after) != len(before) {
+		t.Errorf("Indexes not restored: %v", after)
+		return
+	}
+	for i := range before {
+		if !before[i].sameIndex(after[i]) || before[i].Stats != after[i].Stats {
+			t.Errorf("Expecting %v %+v, got %v %+v", before[i], before[i].Stats, after[i], after[i].Stats)
+		}
+	}
+	if n := len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"key": "3"}))); n != 1 {
+		t.Errorf("Expecting 1, got %d", n)
+	}
+}
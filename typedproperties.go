@@ -0,0 +1,240 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrPropertyNotFound is returned by the typed property accessors
+// when the node or edge does not have the property
+type ErrPropertyNotFound struct {
+	Key string
+}
+
+func (e ErrPropertyNotFound) Error() string {
+	return fmt.Sprintf("Property not found: %s", e.Key)
+}
+
+// typedProperty returns the property value coerced to the type.
+// PropertyValue and other WithNativeValue values are coerced using
+// their native values.
+func (p *properties) typedProperty(key string, t PropertyType) (interface{}, error) {
+	value, ok := p.getProperty(key)
+	if !ok {
+		return nil, ErrPropertyNotFound{Key: key}
+	}
+	pv, err := NewPropertyValue(t, value)
+	if err != nil {
+		return nil, ErrPropertyType{Key: key, Expected: t, Value: nativeValue(value)}
+	}
+	return pv.value, nil
+}
+
+// GetStringProperty returns the property value as a string. Returns
+// false if the property does not exist, or if it cannot be coerced
+// to a string. The typed property accessors are promoted to nodes and
+// edges, and all use the same coercion rules:
+//
+//   - string: only string values
+//   - int, int64: integers, and floats with integral values, if they
+//     fit in the type without loss
+//   - float: numbers that are exactly representable as a float64
+//   - bool: only bool values
+//   - time: time.Time values, and RFC3339 strings
+//   - date: Date values, the dates of time.Time values, and
+//     2006-01-02 strings
+//   - duration: Duration values, time.Duration values, and ISO 8601
+//     duration strings
+//   - list: slices and arrays, as []interface{}
+//   - map: maps with string keys, as map[string]interface{}
+func (p *properties) GetStringProperty(key string) (string, bool) {
+	v, err := p.GetStringPropertyE(key)
+	return v, err == nil
+}
+
+// GetStringPropertyE returns the property value as a string. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetStringPropertyE(key string) (string, error) {
+	v, err := p.typedProperty(key, StringPropertyType)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// GetIntProperty returns the property value as an int. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetIntProperty(key string) (int, bool) {
+	v, err := p.GetIntPropertyE(key)
+	return v, err == nil
+}
+
+// GetIntPropertyE returns the property value as an int. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetIntPropertyE(key string) (int, error) {
+	v, err := p.typedProperty(key, IntPropertyType)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int), nil
+}
+
+// GetInt64Property returns the property value as an int64. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetInt64Property(key string) (int64, bool) {
+	v, err := p.GetInt64PropertyE(key)
+	return v, err == nil
+}
+
+// GetInt64PropertyE returns the property value as an int64. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetInt64PropertyE(key string) (int64, error) {
+	v, err := p.typedProperty(key, Int64PropertyType)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+// GetFloatProperty returns the property value as a float64. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetFloatProperty(key string) (float64, bool) {
+	v, err := p.GetFloatPropertyE(key)
+	return v, err == nil
+}
+
+// GetFloatPropertyE returns the property value as a float64. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetFloatPropertyE(key string) (float64, error) {
+	v, err := p.typedProperty(key, FloatPropertyType)
+	if err != nil {
+		return 0, err
+	}
+	return v.(float64), nil
+}
+
+// GetBoolProperty returns the property value as a bool. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetBoolProperty(key string) (bool, bool) {
+	v, err := p.GetBoolPropertyE(key)
+	return v, err == nil
+}
+
+// GetBoolPropertyE returns the property value as a bool. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetBoolPropertyE(key string) (bool, error) {
+	v, err := p.typedProperty(key, BoolPropertyType)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// GetTimeProperty returns the property value as a time.Time. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetTimeProperty(key string) (time.Time, bool) {
+	v, err := p.GetTimePropertyE(key)
+	return v, err == nil
+}
+
+// GetTimePropertyE returns the property value as a time.Time. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetTimePropertyE(key string) (time.Time, error) {
+	v, err := p.typedProperty(key, TimePropertyType)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return v.(time.Time), nil
+}
+
+// GetDateProperty returns the property value as a Date. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetDateProperty(key string) (Date, bool) {
+	v, err := p.GetDatePropertyE(key)
+	return v, err == nil
+}
+
+// GetDatePropertyE returns the property value as a Date. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetDatePropertyE(key string) (Date, error) {
+	v, err := p.typedProperty(key, DatePropertyType)
+	if err != nil {
+		return Date{}, err
+	}
+	return v.(Date), nil
+}
+
+// GetDurationProperty returns the property value as a Duration. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetDurationProperty(key string) (Duration, bool) {
+	v, err := p.GetDurationPropertyE(key)
+	return v, err == nil
+}
+
+// GetDurationPropertyE returns the property value as a Duration. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetDurationPropertyE(key string) (Duration, error) {
+	v, err := p.typedProperty(key, DurationPropertyType)
+	if err != nil {
+		return Duration{}, err
+	}
+	return v.(Duration), nil
+}
+
+// GetListProperty returns the property value as a list. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetListProperty(key string) ([]interface{}, bool) {
+	v, err := p.GetListPropertyE(key)
+	return v, err == nil
+}
+
+// GetListPropertyE returns the property value as a list. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetListPropertyE(key string) ([]interface{}, error) {
+	v, err := p.typedProperty(key, ListPropertyType)
+	if err != nil {
+		return nil, err
+	}
+	return v.([]interface{}), nil
+}
+
+// GetMapProperty returns the property value as a map. Returns
+// false if the property does not exist, or if it cannot be coerced.
+func (p *properties) GetMapProperty(key string) (map[string]interface{}, bool) {
+	v, err := p.GetMapPropertyE(key)
+	return v, err == nil
+}
+
+// GetMapPropertyE returns the property value as a map. Returns
+// ErrPropertyNotFound if the property does not exist, and
+// ErrPropertyType if it cannot be coerced.
+func (p *properties) GetMapPropertyE(key string) (map[string]interface{}, error) {
+	v, err := p.typedProperty(key, MapPropertyType)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
@@ -0,0 +1,488 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// VectorMetric is the similarity metric of a vector index
+type VectorMetric int
+
+const (
+	// CosineSimilarity compares the angle between the vectors
+	CosineSimilarity VectorMetric = iota
+	// DotProduct compares the dot product of the vectors
+	DotProduct
+	// L2Distance compares the Euclidean distance between the
+	// vectors. The similarity is the negated distance.
+	L2Distance
+)
+
+// VectorIndexOptions configures a vector index
+type VectorIndexOptions struct {
+	Metric VectorMetric
+
+	// Dimensions is the length of the indexed vectors. Values of other
+	// lengths are not indexed. If 0, the length of the first indexed
+	// vector is used.
+	Dimensions int
+
+	// If Approximate is true, the index is a Hierarchical Navigable
+	// Small World (HNSW) graph, and searches are approximate. Otherwise
+	// searches compare the query with all the indexed vectors.
+	Approximate bool
+
+	// HNSW parameters: the number of neighbors of a vector (default
+	// 16), the size of the candidate list used when inserting (default
+	// 200), and the size of the candidate list used when searching
+	// (default 64). Larger values give better recall, and slower
+	// indexing and searches.
+	M              int
+	EfConstruction int
+	EfSearch       int
+}
+
+// ErrVectorIndex is returned when a vector search is not possible
+type ErrVectorIndex struct {
+	Property string
+	Msg      string
+}
+
+func (e ErrVectorIndex) Error() string {
+	return fmt.Sprintf("Vector index %s: %s", e.Property, e.Msg)
+}
+
+// toVector returns the vector for a property value. A vector can be a
+// []float32, []float64, or a []interface{} of numbers.
+func toVector(value interface{}) ([]float32, bool) {
+	switch v := nativeValue(value).(type) {
+	case []float32:
+		return v, true
+	case []float64:
+		ret := make([]float32, len(v))
+		for i := range v {
+			ret[i] = float32(v[i])
+		}
+		return ret, true
+	case []interface{}:
+		ret := make([]float32, len(v))
+		for i := range v {
+			x := nativeValue(v[i])
+			if rank, _ := valueRank(x); rank != rankNumber {
+				return nil, false
+			}
+			n := toNumeric(x)
+			switch n.kind {
+			case numInt:
+				ret[i] = float32(n.i)
+			case numUint:
+				ret[i] = float32(n.u)
+			default:
+				ret[i] = float32(n.f)
+			}
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+func dot(a, b []float32) float64 {
+	ret := 0.0
+	for i := range a {
+		ret += float64(a[i]) * float64(b[i])
+	}
+	return ret
+}
+
+// similarity returns the similarity function for the metric. Larger
+// values are more similar.
+func (m VectorMetric) similarity() func(a, b []float32) float64 {
+	switch m {
+	case DotProduct:
+		return dot
+	case L2Distance:
+		return func(a, b []float32) float64 {
+			ret := 0.0
+			for i := range a {
+				d := float64(a[i]) - float64(b[i])
+				ret += d * d
+			}
+			return -math.Sqrt(ret)
+		}
+	}
+	return func(a, b []float32) float64 {
+		na, nb := dot(a, a), dot(b, b)
+		if na == 0 || nb == 0 {
+			return 0
+		}
+		return dot(a, b) / math.Sqrt(na*nb)
+	}
+}
+
+type vectorEntry struct {
+	id      int
+	item    interface{}
+	vector  []float32
+	level   int
+	friends [][]int
+	deleted bool
+}
+
+type candidate struct {
+	entry int
+	sim   float64
+}
+
+// candidateHeap is a heap of candidates. If nearest is true, the most
+// similar candidate is at the top, otherwise the least similar one.
+type candidateHeap struct {
+	items   []candidate
+	nearest bool
+}
+
+func (h candidateHeap) Len() int { return len(h.items) }
+func (h candidateHeap) Less(i, j int) bool {
+	if h.nearest {
+		return h.items[i].sim > h.items[j].sim
+	}
+	return h.items[i].sim < h.items[j].sim
+}
+func (h candidateHeap) Swap(i, j int)       { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x interface{}) { h.items = append(h.items, x.(candidate)) }
+func (h *candidateHeap) Pop() interface{} {
+	n := len(h.items)
+	ret := h.items[n-1]
+	h.items = h.items[:n-1]
+	return ret
+}
+
+// vectorIndex keeps the vectors of a property. The entries are in a
+// slice, and in approximate mode they are also connected as an HNSW
+// graph. Removed entries are marked as deleted and stay in the HNSW
+// graph to keep it connected until the graph is rebuilt.
+type vectorIndex struct {
+	options    VectorIndexOptions
+	similarity func(a, b []float32) float64
+
+	entries []*vectorEntry
+	// Entry index by id
+	byID    map[int]int
+	deleted int
+
+	entryPoint int
+	maxLevel   int
+	levelMult  float64
+	rnd        *rand.Rand
+}
+
+func newVectorIndex(options VectorIndexOptions) *vectorIndex {
+	if options.M <= 0 {
+		options.M = 16
+	}
+	if options.EfConstruction <= 0 {
+		options.EfConstruction = 200
+	}
+	if options.EfSearch <= 0 {
+		options.EfSearch = 64
+	}
+	ix := &vectorIndex{
+		options:    options,
+		similarity: options.Metric.similarity(),
+		levelMult:  1 / math.Log(float64(options.M)),
+	}
+	ix.reset()
+	return ix
+}
+
+func (ix *vectorIndex) reset() {
+	ix.entries = nil
+	ix.byID = make(map[int]int)
+	ix.deleted = 0
+	ix.entryPoint = -1
+	ix.maxLevel = 0
+	// Use a fixed seed so the index is the same for the same inserts
+	ix.rnd = rand.New(rand.NewSource(1))
+}
+
+func (ix *vectorIndex) add(value interface{}, id int, item interface{}) {
+	vector, ok := toVector(value)
+	if !ok || len(vector) == 0 {
+		return
+	}
+	if ix.options.Dimensions == 0 {
+		ix.options.Dimensions = len(vector)
+	}
+	if len(vector) != ix.options.Dimensions {
+		return
+	}
+	entry := &vectorEntry{id: id, item: item, vector: vector}
+	ix.entries = append(ix.entries, entry)
+	ix.byID[id] = len(ix.entries) - 1
+	if ix.options.Approximate {
+		ix.insert(len(ix.entries) - 1)
+	}
+}
+
+func (ix *vectorIndex) remove(value interface{}, id int) {
+	n, ok := ix.byID[id]
+	if !ok {
+		return
+	}
+	delete(ix.byID, id)
+	if !ix.options.Approximate {
+		// Move the last entry to n
+		last := len(ix.entries) - 1
+		if n != last {
+			ix.entries[n] = ix.entries[last]
+			ix.byID[ix.entries[n].id] = n
+		}
+		ix.entries[last] = nil
+		ix.entries = ix.entries[:last]
+		return
+	}
+	ix.entries[n].deleted = true
+	ix.deleted++
+	// Rebuild when most entries are deleted
+	if ix.deleted > 16 && ix.deleted > len(ix.byID) {
+		entries := ix.entries
+		ix.reset()
+		for _, e := range entries {
+			if !e.deleted {
+				ix.add(e.vector, e.id, e.item)
+			}
+		}
+	}
+}
+
+func (ix *vectorIndex) stats() IndexStats {
+	mem := 0
+	for _, e := range ix.entries {
+		mem += vectorEntryBytes + len(e.vector)*4
+		for _, f := range e.friends {
+			mem += sliceBytes + len(f)*intBytes
+		}
+	}
+	mem += len(ix.byID) * mapEntryBytes
+	return IndexStats{
+		Entries:        len(ix.byID),
+		DistinctValues: len(ix.byID),
+		MemoryEstimate: mem,
+	}
+}
+
+// searchLayer returns the ef nearest entries to the query in the
+// layer, starting from the entry points
+func (ix *vectorIndex) searchLayer(query []float32, entryPoints []candidate, ef, layer int) []candidate {
+	visited := make(map[int]struct{})
+	candidates := &candidateHeap{nearest: true}
+	result := &candidateHeap{}
+	for _, c := range entryPoints {
+		visited[c.entry] = struct{}{}
+		heap.Push(candidates, c)
+		heap.Push(result, c)
+	}
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(candidate)
+		if result.Len() >= ef && c.sim < result.items[0].sim {
+			break
+		}
+		for _, f := range ix.entries[c.entry].friends[layer] {
+			if _, seen := visited[f]; seen {
+				continue
+			}
+			visited[f] = struct{}{}
+			sim := ix.similarity(query, ix.entries[f].vector)
+			if result.Len() < ef || sim > result.items[0].sim {
+				heap.Push(candidates, candidate{entry: f, sim: sim})
+				heap.Push(result, candidate{entry: f, sim: sim})
+				if result.Len() > ef {
+					heap.Pop(result)
+				}
+			}
+		}
+	}
+	// Sort nearest first
+	ret := make([]candidate, result.Len())
+	for i := len(ret) - 1; i >= 0; i-- {
+		ret[i] = heap.Pop(result).(candidate)
+	}
+	return ret
+}
+
+// nearest returns the m entries of candidates that are most similar
+// to the vector of entry n
+func (ix *vectorIndex) nearest(n int, candidates []int, m int) []int {
+	h := &candidateHeap{}
+	for _, c := range candidates {
+		heap.Push(h, candidate{entry: c, sim: ix.similarity(ix.entries[n].vector, ix.entries[c].vector)})
+		if h.Len() > m {
+			heap.Pop(h)
+		}
+	}
+	ret := make([]int, h.Len())
+	for i := len(ret) - 1; i >= 0; i-- {
+		ret[i] = heap.Pop(h).(candidate).entry
+	}
+	return ret
+}
+
+// insert adds entry n to the HNSW graph
+func (ix *vectorIndex) insert(n int) {
+	entry := ix.entries[n]
+	entry.level = int(-math.Log(1-ix.rnd.Float64()) * ix.levelMult)
+	entry.friends = make([][]int, entry.level+1)
+	if ix.entryPoint == -1 {
+		ix.entryPoint = n
+		ix.maxLevel = entry.level
+		return
+	}
+	ep := []candidate{{entry: ix.entryPoint, sim: ix.similarity(entry.vector, ix.entries[ix.entryPoint].vector)}}
+	for layer := ix.maxLevel; layer > entry.level; layer-- {
+		ep = ix.searchLayer(entry.vector, ep, 1, layer)[:1]
+	}
+	layer := entry.level
+	if layer > ix.maxLevel {
+		layer = ix.maxLevel
+	}
+	for ; layer >= 0; layer-- {
+		maxFriends := ix.options.M
+		if layer == 0 {
+			maxFriends *= 2
+		}
+		ep = ix.searchLayer(entry.vector, ep, ix.options.EfConstruction, layer)
+		candidates := make([]int, len(ep))
+		for i := range ep {
+			candidates[i] = ep[i].entry
+		}
+		entry.friends[layer] = ix.nearest(n, candidates, ix.options.M)
+		for _, f := range entry.friends[layer] {
+			friend := ix.entries[f]
+			friend.friends[layer] = append(friend.friends[layer], n)
+			if len(friend.friends[layer]) > maxFriends {
+				friend.friends[layer] = ix.nearest(f, friend.friends[layer], maxFriends)
+			}
+		}
+	}
+	if entry.level > ix.maxLevel {
+		ix.entryPoint = n
+		ix.maxLevel = entry.level
+	}
+}
+
+// search returns the k nearest items to the query
+func (ix *vectorIndex) search(query []float32, k int) []scoredItem {
+	if k <= 0 || len(ix.byID) == 0 {
+		return nil
+	}
+	var found []candidate
+	if !ix.options.Approximate {
+		h := &candidateHeap{}
+		for i, e := range ix.entries {
+			heap.Push(h, candidate{entry: i, sim: ix.similarity(query, e.vector)})
+			if h.Len() > k {
+				heap.Pop(h)
+			}
+		}
+		found = h.items
+	} else {
+		ep := []candidate{{entry: ix.entryPoint, sim: ix.similarity(query, ix.entries[ix.entryPoint].vector)}}
+		for layer := ix.maxLevel; layer > 0; layer-- {
+			ep = ix.searchLayer(query, ep, 1, layer)[:1]
+		}
+		ef := ix.options.EfSearch
+		if ef < k {
+			ef = k
+		}
+		// Deleted entries are in the graph, so search for more to get k
+		// results
+		ef += ix.deleted
+		found = ix.searchLayer(query, ep, ef, 0)
+	}
+	ret := make([]scoredItem, 0, k)
+	for _, c := range found {
+		e := ix.entries[c.entry]
+		if e.deleted {
+			continue
+		}
+		ret = append(ret, scoredItem{id: e.id, item: e.item, score: c.sim})
+	}
+	// Sort by decreasing similarity, and truncate
+	ret = newScoredIterator(ret).items
+	if len(ret) > k {
+		ret = ret[:k]
+	}
+	return ret
+}
+
+// NodeVectorIndex sets up a vector index for the given node property
+func (g *graphIndex) NodeVectorIndex(propertyName string, graph *Graph, options VectorIndexOptions) {
+	if _, exists := g.nodeVectors[propertyName]; exists {
+		return
+	}
+	ix := newVectorIndex(options)
+	g.nodeVectors[propertyName] = ix
+	for nodes := graph.GetNodes(); nodes.Next(); {
+		node := nodes.Node()
+		if value, ok := node.properties.getProperty(propertyName); ok {
+			ix.add(value, node.id, node)
+		}
+	}
+}
+
+// AddNodeVectorIndex adds a vector index for the node property. The
+// property values are vectors given as []float32, []float64, or
+// []interface{} of numbers. Use NearestNodes, or the Nearest field of
+// a pattern item to search the index.
+func (g *Graph) AddNodeVectorIndex(propertyName string, options VectorIndexOptions) {
+	g.indexesChanged()
+	g.index.NodeVectorIndex(propertyName, g, options)
+}
+
+// NearestNodes returns the k nodes whose vectors in the property are
+// most similar to the vector, ordered by decreasing similarity. The
+// score of a node is the cosine similarity, the dot product, or the
+// negated L2 distance, based on the metric of the index. Returns
+// ErrVectorIndex if the property does not have a vector index, or
+// the vector has the wrong length.
+func (g *Graph) NearestNodes(propertyName string, vector []float32, k int) (ScoredNodeIterator, error) {
+	items, err := g.index.nearestNodes(propertyName, vector, k)
+	if err != nil {
+		return nil, err
+	}
+	return &scoredIterator{items: items, pos: -1}, nil
+}
+
+func (g *graphIndex) nearestNodes(propertyName string, vector []float32, k int) ([]scoredItem, error) {
+	ix, ok := g.nodeVectors[propertyName]
+	if !ok {
+		return nil, ErrVectorIndex{Property: propertyName, Msg: "No vector index"}
+	}
+	if ix.options.Dimensions != 0 && len(vector) != ix.options.Dimensions {
+		return nil, ErrVectorIndex{Property: propertyName, Msg: fmt.Sprintf("Expecting a vector of length %d", ix.options.Dimensions)}
+	}
+	return ix.search(vector, k), nil
+}
+
+// NearestQuery selects the K nodes whose vectors in Property are most
+// similar to Vector using the vector index of the property
+type NearestQuery struct {
+	Property string
+	Vector   []float32
+	K        int
+}
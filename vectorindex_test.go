@@ -0,0 +1,181 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestVectorIndexMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		metric   VectorMetric
+		expected []string
+	}{
+		{CosineSimilarity, []string{"a", "b", "c"}},
+		{DotProduct, []string{"b", "a", "c"}},
+		{L2Distance, []string{"a", "c", "b"}},
+	} {
+		g := NewGraph()
+		g.NewNode(nil, map[string]interface{}{"name": "a", "v": []float32{1, 0}})
+		g.NewNode(nil, map[string]interface{}{"name": "b", "v": []float64{3, 1}})
+		g.NewNode(nil, map[string]interface{}{"name": "c", "v": []interface{}{0, 1}})
+		g.NewNode(nil, map[string]interface{}{"name": "d", "v": []float32{1, 2, 3}})
+		g.NewNode(nil, map[string]interface{}{"name": "e", "v": "x"})
+		g.AddNodeVectorIndex("v", VectorIndexOptions{Metric: tc.metric})
+		itr, err := g.NearestNodes("v", []float32{1, 0.1}, 5)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		result := make([]string, 0)
+		for itr.Next() {
+			name, _ := itr.Node().GetProperty("name")
+			result = append(result, name.(string))
+		}
+		if len(result) != len(tc.expected) {
+			t.Errorf("%v: Expected %v, got %v", tc.metric, tc.expected, result)
+			continue
+		}
+		for i := range result {
+			if result[i] != tc.expected[i] {
+				t.Errorf("%v: Expected %v, got %v", tc.metric, tc.expected, result)
+				break
+			}
+		}
+		if _, err := g.NearestNodes("v", []float32{1, 2, 3}, 1); err == nil {
+			t.Errorf("Expecting dimension error")
+		}
+	}
+}
+
+func TestVectorIndexHNSW(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	randomVector := func() []float32 {
+		v := make([]float32, 16)
+		for i := range v {
+			v[i] = rnd.Float32()*2 - 1
+		}
+		return v
+	}
+	g := NewGraph()
+	nodes := make([]*Node, 0)
+	for i := 0; i < 1000; i++ {
+		nodes = append(nodes, g.NewNode(nil, map[string]interface{}{"v": randomVector()}))
+	}
+	g.AddNodeVectorIndex("exact", VectorIndexOptions{})
+	g.AddNodeVectorIndex("v", VectorIndexOptions{Approximate: true})
+	exact := g.index.nodeVectors["exact"]
+	for _, n := range nodes {
+		v, _ := n.GetProperty("v")
+		exact.add(v, n.id, n)
+	}
+
+	recall := func() float64 {
+		found, total := 0, 0
+		for q := 0; q < 20; q++ {
+			query := randomVector()
+			expected := NewNodeSet()
+			for _, item := range exact.search(query, 10) {
+				expected.Add(item.item.(*Node))
+			}
+			itr, err := g.NearestNodes("v", query, 10)
+			if err != nil {
+				t.Error(err)
+				return 0
+			}
+			for itr.Next() {
+				if expected.Has(itr.Node()) {
+					found++
+				}
+			}
+			total += expected.Len()
+		}
+		return float64(found) / float64(total)
+	}
+	if r := recall(); r < 0.9 {
+		t.Errorf("Low recall: %f", r)
+	}
+
+	// Updates and removals, with rebuild
+	for i, n := range nodes[:700] {
+		if i%2 == 0 {
+			n.DetachAndRemove()
+			exact.remove(nil, n.id)
+		} else {
+			v := randomVector()
+			n.SetProperty("v", v)
+			exact.remove(nil, n.id)
+			exact.add(v, n.id, n)
+		}
+	}
+	if r := recall(); r < 0.9 {
+		t.Errorf("Low recall after updates: %f", r)
+	}
+	ix := g.index.nodeVectors["v"]
+	if len(ix.byID) != 650 {
+		t.Errorf("Wrong index size: %d", len(ix.byID))
+	}
+}
+
+func TestNearestPattern(t *testing.T) {
+	g := NewGraph()
+	for i := 0; i < 20; i++ {
+		doc := g.NewNode([]string{"Document"}, map[string]interface{}{"embedding": []float32{float32(i), 1}})
+		author := g.NewNode([]string{"Author"}, map[string]interface{}{"id": i})
+		g.NewEdge(doc, author, "writtenBy", nil)
+	}
+	g.AddNodeVectorIndex("embedding", VectorIndexOptions{Metric: L2Distance})
+	pat := Pattern{
+		{Name: "doc", Labels: NewStringSet("Document"), Nearest: &NearestQuery{Property: "embedding", Vector: []float32{10, 1}, K: 3}},
+		{Labels: NewStringSet("writtenBy"), Min: 1, Max: 1},
+		{Name: "author", Labels: NewStringSet("Author")},
+	}
+	acc := &DefaultMatchAccumulator{}
+	if err := pat.Run(g, nil, acc); err != nil {
+		t.Error(err)
+		return
+	}
+	ids := make(map[int]struct{})
+	for _, tail := range acc.GetTailNodes() {
+		id, _ := tail.GetProperty("id")
+		ids[id.(int)] = struct{}{}
+	}
+	if len(ids) != 3 {
+		t.Errorf("Wrong result: %v", ids)
+	}
+	for _, id := range []int{9, 10, 11} {
+		if _, ok := ids[id]; !ok {
+			t.Errorf("Missing %d: %v", id, ids)
+		}
+	}
+	// Reversed pattern: the nearest item is not the first item
+	pat = Pattern{
+		{Name: "author", Labels: NewStringSet("Author"), Properties: map[string]interface{}{"id": 10}},
+		{Labels: NewStringSet("writtenBy"), ToLeft: true, Min: 1, Max: 1},
+		{Name: "doc", Nearest: &NearestQuery{Property: "embedding", Vector: []float32{0, 1}, K: 3}},
+	}
+	acc = &DefaultMatchAccumulator{}
+	if err := pat.Run(g, nil, acc); err != nil {
+		t.Error(err)
+	}
+	if len(acc.Paths) != 0 {
+		t.Errorf("Expecting no results: %v", acc.Paths)
+	}
+	pat[2].Nearest.Property = "x"
+	if err := pat.Run(g, nil, acc); err == nil {
+		t.Errorf("Expecting error")
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"time"
+)
+
+// ErrNotVersioned is returned for a query on the history of a graph
+// that is not versioned
+type ErrNotVersioned struct{}
+
+func (e ErrNotVersioned) Error() string { return "Graph is not versioned" }
+
+// ErrAlreadyVersioned is returned by EnableVersioning if versioning is
+// already enabled
+type ErrAlreadyVersioned struct{}
+
+func (e ErrAlreadyVersioned) Error() string { return "Graph is already versioned" }
+
+// VersioningOptions are the options of a versioned graph
+type VersioningOptions struct {
+	// Clock returns the time a change becomes valid. If nil, time.Now
+	// is used. The changes made in a transaction become valid when the
+	// transaction commits. If the clock goes back, changes become
+	// valid at the time of the last change.
+	Clock func() time.Time
+}
+
+// ValidInterval is the interval [From,To) in which a node, an edge,
+// or a property value is valid. To is zero if the interval is open.
+type ValidInterval struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains returns if t is in the interval
+func (v ValidInterval) Contains(t time.Time) bool {
+	return !t.Before(v.From) && (v.To.IsZero() || t.Before(v.To))
+}
+
+// PropertyVersion is a property value and the interval in which it
+// is valid
+type PropertyVersion struct {
+	Value interface{}
+	Valid ValidInterval
+}
+
+type versionedEvent struct {
+	at    time.Time
+	event GraphEvent
+}
+
+// history records the changes to a graph with the time they became
+// valid. The changes are recorded in order, so the graph as of a time
+// is built by replaying the changes up to that time.
+type history struct {
+	clock  func() time.Time
+	events []versionedEvent
+	last   time.Time
+
+	// Events of the active transaction
+	inTx    bool
+	pending []GraphEvent
+
+	cancel func()
+}
+
+func (h *history) now() time.Time {
+	t := h.clock()
+	if t.Before(h.last) {
+		t = h.last
+	}
+	h.last = t
+	return t
+}
+
+func (h *history) add(at time.Time, e GraphEvent) {
+	// The history refers to nodes and edges by ID, so removed nodes
+	// and edges are not kept
+	e.Node, e.Edge = nil, nil
+	h.events = append(h.events, versionedEvent{at: at, event: e})
+}
+
+func (h *history) onEvent(e GraphEvent) {
+	if h.inTx {
+		h.pending = append(h.pending, e)
+		return
+	}
+	h.add(h.now(), e)
+}
+
+func (h *history) txBegin() {
+	h.inTx = true
+	h.pending = nil
+}
+
+func (h *history) txCommit() error { return nil }
+
+func (h *history) txEnd(committed bool) {
+	h.inTx = false
+	if committed && len(h.pending) > 0 {
+		at := h.now()
+		for _, e := range h.pending {
+			h.add(at, e)
+		}
+	}
+	h.pending = nil
+}
+
+func isNodeEvent(t GraphEventType) bool {
+	switch t {
+	case NodeCreatedEvent, NodeRemovedEvent, NodeLabelsChangedEvent, NodePropertySetEvent, NodePropertyRemovedEvent, NodeExternalIDChangedEvent:
+		return true
+	}
+	return false
+}
+
+// versionTracker builds the list of versions of a value from the
+// start and end times of the versions. Versions that start and end
+// at the same time, such as the intermediate values in a transaction,
+// are not included.
+type versionTracker struct {
+	versions []PropertyVersion
+	open     bool
+}
+
+func (v *versionTracker) start(at time.Time, value interface{}) {
+	v.end(at)
+	v.versions = append(v.versions, PropertyVersion{Value: value, Valid: ValidInterval{From: at}})
+	v.open = true
+}
+
+func (v *versionTracker) end(at time.Time) {
+	if !v.open {
+		return
+	}
+	v.open = false
+	last := &v.versions[len(v.versions)-1]
+	if !at.After(last.Valid.From) {
+		v.versions = v.versions[:len(v.versions)-1]
+		return
+	}
+	last.Valid.To = at
+}
+
+// versions returns the versions of the existence of the node or
+// edge, or of the property value if key is nonempty
+func (h *history) versions(edge bool, id int, key string) []PropertyVersion {
+	var tracker versionTracker
+	for _, v := range h.events {
+		e := v.event
+		if edge {
+			if isNodeEvent(e.Type) || e.EdgeID != id {
+				continue
+			}
+		} else if !isNodeEvent(e.Type) || e.NodeID != id {
+			continue
+		}
+		switch e.Type {
+		case NodeCreatedEvent, EdgeCreatedEvent:
+			if len(key) == 0 {
+				tracker.start(v.at, nil)
+			} else if value, ok := e.Properties[key]; ok {
+				tracker.start(v.at, value)
+			}
+		case NodeRemovedEvent, EdgeRemovedEvent:
+			tracker.end(v.at)
+		case NodePropertySetEvent, EdgePropertySetEvent:
+			if len(key) > 0 && e.Key == key {
+				tracker.start(v.at, e.Value)
+			}
+		case NodePropertyRemovedEvent, EdgePropertyRemovedEvent:
+			if len(key) > 0 && e.Key == key {
+				tracker.end(v.at)
+			}
+		}
+	}
+	return tracker.versions
+}
+
+func (h *history) validity(edge bool, id int) []ValidInterval {
+	versions := h.versions(edge, id, "")
+	ret := make([]ValidInterval, 0, len(versions))
+	for _, v := range versions {
+		ret = append(ret, v.Valid)
+	}
+	return ret
+}
+
+// EnableVersioning starts recording the history of the graph, so the
+// graph can be queried as of a time using AsOf. The existing nodes
+// and edges become valid at the time versioning is enabled. Returns
+// ErrTx if there is an active transaction, and ErrAlreadyVersioned if
+// versioning is already enabled. To change the options, call
+// DisableVersioning first, which discards the history.
+//
+// The history is kept in memory, and it grows with every change.
+func (g *Graph) EnableVersioning(options VersioningOptions) error {
+	if g.history != nil {
+		return ErrAlreadyVersioned{}
+	}
+	if g.tx != nil {
+		return ErrTx{Msg: "versioning cannot be enabled in a transaction"}
+	}
+	h := &history{clock: options.Clock}
+	if h.clock == nil {
+		h.clock = time.Now
+	}
+	at := h.now()
+	for nodes := g.GetNodes(); nodes.Next(); {
+		h.add(at, nodeEvent(NodeCreatedEvent, nodes.Node()))
+	}
+	for edges := g.GetEdges(); edges.Next(); {
+		h.add(at, edgeEvent(EdgeCreatedEvent, edges.Edge()))
+	}
+	h.cancel = g.Observe(h.onEvent)
+	g.txObservers = append(g.txObservers, h)
+	g.history = h
+	return nil
+}
+
+// DisableVersioning stops recording the history of the graph, and
+// discards the recorded history
+func (g *Graph) DisableVersioning() {
+	if g.history == nil {
+		return
+	}
+	g.history.cancel()
+	observers := make([]txObserver, 0, len(g.txObservers))
+	for _, o := range g.txObservers {
+		if o != txObserver(g.history) {
+			observers = append(observers, o)
+		}
+	}
+	g.txObservers = observers
+	g.history = nil
+}
+
+// IsVersioned returns true if the history of the graph is recorded
+func (g *Graph) IsVersioned() bool { return g.history != nil }
+
+// AsOf returns a read-only graph with the nodes, edges, labels, and
+// property values that were valid at time t, and with the indexes of
+// g. The nodes and edges have the same IDs as in g, so FindNodes and
+// Pattern.Run on the returned graph are evaluated as of t. Returns
+// ErrNotVersioned if versioning is not enabled.
+//
+// The graph is built by replaying the recorded changes from the start
+// of the history up to t, and then building the indexes, so each call
+// is proportional to the number of changes before t, not to the size
+// of the graph at t. To query many times, keep the returned graph
+// instead of calling AsOf again.
+func (g *Graph) AsOf(t time.Time) (*Graph, error) {
+	if g.history == nil {
+		return nil, ErrNotVersioned{}
+	}
+	ret := NewGraph()
+	for _, v := range g.history.events {
+		if v.at.After(t) {
+			break
+		}
+		if err := ret.ApplyEvent(v.event); err != nil {
+			return nil, err
+		}
+	}
+	g.index.copyIndexes(ret)
+	ret.readOnly = true
+	return ret, nil
+}
+
+// NodeValidity returns the intervals in which the node with the ID
+// existed, in order. Returns nil if versioning is not enabled. This and
+// the other per-item history queries scan the whole history.
+func (g *Graph) NodeValidity(id int) []ValidInterval {
+	if g.history == nil {
+		return nil
+	}
+	return g.history.validity(false, id)
+}
+
+// EdgeValidity returns the intervals in which the edge with the ID
+// existed, in order. Returns nil if versioning is not enabled.
+func (g *Graph) EdgeValidity(id int) []ValidInterval {
+	if g.history == nil {
+		return nil
+	}
+	return g.history.validity(true, id)
+}
+
+// NodePropertyVersions returns the values of the property of the node
+// with the ID, and the intervals in which they were valid, in
+// order. Returns nil if versioning is not enabled.
+func (g *Graph) NodePropertyVersions(id int, key string) []PropertyVersion {
+	if g.history == nil {
+		return nil
+	}
+	return g.history.versions(false, id, key)
+}
+
+// EdgePropertyVersions returns the values of the property of the edge
+// with the ID, and the intervals in which they were valid, in
+// order. Returns nil if versioning is not enabled.
+func (g *Graph) EdgePropertyVersions(id int, key string) []PropertyVersion {
+	if g.history == nil {
+		return nil
+	}
+	return g.history.versions(true, id, key)
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVersionedGraph(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0
+	day := func(i int) time.Time { return t0.AddDate(0, 0, i) }
+
+	g := NewGraph()
+	g.AddNodePropertyIndex("name", HashIndex)
+	a := g.NewNode([]string{"Dataset"}, map[string]interface{}{"name": "a"})
+	if _, err := g.AsOf(now); err == nil {
+		t.Errorf("Expecting ErrNotVersioned")
+	}
+	if err := g.EnableVersioning(VersioningOptions{Clock: func() time.Time { return now }}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, ok := g.EnableVersioning(VersioningOptions{}).(ErrAlreadyVersioned); !ok {
+		t.Errorf("Expecting ErrAlreadyVersioned")
+	}
+
+	now = day(1)
+	b := g.NewNode([]string{"Dataset"}, map[string]interface{}{"name": "b"})
+	now = day(2)
+	e := g.NewEdge(a, b, "derivedFrom", nil)
+	now = day(3)
+	a.SetProperty("name", "a2")
+	now = day(4)
+	// A transaction is recorded at commit, and intermediate values
+	// are not versions
+	tx := g.Begin()
+	b.SetProperty("name", "x")
+	now = day(5)
+	b.SetProperty("name", "b2")
+	if err := tx.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+	// Rolled back changes are not recorded
+	now = day(6)
+	tx = g.Begin()
+	e.Remove()
+	a.SetProperty("name", "y")
+	tx.Rollback()
+	now = day(7)
+	e.Remove()
+
+	findName := func(g *Graph, name string) int {
+		return len(NodeSlice(g.FindNodes(StringSet{}, map[string]interface{}{"name": name})))
+	}
+	matches := func(g *Graph) int {
+		pat := Pattern{
+			{Labels: NewStringSet("Dataset"), Properties: map[string]interface{}{"name": "a"}},
+			{Labels: NewStringSet("derivedFrom"), Min: 1, Max: 1},
+			{Labels: NewStringSet("Dataset")},
+		}
+		acc := &DefaultMatchAccumulator{}
+		if err := pat.Run(g, nil, acc); err != nil {
+			t.Error(err)
+		}
+		return len(acc.Paths)
+	}
+
+	for _, tc := range []struct {
+		at      time.Time
+		nodes   int
+		edges   int
+		names   []string
+		matches int
+	}{
+		{day(0), 1, 0, []string{"a"}, 0},
+		{day(1).Add(-time.Second), 1, 0, []string{"a"}, 0},
+		{day(1), 2, 0, []string{"a", "b"}, 0},
+		{day(2), 2, 1, []string{"a", "b"}, 1},
+		{day(3), 2, 1, []string{"a2", "b"}, 0},
+		{day(4), 2, 1, []string{"a2", "b"}, 0},
+		{day(5), 2, 1, []string{"a2", "b2"}, 0},
+		{day(6), 2, 1, []string{"a2", "b2"}, 0},
+		{day(7), 2, 0, []string{"a2", "b2"}, 0},
+	} {
+		v, err := g.AsOf(tc.at)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if v.NumNodes() != tc.nodes || v.NumEdges() != tc.edges {
+			t.Errorf("%v: wrong graph: %d nodes %d edges", tc.at, v.NumNodes(), v.NumEdges())
+		}
+		for _, name := range tc.names {
+			if findName(v, name) != 1 {
+				t.Errorf("%v: cannot find %s", tc.at, name)
+			}
+		}
+		if findName(v, "x") != 0 || findName(v, "y") != 0 {
+			t.Errorf("%v: found uncommitted value", tc.at)
+		}
+		if m := matches(v); m != tc.matches {
+			t.Errorf("%v: expected %d matches got %d", tc.at, tc.matches, m)
+		}
+		if _, ok := v.index.nodeProperties["name"]; !ok {
+			t.Errorf("%v: index not copied", tc.at)
+		}
+		if v.GetNode(a.GetID()) == nil {
+			t.Errorf("%v: node ID changed", tc.at)
+		}
+	}
+
+	validity := g.EdgeValidity(e.GetID())
+	if len(validity) != 1 || !validity[0].From.Equal(day(2)) || !validity[0].To.Equal(day(7)) {
+		t.Errorf("Wrong edge validity: %v", validity)
+	}
+	if !validity[0].Contains(day(2)) || validity[0].Contains(day(7)) {
+		t.Errorf("Wrong interval")
+	}
+	validity = g.NodeValidity(a.GetID())
+	if len(validity) != 1 || !validity[0].From.Equal(day(0)) || !validity[0].To.IsZero() {
+		t.Errorf("Wrong node validity: %v", validity)
+	}
+
+	versions := g.NodePropertyVersions(b.GetID(), "name")
+	if len(versions) != 2 || versions[0].Value != "b" || versions[1].Value != "b2" ||
+		!versions[0].Valid.To.Equal(day(5)) || !versions[1].Valid.From.Equal(day(5)) || !versions[1].Valid.To.IsZero() {
+		t.Errorf("Wrong versions: %v", versions)
+	}
+
+	// The clock going back does not reorder the history
+	now = day(1)
+	a.RemoveProperty("name")
+	if v, _ := g.AsOf(day(6)); findName(v, "a2") != 1 {
+		t.Errorf("Change recorded in the past")
+	}
+	versions = g.NodePropertyVersions(a.GetID(), "name")
+	if len(versions) != 2 || !versions[1].Valid.To.Equal(day(7)) {
+		t.Errorf("Wrong versions: %v", versions)
+	}
+
+	v, _ := g.AsOf(day(7))
+	func() {
+		defer func() {
+			if _, ok := recover().(ErrReadOnlyGraph); !ok {
+				t.Errorf("Expecting read-only graph")
+			}
+		}()
+		v.NewNode(nil, nil)
+	}()
+
+	g.DisableVersioning()
+	if g.IsVersioned() || len(g.txObservers) != 0 || g.NodeValidity(a.GetID()) != nil {
+		t.Errorf("Versioning not disabled")
+	}
+}
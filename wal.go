@@ -0,0 +1,636 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrWAL is returned when the persistent graph files cannot be read or
+// written
+type ErrWAL struct {
+	Msg string
+}
+
+func (e ErrWAL) Error() string { return "WAL error: " + e.Msg }
+
+// ErrWALRecordTooLarge is returned when a log record is larger than
+// the maximum record size, for example because a transaction has too
+// many changes. The record is not written.
+type ErrWALRecordTooLarge struct {
+	// Size of the encoded record
+	Size int
+	// Number of events in the record
+	Events int
+}
+
+func (e ErrWALRecordTooLarge) Error() string {
+	return fmt.Sprintf("WAL error: record too large: %d bytes, %d events", e.Size, e.Events)
+}
+
+// WALSyncPolicy determines when the log is flushed to disk
+type WALSyncPolicy int
+
+const (
+	// Sync the log after every record. A record is a mutation made
+	// outside a transaction, or a committed transaction.
+	WALSyncAlways WALSyncPolicy = iota
+	// Sync the log when a record is written and the last sync is older
+	// than the sync interval. Records written within the interval may
+	// be lost if the system crashes.
+	WALSyncInterval
+	// Never sync the log explicitly. The operating system decides when
+	// the data is written to disk. Use PersistentGraph.Sync to flush
+	// the log.
+	WALSyncNever
+)
+
+// PersistentGraphOptions are the options of a persistent graph
+type PersistentGraphOptions struct {
+	Sync WALSyncPolicy
+	// SyncInterval is used with WALSyncInterval
+	SyncInterval time.Duration
+	// If nonzero, a snapshot is written and the log is truncated after
+	// this many log records
+	SnapshotEvery int
+}
+
+// RecoveryInfo describes the state recovered when a persistent graph
+// is opened
+type RecoveryInfo struct {
+	// SnapshotSeq is the sequence number of the last record included in
+	// the snapshot
+	SnapshotSeq uint64
+	// Records is the number of log records replayed after the snapshot
+	Records int
+	// TruncatedBytes is the size of the incomplete or corrupt data
+	// removed from the end of the log
+	TruncatedBytes int64
+}
+
+// PersistentGraph keeps a graph in a directory on the local file
+// system as a snapshot and a write-ahead log. Every mutation made
+// outside a transaction, and every committed transaction, is appended
+// to the log as a single checksummed record. The changes of a
+// transaction that is rolled back are not logged. Snapshot writes the
+// whole graph to a snapshot file and truncates the log.
+//
+// When a persistent graph is opened, the snapshot is loaded, and the
+// log records written after the snapshot are replayed. A record that
+// is incomplete or has a bad checksum, for instance because the
+// process crashed while writing it, is detected, and the log is
+// truncated before it.
+//
+// Node and edge IDs, external IDs, labels, and properties are
+// persisted. Property values are written using
+// EncodeTypedJSONValue. Indexes and constraints are not persisted, so
+// they must be added again after the graph is opened.
+//
+// Every change to the graph is made in a transaction: a mutation made
+// outside a transaction runs in a transaction of its own. A change
+// that cannot be logged, because a property value cannot be encoded
+// or the record is too large, is rejected when its transaction
+// commits: the transaction is rolled back, and Commit returns the
+// error, or the mutation panics with it. After an error writing the
+// log, the log is no longer written. The error is returned by Err,
+// Sync, Snapshot, and Close, and every later transaction is rolled
+// back with it, so later mutations panic with it.
+type PersistentGraph struct {
+	dir  string
+	opts PersistentGraphOptions
+	g    *Graph
+	log  *os.File
+	err  error
+
+	// The sequence number of the last record
+	seq uint64
+	// Number of records in the log
+	nRecords int
+	lastSync time.Time
+
+	// Events of the active transaction, and the first error encoding
+	// them
+	inTx    bool
+	pending []walEvent
+	txErr   error
+	// The encoded record of the committing transaction
+	record []byte
+
+	recovery RecoveryInfo
+	cancel   func()
+}
+
+const (
+	walSnapshotFile = "snapshot"
+	walLogFile      = "wal"
+)
+
+var (
+	// Records larger than this are treated as corrupt, and cannot be
+	// written
+	walMaxRecordSize = 1 << 30
+	// The number of events in a snapshot record. A snapshot is written
+	// as a sequence of records.
+	walSnapshotChunkSize = 4096
+)
+
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// walRecord is a log or snapshot record
+type walRecord struct {
+	Seq    uint64     `json:"seq"`
+	IDBase int        `json:"idBase"`
+	Events []walEvent `json:"events"`
+}
+
+// walEvent is the persisted form of a GraphEvent. Only the fields
+// needed to apply the event are persisted.
+type walEvent struct {
+	T      string                     `json:"t"`
+	Node   int                        `json:"n,omitempty"`
+	Edge   int                        `json:"e,omitempty"`
+	From   int                        `json:"from,omitempty"`
+	To     int                        `json:"to,omitempty"`
+	Labels []string                   `json:"labels,omitempty"`
+	Label  string                     `json:"label,omitempty"`
+	Props  map[string]json.RawMessage `json:"props,omitempty"`
+	Key    string                     `json:"key,omitempty"`
+	Value  json.RawMessage            `json:"value,omitempty"`
+	XID    string                     `json:"xid,omitempty"`
+}
+
+func newWALEvent(e GraphEvent) (walEvent, error) {
+	ret := walEvent{
+		T:      e.Type.String(),
+		Node:   e.NodeID,
+		Edge:   e.EdgeID,
+		From:   e.FromID,
+		To:     e.ToID,
+		Labels: e.Labels.SortedSlice(),
+		Label:  e.Label,
+		Key:    e.Key,
+		XID:    e.ExternalID,
+	}
+	if len(e.Properties) > 0 {
+		ret.Props = make(map[string]json.RawMessage, len(e.Properties))
+		for k, v := range e.Properties {
+			data, err := EncodeTypedJSONValue(v)
+			if err != nil {
+				return ret, err
+			}
+			ret.Props[k] = data
+		}
+	}
+	if e.Type == NodePropertySetEvent || e.Type == EdgePropertySetEvent {
+		data, err := EncodeTypedJSONValue(e.Value)
+		if err != nil {
+			return ret, err
+		}
+		ret.Value = data
+	}
+	return ret, nil
+}
+
+func (w walEvent) graphEvent() (GraphEvent, error) {
+	ret := GraphEvent{
+		Type:       -1,
+		NodeID:     w.Node,
+		EdgeID:     w.Edge,
+		FromID:     w.From,
+		ToID:       w.To,
+		Labels:     NewStringSet(w.Labels...),
+		Label:      w.Label,
+		Key:        w.Key,
+		ExternalID: w.XID,
+	}
+	for i, name := range graphEventTypeNames {
+		if name == w.T {
+			ret.Type = GraphEventType(i)
+			break
+		}
+	}
+	if ret.Type == -1 {
+		return ret, ErrWAL{Msg: "Unknown event type: " + w.T}
+	}
+	if len(w.Props) > 0 {
+		ret.Properties = make(map[string]interface{}, len(w.Props))
+		for k, v := range w.Props {
+			value, err := DecodeTypedJSONValue(v)
+			if err != nil {
+				return ret, err
+			}
+			ret.Properties[k] = value
+		}
+	}
+	if len(w.Value) > 0 {
+		value, err := DecodeTypedJSONValue(w.Value)
+		if err != nil {
+			return ret, err
+		}
+		ret.Value = value
+	}
+	return ret, nil
+}
+
+// encodeWALRecord returns the record with its header. The header is
+// the length of the payload and its CRC. Returns
+// ErrWALRecordTooLarge if the payload is larger than the maximum
+// record size.
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > walMaxRecordSize {
+		return nil, ErrWALRecordTooLarge{Size: len(payload), Events: len(rec.Events)}
+	}
+	buf := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, walCRCTable))
+	copy(buf[8:], payload)
+	return buf, nil
+}
+
+// encodeWALSnapshotRecords encodes the snapshot record. If the record
+// is too large, its events are split into two records.
+func encodeWALSnapshotRecords(rec walRecord) ([]byte, error) {
+	data, err := encodeWALRecord(rec)
+	if _, tooLarge := err.(ErrWALRecordTooLarge); !tooLarge || len(rec.Events) < 2 {
+		return data, err
+	}
+	half := len(rec.Events) / 2
+	first, err := encodeWALSnapshotRecords(walRecord{Seq: rec.Seq, IDBase: rec.IDBase, Events: rec.Events[:half]})
+	if err != nil {
+		return nil, err
+	}
+	second, err := encodeWALSnapshotRecords(walRecord{Seq: rec.Seq, IDBase: rec.IDBase, Events: rec.Events[half:]})
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// decodeWALRecords decodes the records in data. It returns the
+// records, and the size of the valid records. Decoding stops at the
+// first incomplete or corrupt record.
+func decodeWALRecords(data []byte) ([]walRecord, int64) {
+	ret := make([]walRecord, 0)
+	offset := 0
+	for len(data)-offset >= 8 {
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		crc := binary.LittleEndian.Uint32(data[offset+4:])
+		if length > walMaxRecordSize || length > len(data)-offset-8 {
+			break
+		}
+		payload := data[offset+8 : offset+8+length]
+		if crc32.Checksum(payload, walCRCTable) != crc {
+			break
+		}
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			break
+		}
+		ret = append(ret, rec)
+		offset += 8 + length
+	}
+	return ret, int64(offset)
+}
+
+// OpenPersistentGraph opens the persistent graph in the directory,
+// creating the directory if it does not exist, and recovers the graph
+// from the snapshot and the log.
+func OpenPersistentGraph(dir string, opts PersistentGraphOptions) (*PersistentGraph, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	p := &PersistentGraph{
+		dir:  dir,
+		opts: opts,
+		g:    NewGraph(),
+	}
+	idBase := 0
+	apply := func(rec walRecord) error {
+		for _, w := range rec.Events {
+			e, err := w.graphEvent()
+			if err != nil {
+				return err
+			}
+			if err := p.g.ApplyEvent(e); err != nil {
+				return err
+			}
+		}
+		if rec.IDBase > idBase {
+			idBase = rec.IDBase
+		}
+		p.seq = rec.Seq
+		return nil
+	}
+
+	// The snapshot is written atomically, so it must be valid
+	data, err := os.ReadFile(filepath.Join(dir, walSnapshotFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		recs, n := decodeWALRecords(data)
+		if len(recs) == 0 || n != int64(len(data)) {
+			return nil, ErrWAL{Msg: "Corrupt snapshot"}
+		}
+		for _, rec := range recs {
+			if rec.Seq != recs[0].Seq {
+				return nil, ErrWAL{Msg: "Corrupt snapshot"}
+			}
+			if err := apply(rec); err != nil {
+				return nil, err
+			}
+		}
+		p.recovery.SnapshotSeq = recs[0].Seq
+	}
+
+	p.log, err = os.OpenFile(filepath.Join(dir, walLogFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err = os.ReadFile(p.log.Name())
+	if err != nil {
+		p.log.Close()
+		return nil, err
+	}
+	recs, n := decodeWALRecords(data)
+	if n < int64(len(data)) {
+		// Torn tail
+		p.recovery.TruncatedBytes = int64(len(data)) - n
+		if err := p.log.Truncate(n); err != nil {
+			p.log.Close()
+			return nil, err
+		}
+		if err := p.log.Sync(); err != nil {
+			p.log.Close()
+			return nil, err
+		}
+	}
+	for _, rec := range recs {
+		// The records before the snapshot are in the log if the
+		// process stopped before truncating the log
+		if rec.Seq <= p.recovery.SnapshotSeq {
+			continue
+		}
+		if err := apply(rec); err != nil {
+			p.log.Close()
+			return nil, err
+		}
+		p.recovery.Records++
+	}
+	p.nRecords = len(recs)
+	if idBase > p.g.idBase {
+		p.g.idBase = idBase
+	}
+	p.lastSync = time.Now()
+
+	p.cancel = p.g.Observe(p.onEvent)
+	p.g.txObservers = append(p.g.txObservers, p)
+	return p, nil
+}
+
+// Graph returns the graph. All modifications to the graph are logged.
+func (p *PersistentGraph) Graph() *Graph { return p.g }
+
+// Recovery returns information about the state recovered when the
+// graph is opened
+func (p *PersistentGraph) Recovery() RecoveryInfo { return p.recovery }
+
+// Err returns the first error writing the log
+func (p *PersistentGraph) Err() error { return p.err }
+
+func (p *PersistentGraph) onEvent(e GraphEvent) {
+	if p.err != nil {
+		return
+	}
+	if !p.inTx {
+		// The public mutations run in a transaction, so this is not
+		// expected
+		p.txBegin()
+		p.onEvent(e)
+		if p.err = p.txCommit(); p.err == nil {
+			p.txEnd(true)
+		}
+		return
+	}
+	if p.txErr != nil {
+		return
+	}
+	w, err := newWALEvent(e)
+	if err != nil {
+		p.txErr = err
+		return
+	}
+	p.pending = append(p.pending, w)
+}
+
+func (p *PersistentGraph) txBegin() {
+	p.inTx = true
+	p.pending = nil
+	p.txErr = nil
+	p.record = nil
+}
+
+// txCommit encodes the record of the transaction. The transaction is
+// rolled back if the record cannot be encoded, or if the log cannot
+// be written.
+func (p *PersistentGraph) txCommit() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.txErr != nil {
+		return p.txErr
+	}
+	if len(p.pending) == 0 {
+		return nil
+	}
+	data, err := encodeWALRecord(walRecord{Seq: p.seq + 1, IDBase: p.g.idBase, Events: p.pending})
+	if err != nil {
+		return err
+	}
+	p.record = data
+	return nil
+}
+
+// txEnd writes the record of a committed transaction. The graph is not
+// in the middle of a change, so a snapshot can be written.
+func (p *PersistentGraph) txEnd(committed bool) {
+	p.inTx = false
+	if committed && p.record != nil && p.err == nil {
+		p.write(p.record)
+		if p.err == nil && p.opts.SnapshotEvery > 0 && p.nRecords >= p.opts.SnapshotEvery {
+			p.err = p.Snapshot()
+		}
+	}
+	p.pending = nil
+	p.txErr = nil
+	p.record = nil
+}
+
+func (p *PersistentGraph) write(data []byte) {
+	if _, err := p.log.Write(data); err != nil {
+		p.err = err
+		return
+	}
+	p.seq++
+	p.nRecords++
+	switch p.opts.Sync {
+	case WALSyncAlways:
+		p.err = p.sync()
+	case WALSyncInterval:
+		if time.Since(p.lastSync) >= p.opts.SyncInterval {
+			p.err = p.sync()
+		}
+	}
+}
+
+func (p *PersistentGraph) sync() error {
+	p.lastSync = time.Now()
+	return p.log.Sync()
+}
+
+// Sync flushes the log to disk
+func (p *PersistentGraph) Sync() error {
+	if p.err != nil {
+		return p.err
+	}
+	p.err = p.sync()
+	return p.err
+}
+
+// Snapshot writes the graph to the snapshot file, and truncates the
+// log. The snapshot is written to a temporary file first, and renamed,
+// so a crash leaves either the old or the new snapshot. Snapshot
+// cannot be called in a transaction.
+//
+// The snapshot is written as a sequence of records, so its size is
+// not limited by the maximum record size. A node or edge that does not
+// fit in a record by itself causes ErrWALRecordTooLarge.
+func (p *PersistentGraph) Snapshot() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.inTx {
+		return ErrWAL{Msg: "Snapshot in a transaction"}
+	}
+	data := make([]byte, 0)
+	events := make([]walEvent, 0, walSnapshotChunkSize)
+	flush := func(last bool) error {
+		if len(events) < walSnapshotChunkSize && !last {
+			return nil
+		}
+		chunk, err := encodeWALSnapshotRecords(walRecord{Seq: p.seq, IDBase: p.g.idBase, Events: events})
+		if err != nil {
+			return err
+		}
+		data = append(data, chunk...)
+		events = events[:0]
+		return nil
+	}
+	for nodes := p.g.GetNodes(); nodes.Next(); {
+		w, err := newWALEvent(nodeEvent(NodeCreatedEvent, nodes.Node()))
+		if err != nil {
+			return err
+		}
+		events = append(events, w)
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	for edges := p.g.GetEdges(); edges.Next(); {
+		w, err := newWALEvent(edgeEvent(EdgeCreatedEvent, edges.Edge()))
+		if err != nil {
+			return err
+		}
+		events = append(events, w)
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	if err := flush(true); err != nil {
+		return err
+	}
+	tmp := filepath.Join(p.dir, walSnapshotFile+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(p.dir, walSnapshotFile)); err != nil {
+		return err
+	}
+	if err := syncDir(p.dir); err != nil {
+		return err
+	}
+	// The snapshot has the log records, so the log can be truncated
+	if err := p.log.Truncate(0); err != nil {
+		p.err = err
+		return err
+	}
+	p.nRecords = 0
+	return p.Sync()
+}
+
+// Close flushes the log and closes the files. The graph is no longer
+// persisted after Close.
+func (p *PersistentGraph) Close() error {
+	p.cancel()
+	observers := make([]txObserver, 0, len(p.g.txObservers))
+	for _, o := range p.g.txObservers {
+		if o != txObserver(p) {
+			observers = append(observers, o)
+		}
+	}
+	p.g.txObservers = observers
+	err := p.Sync()
+	if cerr := p.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
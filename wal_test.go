@@ -0,0 +1,251 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lpg
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildWALTestGraph(t *testing.T, g *Graph) {
+	n1 := g.NewNode([]string{"a"}, map[string]interface{}{"key": 1, "t": time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)})
+	n2 := g.NewNode([]string{"b"}, map[string]interface{}{"key": int64(2), "l": []string{"x", "y"}})
+	n3 := g.NewNode([]string{"c"}, nil)
+	e := g.NewEdge(n1, n2, "e", map[string]interface{}{"w": 1.5})
+	g.NewEdge(n2, n3, "f", nil)
+	n2.SetExternalID("n2")
+	e.SetLabel("g")
+
+	tx := g.Begin()
+	g.NewNode([]string{"d"}, nil)
+	n1.SetProperty("key", 5)
+	tx.Rollback()
+
+	tx = g.Begin()
+	n3.DetachAndRemove()
+	g.NewNode([]string{"d"}, nil)
+	n1.RemoveProperty("t")
+	if err := tx.Commit(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPersistentGraph(t *testing.T) {
+	for _, opts := range []PersistentGraphOptions{
+		{},
+		{Sync: WALSyncNever, SnapshotEvery: 3},
+	} {
+		dir := t.TempDir()
+		p, err := OpenPersistentGraph(dir, opts)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buildWALTestGraph(t, p.Graph())
+		expected := fmt.Sprint(describeGraph(p.Graph()))
+		if err := p.Close(); err != nil {
+			t.Error(err)
+		}
+
+		// Simulate a crash while writing a record
+		f, err := os.OpenFile(filepath.Join(dir, walLogFile), os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, '{'})
+		f.Close()
+
+		p, err = OpenPersistentGraph(dir, opts)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if got := fmt.Sprint(describeGraph(p.Graph())); got != expected {
+			t.Errorf("Recovery failed: %v: %s %s", opts, expected, got)
+		}
+		if p.Recovery().TruncatedBytes != 9 {
+			t.Errorf("Torn tail not detected: %+v", p.Recovery())
+		}
+		if opts.SnapshotEvery > 0 && p.Recovery().SnapshotSeq == 0 {
+			t.Errorf("No snapshot")
+		}
+		// IDs are not reused after recovery
+		if n := p.Graph().NewNode(nil, nil); n.GetID() != 6 {
+			t.Errorf("Wrong ID: %d", n.GetID())
+		}
+		if err := p.Snapshot(); err != nil {
+			t.Error(err)
+		}
+		expected = fmt.Sprint(describeGraph(p.Graph()))
+		p.Close()
+
+		p, err = OpenPersistentGraph(dir, opts)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if got := fmt.Sprint(describeGraph(p.Graph())); got != expected {
+			t.Errorf("Recovery from snapshot failed: %s %s", expected, got)
+		}
+		if p.Recovery().Records != 0 {
+			t.Errorf("Expecting empty log: %+v", p.Recovery())
+		}
+		p.Close()
+	}
+}
+
+func TestPersistentGraphLargeSnapshot(t *testing.T) {
+	defer func(size, chunk int) {
+		walMaxRecordSize, walSnapshotChunkSize = size, chunk
+	}(walMaxRecordSize, walSnapshotChunkSize)
+	walMaxRecordSize = 4096
+	walSnapshotChunkSize = 1000
+
+	dir := t.TempDir()
+	p, err := OpenPersistentGraph(dir, PersistentGraphOptions{Sync: WALSyncNever})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	g := p.Graph()
+	// The snapshot is larger than a record, and a chunk of events is
+	// split to fit in records
+	tx := g.Begin()
+	var prev *Node
+	for i := 0; i < 200; i++ {
+		node := g.NewNode([]string{"a"}, map[string]interface{}{"i": i})
+		if prev != nil {
+			g.NewEdge(prev, node, "next", nil)
+		}
+		prev = node
+		if i%10 == 9 {
+			tx.Commit()
+			tx = g.Begin()
+		}
+	}
+	tx.Commit()
+	if err := p.Snapshot(); err != nil {
+		t.Error(err)
+		return
+	}
+	expected := fmt.Sprint(describeGraph(g))
+	p.Close()
+	data, _ := os.ReadFile(filepath.Join(dir, walSnapshotFile))
+	if recs, _ := decodeWALRecords(data); len(recs) < 2 {
+		t.Errorf("Snapshot not split: %d records", len(recs))
+	}
+	p, err = OpenPersistentGraph(dir, PersistentGraphOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := fmt.Sprint(describeGraph(p.Graph())); got != expected {
+		t.Errorf("Recovery from snapshot failed: %s %s", expected, got)
+	}
+
+	// A record that does not fit is rejected with its change
+	n := p.Graph().NumNodes()
+	func() {
+		defer func() {
+			if _, ok := recover().(ErrWALRecordTooLarge); !ok {
+				t.Errorf("Expecting record too large")
+			}
+		}()
+		p.Graph().NewNode(nil, map[string]interface{}{"big": strings.Repeat("x", 5000)})
+	}()
+	if p.Graph().NumNodes() != n || p.Err() != nil {
+		t.Errorf("Change not rejected: %d %v", p.Graph().NumNodes(), p.Err())
+	}
+	p.Graph().NewNode(nil, nil)
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPersistentGraphErrors(t *testing.T) {
+	dir := t.TempDir()
+	p, err := OpenPersistentGraph(dir, PersistentGraphOptions{Sync: WALSyncNever, SnapshotEvery: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := p.Graph()
+	a := g.NewNode([]string{"a"}, map[string]interface{}{"key": 1})
+	b := g.NewNode([]string{"b"}, nil)
+	g.NewEdge(a, b, "e", nil)
+	g.NewEdge(b, a, "e", nil)
+
+	// A value that cannot be encoded is rejected with its change
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expecting encoding error")
+			}
+		}()
+		a.SetProperty("key", math.NaN())
+	}()
+	if v, _ := a.GetProperty("key"); v != 1 || p.Err() != nil {
+		t.Errorf("Change not rejected: %v %v", v, p.Err())
+	}
+	tx := g.Begin()
+	b.SetProperty("ch", make(chan int))
+	b.SetProperty("key", 2)
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expecting encoding error")
+	}
+	if _, ok := b.GetProperty("key"); ok {
+		t.Errorf("Transaction not rolled back")
+	}
+
+	// The snapshot is taken after the whole change
+	a.DetachAndRemove()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p, err = OpenPersistentGraph(dir, PersistentGraphOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g = p.Graph()
+	if g.NumNodes() != 1 || g.NumEdges() != 0 || p.Recovery().Records != 0 {
+		t.Errorf("Wrong recovery: %d %d %+v", g.NumNodes(), g.NumEdges(), p.Recovery())
+	}
+
+	// After a write error, later changes are rejected
+	p.log.Close()
+	g.NewNode(nil, nil)
+	if p.Err() == nil {
+		t.Errorf("Expecting write error")
+	}
+	func() {
+		defer func() {
+			if recover() != p.Err() {
+				t.Errorf("Expecting write error")
+			}
+		}()
+		g.NewNode(nil, nil)
+	}()
+	if g.NumNodes() != 2 {
+		t.Errorf("Change not rejected: %d", g.NumNodes())
+	}
+	if err := p.Close(); err == nil {
+		t.Errorf("Expecting write error")
+	}
+}